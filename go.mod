@@ -4,6 +4,10 @@ go 1.23.0
 
 toolchain go1.23.4
 
-require golang.org/x/crypto v0.36.0
-
-require golang.org/x/sys v0.31.0 // indirect
+require (
+	github.com/miekg/pkcs11 v1.1.2
+	golang.org/x/crypto v0.36.0
+	golang.org/x/sys v0.31.0
+	golang.org/x/term v0.30.0
+	gopkg.in/yaml.v3 v3.0.1
+)
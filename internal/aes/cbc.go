@@ -3,7 +3,6 @@ package aes
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"encoding/hex"
 	"errors"
 	"fmt"
 
@@ -31,10 +30,12 @@ func runCbc(cmd *cmd.Command) error {
 	fDecrypt := cmd.Flags.Bool("d", false, "Decrypt the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
 	fIV := cmd.Flags.String("iv", "", "IV as hex.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -43,28 +44,29 @@ func runCbc(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		return fmt.Errorf("key: %w", err)
 	}
+	defer key.Destroy()
 
 	if *fIV == "" {
 		cmd.Flags.Usage()
 		return errors.New("no IV specified, use -iv to specify it")
 	}
 
-	iv, err := hex.DecodeString(*fIV)
+	iv, err := util.HexOrSource(*fIV)
 	if err != nil {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -72,11 +74,11 @@ func runCbc(cmd *cmd.Command) error {
 	var c cipher.BlockMode
 	switch {
 	case *fEncrypt:
-		c, err = newCBCEncrypter(key, iv)
+		c, err = newCBCEncrypter(key.Bytes(), iv)
 	case *fDecrypt:
-		c, err = newCBCDecrypter(key, iv)
+		c, err = newCBCDecrypter(key.Bytes(), iv)
 	default:
-		c, err = newCBCEncrypter(key, iv)
+		c, err = newCBCEncrypter(key.Bytes(), iv)
 	}
 	if err != nil {
 		return err
@@ -84,7 +86,14 @@ func runCbc(cmd *cmd.Command) error {
 
 	output := cbcProcessBlocks(c, input)
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		if *fDecrypt {
+			return sf.WriteJSON(stdfile.Result{"plaintext": stdfile.Hex(output)})
+		}
+		return sf.WriteJSON(stdfile.Result{"ciphertext": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
 
 func newCBCEncrypter(key, iv []byte) (cipher.BlockMode, error) {
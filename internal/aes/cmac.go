@@ -6,6 +6,8 @@ import (
 
 	"bandr.me/p/pocryp/internal/aes/cmac"
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/pkcs11"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
@@ -21,15 +23,17 @@ Generate MAC using AES-CMAC.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
-`,
+` + "\n" + pkcs11.URIHelp,
 }
 
 func runCmacGenerate(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -38,28 +42,43 @@ func runCmacGenerate(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
-	if err != nil {
-		return fmt.Errorf("key: %w", err)
+	var key *secret.Buffer
+	if !pkcs11.IsURI(*fKey) {
+		var err error
+		key, err = util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+		defer key.Destroy()
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
-	output, err := cmac.Generate(key, input)
+	var output []byte
+	if key == nil {
+		output, err = pkcs11.CMAC(*fKey, input)
+		err = util.CryptoFailure(err)
+	} else {
+		output, err = cmac.Generate(key.Bytes(), input)
+	}
 	if err != nil {
 		return err
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"mac": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
 
 var CmacVerifyCmd = &cmd.Command{
@@ -77,9 +96,11 @@ If -in is not specified, stdin will be read.
 
 func runCmacVerify(cmd *cmd.Command) error {
 	fInput := cmd.Flags.String("in", "", "Read message from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fMac := cmd.Flags.String("mac", "", "Expected MAC as hex string.")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -88,10 +109,11 @@ func runCmacVerify(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		return fmt.Errorf("key: %w", err)
 	}
+	defer key.Destroy()
 
 	if *fMac == "" {
 		return fmt.Errorf("-mac not specified")
@@ -101,20 +123,25 @@ func runCmacVerify(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, "")
+	sf, err := stdfile.New(*fInput, "", stdfile.Options{})
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
-	valid := cmac.Verify(key, input, mac)
+	valid := cmac.Verify(key.Bytes(), input, mac)
+	if cmd.JSON {
+		if err := sf.WriteJSON(stdfile.Result{"valid": valid}); err != nil {
+			return err
+		}
+	}
 	if !valid {
-		return fmt.Errorf("not valid")
+		return util.ErrNotValid
 	}
 
 	return nil
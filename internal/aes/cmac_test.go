@@ -1,10 +1,12 @@
 package aes
 
 import (
+	"errors"
 	"path/filepath"
 	"testing"
 
 	"bandr.me/p/pocryp/internal/testutil"
+	"bandr.me/p/pocryp/internal/util"
 )
 
 func TestCmacCmd(t *testing.T) {
@@ -65,4 +67,33 @@ func TestCmacCmd(t *testing.T) {
 		}
 	})
 
+	t.Run("NotValid", func(t *testing.T) {
+		in := filepath.Join(tmp, "in")
+		testutil.SetupIn(t, in, testutil.BytesFromHex(t, tests[0].msg))
+
+		args := []string{"-key", key, "-in", in, "-mac", tests[1].mac}
+
+		if err := testutil.RunCmd(CmacVerifyCmd, args...); !errors.Is(err, util.ErrNotValid) {
+			t.Fatal("expected ErrNotValid, have", err)
+		}
+		if err := testutil.RunCmdJSON(CmacVerifyCmd, args...); !errors.Is(err, util.ErrNotValid) {
+			t.Fatal("expected ErrNotValid, have", err)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		in := filepath.Join(tmp, "in")
+		out := filepath.Join(tmp, "out")
+		testutil.SetupInOut(t, in, out, testutil.BytesFromHex(t, tests[0].msg))
+
+		if err := testutil.RunCmdJSON(CmacGenerateCmd, "-key", key, "-in", in, "-out", out); err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct{ MAC string }
+		testutil.ReadJSON(t, out, &result)
+		if result.MAC != tests[0].mac {
+			t.Fatalf("want %s, have %s", tests[0].mac, result.MAC)
+		}
+	})
 }
@@ -29,9 +29,11 @@ func runEcb(cmd *cmd.Command) error {
 	fDecrypt := cmd.Flags.Bool("d", false, "Decrypt the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -40,18 +42,19 @@ func runEcb(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		return fmt.Errorf("key: %w", err)
 	}
+	defer key.Destroy()
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -59,17 +62,24 @@ func runEcb(cmd *cmd.Command) error {
 	var output []byte
 	switch {
 	case *fEncrypt:
-		output, err = ecb(key, input, true)
+		output, err = ecb(key.Bytes(), input, true)
 	case *fDecrypt:
-		output, err = ecb(key, input, false)
+		output, err = ecb(key.Bytes(), input, false)
 	default:
-		output, err = ecb(key, input, true)
+		output, err = ecb(key.Bytes(), input, true)
 	}
 	if err != nil {
 		return err
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		if *fDecrypt {
+			return sf.WriteJSON(stdfile.Result{"plaintext": stdfile.Hex(output)})
+		}
+		return sf.WriteJSON(stdfile.Result{"ciphertext": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
 
 func ecb(key, in []byte, direction bool) ([]byte, error) {
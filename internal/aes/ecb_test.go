@@ -39,6 +39,24 @@ func TestEcbCmd(t *testing.T) {
 			t.Fatal("expected and error")
 		}
 	})
+	t.Run("InputAndKeyFormats", func(t *testing.T) {
+		tv := ECBTestVectors["128"]
+		keyFile := filepath.Join(tmp, "key")
+		in := filepath.Join(tmp, "in")
+		out := filepath.Join(tmp, "out")
+		testutil.SetupIn(t, keyFile, []byte("2b7e1516 28aed2a6\nabf71588 09cf4f3c\n"))
+		testutil.SetupInOut(t, in, out, []byte("6bc1bee22e409f96\ne93d7e117393172a\n"))
+		err := testutil.RunCmd(EcbCmd, "-bin", "-key-file", keyFile, "-in-format", "hex", "-in", in, "-out", out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.ExpectFileContent(t, out, tv.Ciphertexts[0])
+
+		err = testutil.RunCmd(EcbCmd, "-key-file", keyFile, "-key-format", "bin", "-in-format", "hex", "-in", in, "-out", out)
+		if err == nil {
+			t.Fatal("expected and error")
+		}
+	})
 }
 
 func testEcbCmd(t *testing.T, tmp string, direction string, key, input, expected []byte) {
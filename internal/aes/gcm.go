@@ -3,12 +3,12 @@ package aes
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/pkcs11"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
@@ -24,7 +24,7 @@ Encrypt/Decrypt INPUT to OUTPUT using AES-GCM.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
-`,
+` + "\n" + pkcs11.URIHelp,
 }
 
 func runGcm(cmd *cmd.Command) error {
@@ -32,11 +32,13 @@ func runGcm(cmd *cmd.Command) error {
 	fDecrypt := cmd.Flags.Bool("d", false, "Decrypt the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
 	fIV := cmd.Flags.String("iv", "", "IV as hex.")
 	fAAD := cmd.Flags.String("aad", "", "File which contains additional associated data as binary/text.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -45,9 +47,14 @@ func runGcm(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
-	if err != nil {
-		return fmt.Errorf("key: %w", err)
+	var key *secret.Buffer
+	if !pkcs11.IsURI(*fKey) {
+		var err error
+		key, err = util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+		defer key.Destroy()
 	}
 
 	if *fIV == "" {
@@ -55,47 +62,61 @@ func runGcm(cmd *cmd.Command) error {
 		return errors.New("no IV specified, use -iv to specify it")
 	}
 
-	iv, err := hex.DecodeString(*fIV)
+	iv, err := util.HexOrSource(*fIV)
 	if err != nil {
 		return err
 	}
 
 	var aad []byte
 	if *fAAD != "" {
-		b, err := os.ReadFile(*fAAD)
+		b, err := util.ReadSource(*fAAD)
 		if err != nil {
 			return err
 		}
 		aad = b
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
+	encrypt := *fEncrypt || !*fDecrypt
+
 	var output []byte
-	switch {
-	case *fEncrypt:
-		output, err = gcm(key, iv, input, aad, true)
-	case *fDecrypt:
-		output, err = gcm(key, iv, input, aad, false)
-	default:
-		output, err = gcm(key, iv, input, aad, true)
+	if key == nil {
+		output, err = pkcs11.GCM(*fKey, iv, input, aad, encrypt)
+		err = util.CryptoFailure(err)
+	} else {
+		output, err = gcm(key.Bytes(), iv, input, aad, encrypt)
 	}
 	if err != nil {
 		return err
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		if !encrypt {
+			return sf.WriteJSON(stdfile.Result{"plaintext": stdfile.Hex(output)})
+		}
+		n := len(output) - gcmTagSize
+		return sf.WriteJSON(stdfile.Result{
+			"ciphertext": stdfile.Hex(output[:n]),
+			"tag":        stdfile.Hex(output[n:]),
+		})
+	}
+
+	return sf.Write(output, fOut)
 }
 
+// gcmTagSize is the size of the tag appended to the ciphertext.
+const gcmTagSize = 16
+
 func gcm(key, nonce, in, additionalData []byte, direction bool) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -108,5 +129,9 @@ func gcm(key, nonce, in, additionalData []byte, direction bool) ([]byte, error)
 	if direction {
 		return c.Seal(nil, nonce, in, additionalData), nil
 	}
-	return c.Open(nil, nonce, in, additionalData)
+	out, err := c.Open(nil, nonce, in, additionalData)
+	if err != nil {
+		return nil, util.VerificationFailed(err)
+	}
+	return out, nil
 }
@@ -32,6 +32,27 @@ func TestGcmCmd(t *testing.T) {
 			testGcm(t, tmp, "", tv.Key, tv.Nonce, tv.Aad, tv.Plaintext, expected)
 		})
 	}
+	t.Run("JSON", func(t *testing.T) {
+		tv := GCMTestVectors["key128/nonce96/without_aad"]
+		in := filepath.Join(tmp, "in")
+		out := filepath.Join(tmp, "out")
+		testutil.SetupInOut(t, in, out, tv.Plaintext)
+		args := []string{
+			"-key", hex.EncodeToString(tv.Key),
+			"-iv", hex.EncodeToString(tv.Nonce),
+			"-in", in,
+			"-out", out,
+		}
+		if err := testutil.RunCmdJSON(GcmCmd, args...); err != nil {
+			t.Fatal(err)
+		}
+
+		var result struct{ Ciphertext, Tag string }
+		testutil.ReadJSON(t, out, &result)
+		if result.Ciphertext != hex.EncodeToString(tv.Ciphertext) || result.Tag != hex.EncodeToString(tv.Tag) {
+			t.Fatalf("want %x %x, have %s %s", tv.Ciphertext, tv.Tag, result.Ciphertext, result.Tag)
+		}
+	})
 	t.Run("NoKey", func(t *testing.T) {
 		if err := testutil.RunCmd(GcmCmd); err == nil {
 			t.Fatal("expected and error")
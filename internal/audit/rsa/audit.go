@@ -0,0 +1,299 @@
+package rsa
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"math/big"
+)
+
+var bigOne = big.NewInt(1)
+
+// Options controls which checks are run by Audit and their parameters.
+type Options struct {
+	// MinBits is the minimum accepted size of the modulus
+	MinBits int
+	// MinExponent is the minimum accepted public exponent
+	MinExponent int
+	// FermatRounds is the number of iterations of Fermat's factorization, 0 disables it
+	FermatRounds int
+}
+
+var DefaultOptions = Options{
+	MinBits:      2048,
+	MinExponent:  65537,
+	FermatRounds: 10000,
+}
+
+// Finding describes one problem found for a key.
+type Finding struct {
+	Check   string
+	Message string
+	// Compromised is set when the private key can be recovered
+	Compromised bool
+}
+
+// Report contains the result of the audit for one key.
+type Report struct {
+	Key      *rsa.PublicKey
+	Findings []Finding
+	// Factors contains the primes of the modulus which were recovered, only
+	// one if the cofactor is not prime, e.g. 2 for an even modulus
+	Factors []*big.Int
+}
+
+// Compromised returns true if at least one finding leads to the private key.
+func (r Report) Compromised() bool {
+	for _, f := range r.Findings {
+		if f.Compromised {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) add(check string, compromised bool, format string, args ...any) {
+	r.Findings = append(r.Findings, Finding{
+		Check:       check,
+		Message:     fmt.Sprintf(format, args...),
+		Compromised: compromised,
+	})
+}
+
+// setFactors sets the factors to p and N/p, the ones which are prime.
+func (r *Report) setFactors(p *big.Int) {
+	if r.Factors != nil {
+		return
+	}
+	q := new(big.Int).Div(r.Key.N, p)
+	if p.Cmp(q) < 0 {
+		p, q = q, p
+	}
+	for _, f := range []*big.Int{p, q} {
+		if f.ProbablyPrime(20) {
+			r.Factors = append(r.Factors, f)
+		}
+	}
+}
+
+// Audit runs all the checks on the given keys.
+// The returned reports are in the same order as the keys.
+func Audit(keys []*rsa.PublicKey, opts Options) []Report {
+	reports := make([]Report, len(keys))
+	for i, key := range keys {
+		reports[i].Key = key
+	}
+
+	for i := range reports {
+		r := &reports[i]
+		key := r.Key
+
+		if bits := key.N.BitLen(); bits < opts.MinBits {
+			r.add("small-modulus", false, "modulus has %d bits, minimum is %d", bits, opts.MinBits)
+		}
+		switch {
+		case key.E < 3 || key.E%2 == 0:
+			r.add("invalid-exponent", false, "public exponent %d is not valid", key.E)
+		case key.E < opts.MinExponent:
+			r.add("small-exponent", false, "public exponent %d is smaller than %d", key.E, opts.MinExponent)
+		}
+
+		if key.N.Bit(0) == 0 {
+			r.add("even-modulus", true, "modulus is even")
+			r.setFactors(big.NewInt(2))
+		}
+
+		if opts.FermatRounds > 0 {
+			if p, ok := Fermat(key.N, opts.FermatRounds); ok {
+				r.add("fermat", true, "primes are too close, factored with Fermat's method")
+				r.setFactors(p)
+			}
+		}
+
+		if IsROCAVulnerable(key.N) {
+			r.add("roca", true, "modulus has the ROCA fingerprint(CVE-2017-15361), it can be factored with Coppersmith's method")
+		}
+	}
+
+	// identical moduli are the same key given more than once, not a shared
+	// prime, batch-GCD is run on the distinct moduli
+	var moduli []*big.Int
+	groups := make([][]int, 0, len(keys))
+	group := make([]int, len(keys))
+	seen := make(map[string]int)
+	for i, key := range keys {
+		g, ok := seen[string(key.N.Bytes())]
+		if !ok {
+			g = len(moduli)
+			seen[string(key.N.Bytes())] = g
+			moduli = append(moduli, key.N)
+			groups = append(groups, nil)
+		}
+		group[i] = g
+		groups[g] = append(groups[g], i)
+	}
+
+	for i := range reports {
+		var duplicates []int
+		for _, j := range groups[group[i]] {
+			if j != i {
+				duplicates = append(duplicates, j+1)
+			}
+		}
+		if len(duplicates) != 0 {
+			reports[i].add("duplicate-modulus", false, "same modulus as key(s) %v", duplicates)
+		}
+	}
+
+	gcds := BatchGCD(moduli)
+	for i := range reports {
+		if gcds[group[i]].Cmp(bigOne) == 0 {
+			continue
+		}
+		r := &reports[i]
+		n := r.Key.N
+		var shared []int
+		for j, key := range keys {
+			if group[j] == group[i] {
+				continue
+			}
+			d := new(big.Int).GCD(nil, nil, n, key.N)
+			if d.Cmp(bigOne) != 0 {
+				shared = append(shared, j+1)
+				r.setFactors(d)
+			}
+		}
+		if len(shared) != 0 {
+			r.add("batch-gcd", true, "shares a prime with key(s) %v", shared)
+		}
+	}
+
+	return reports
+}
+
+// BatchGCD computes, for every modulus, the gcd between it and the product of
+// all the other moduli, using the product and remainder trees described in
+// "Mining Your Ps and Qs"(Heninger et al.).
+func BatchGCD(moduli []*big.Int) []*big.Int {
+	result := make([]*big.Int, len(moduli))
+	if len(moduli) == 0 {
+		return result
+	}
+
+	// product tree, levels[0] are the moduli, last level is the product of all
+	levels := [][]*big.Int{moduli}
+	for len(levels[len(levels)-1]) > 1 {
+		prev := levels[len(levels)-1]
+		next := make([]*big.Int, 0, (len(prev)+1)/2)
+		for i := 0; i < len(prev); i += 2 {
+			if i+1 < len(prev) {
+				next = append(next, new(big.Int).Mul(prev[i], prev[i+1]))
+			} else {
+				next = append(next, prev[i])
+			}
+		}
+		levels = append(levels, next)
+	}
+
+	// remainder tree, going down: R = parent mod node^2
+	rems := levels[len(levels)-1]
+	for l := len(levels) - 2; l >= 0; l-- {
+		level := levels[l]
+		next := make([]*big.Int, len(level))
+		for i, v := range level {
+			sq := new(big.Int).Mul(v, v)
+			next[i] = new(big.Int).Mod(rems[i/2], sq)
+		}
+		rems = next
+	}
+
+	for i, n := range moduli {
+		if n.Sign() == 0 {
+			result[i] = new(big.Int).Set(bigOne)
+			continue
+		}
+		q := new(big.Int).Div(rems[i], n)
+		result[i] = new(big.Int).GCD(nil, nil, q, n)
+		if result[i].Sign() == 0 {
+			result[i].Set(n)
+		}
+	}
+
+	return result
+}
+
+// Fermat tries to factor n, by searching a and b such that n = a^2 - b^2,
+// starting with a = ceil(sqrt(n)). It succeeds quickly if |p - q| is small.
+// It returns the bigger factor.
+func Fermat(n *big.Int, rounds int) (*big.Int, bool) {
+	if n.Sign() <= 0 || n.Bit(0) == 0 {
+		return nil, false
+	}
+
+	a := new(big.Int).Sqrt(n)
+	if new(big.Int).Mul(a, a).Cmp(n) == 0 {
+		return a, a.Cmp(bigOne) != 0
+	}
+	a.Add(a, bigOne)
+
+	b2 := new(big.Int).Mul(a, a)
+	b2.Sub(b2, n)
+	b := new(big.Int)
+
+	for i := 0; i < rounds; i++ {
+		b.Sqrt(b2)
+		if new(big.Int).Mul(b, b).Cmp(b2) == 0 {
+			p := new(big.Int).Add(a, b)
+			q := new(big.Int).Sub(a, b)
+			if q.Cmp(bigOne) == 0 {
+				return nil, false
+			}
+			return p, true
+		}
+		// (a+1)^2 - n = a^2 - n + 2a + 1
+		b2.Add(b2, a)
+		b2.Add(b2, a)
+		b2.Add(b2, bigOne)
+		a.Add(a, bigOne)
+	}
+
+	return nil, false
+}
+
+// rocaPrimes are the small primes used by the ROCA fingerprint test
+// (Nemec et al., "The Return of Coppersmith's Attack").
+var rocaPrimes = []int64{
+	3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37, 41, 43, 47, 53, 59, 61, 67, 71,
+	73, 79, 83, 89, 97, 101, 103, 107, 109, 113, 127, 131, 137, 139, 149, 151,
+	157, 163, 167,
+}
+
+// rocaSubgroups[i][j] is true if j is in the multiplicative subgroup
+// generated by 65537 modulo rocaPrimes[i].
+var rocaSubgroups = func() [][]bool {
+	r := make([][]bool, len(rocaPrimes))
+	for i, p := range rocaPrimes {
+		r[i] = make([]bool, p)
+		g := int64(65537) % p
+		for v := g; !r[i][v]; v = v * g % p {
+			r[i][v] = true
+		}
+	}
+	return r
+}()
+
+// IsROCAVulnerable checks if n has the fingerprint of the moduli generated by
+// the vulnerable Infineon RSA library: n mod r is a power of 65537 for all the
+// primes r used by the library.
+func IsROCAVulnerable(n *big.Int) bool {
+	if n.Sign() <= 0 {
+		return false
+	}
+	m := new(big.Int)
+	for i, p := range rocaPrimes {
+		m.Mod(n, big.NewInt(p))
+		if !rocaSubgroups[i][m.Int64()] {
+			return false
+		}
+	}
+	return true
+}
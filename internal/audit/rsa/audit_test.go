@@ -0,0 +1,229 @@
+package rsa
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+)
+
+func randomPrime(t *testing.T, bits int) *big.Int {
+	t.Helper()
+	p, err := rand.Prime(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func nextPrime(n *big.Int) *big.Int {
+	p := new(big.Int).Add(n, bigOne)
+	for !p.ProbablyPrime(20) {
+		p.Add(p, bigOne)
+	}
+	return p
+}
+
+// rocaPrime generates a prime of the form k*M + 65537^a mod M, like the
+// vulnerable Infineon library.
+func rocaPrime(t *testing.T) *big.Int {
+	t.Helper()
+	m := big.NewInt(1)
+	for _, p := range rocaPrimes {
+		m.Mul(m, big.NewInt(p))
+	}
+	for {
+		a, err := rand.Int(rand.Reader, big.NewInt(1<<20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		k, err := rand.Int(rand.Reader, new(big.Int).Lsh(bigOne, 64))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := new(big.Int).Exp(big.NewInt(65537), a, m)
+		p.Add(p, k.Mul(k, m))
+		if p.ProbablyPrime(20) {
+			return p
+		}
+	}
+}
+
+func checks(r Report) map[string]bool {
+	m := make(map[string]bool)
+	for _, f := range r.Findings {
+		m[f.Check] = true
+	}
+	return m
+}
+
+func TestAudit(t *testing.T) {
+	shared := randomPrime(t, 512)
+	closeP := randomPrime(t, 512)
+	closeQ := nextPrime(closeP)
+
+	keys := []*rsa.PublicKey{
+		// 0: ok
+		{N: new(big.Int).Mul(randomPrime(t, 1024), randomPrime(t, 1024)), E: 65537},
+		// 1, 2: shared prime
+		{N: new(big.Int).Mul(shared, randomPrime(t, 512)), E: 65537},
+		{N: new(big.Int).Mul(shared, randomPrime(t, 512)), E: 65537},
+		// 3: close primes
+		{N: new(big.Int).Mul(closeP, closeQ), E: 3},
+		// 4: ROCA
+		{N: new(big.Int).Mul(rocaPrime(t), rocaPrime(t)), E: 65537},
+	}
+	// 5: duplicate of 0
+	keys = append(keys, &rsa.PublicKey{N: keys[0].N, E: 65537})
+
+	opts := DefaultOptions
+	opts.MinBits = 1024
+	reports := Audit(keys, opts)
+
+	if len(reports) != len(keys) {
+		t.Fatalf("expected %d reports, have %d", len(keys), len(reports))
+	}
+
+	expected := []struct {
+		checks      []string
+		compromised bool
+		factors     bool
+	}{
+		{[]string{"duplicate-modulus"}, false, false},
+		{[]string{"batch-gcd"}, true, true},
+		{[]string{"batch-gcd"}, true, true},
+		{[]string{"fermat", "small-exponent"}, true, true},
+		{[]string{"roca", "small-modulus"}, true, false},
+		{[]string{"duplicate-modulus"}, false, false},
+	}
+
+	for i, want := range expected {
+		r := reports[i]
+		have := checks(r)
+		if len(have) != len(want.checks) {
+			t.Fatalf("key %d: want %v, have %+v", i, want.checks, r.Findings)
+		}
+		for _, c := range want.checks {
+			if !have[c] {
+				t.Fatalf("key %d: missing %s, have %+v", i, c, r.Findings)
+			}
+		}
+		if r.Compromised() != want.compromised {
+			t.Fatalf("key %d: want compromised=%v", i, want.compromised)
+		}
+		if (r.Factors != nil) != want.factors {
+			t.Fatalf("key %d: want factors=%v", i, want.factors)
+		}
+		if r.Factors != nil {
+			if len(r.Factors) != 2 || new(big.Int).Mul(r.Factors[0], r.Factors[1]).Cmp(r.Key.N) != 0 {
+				t.Fatalf("key %d: factors are not correct", i)
+			}
+		}
+	}
+
+	if reports[1].Factors[1].Cmp(shared) != 0 && reports[1].Factors[0].Cmp(shared) != 0 {
+		t.Fatal("shared prime not recovered")
+	}
+}
+
+func TestAuditEvenModulus(t *testing.T) {
+	p := randomPrime(t, 512)
+	q := randomPrime(t, 512)
+
+	// N/2 is not prime, only 2 is a recovered prime
+	n := new(big.Int).Mul(p, q)
+	n.Lsh(n, 1)
+	r := Audit([]*rsa.PublicKey{{N: n, E: 65537}}, DefaultOptions)[0]
+	if !checks(r)["even-modulus"] || !r.Compromised() {
+		t.Fatalf("unexpected findings %+v", r.Findings)
+	}
+	if len(r.Factors) != 1 || r.Factors[0].Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("unexpected factors %v", r.Factors)
+	}
+
+	// N/2 is prime
+	n = new(big.Int).Lsh(p, 1)
+	r = Audit([]*rsa.PublicKey{{N: n, E: 65537}}, DefaultOptions)[0]
+	if len(r.Factors) != 2 || r.Factors[0].Cmp(p) != 0 || r.Factors[1].Cmp(big.NewInt(2)) != 0 {
+		t.Fatalf("unexpected factors %v", r.Factors)
+	}
+}
+
+func TestAuditInvalidExponent(t *testing.T) {
+	key := &rsa.PublicKey{N: new(big.Int).Mul(randomPrime(t, 512), randomPrime(t, 512)), E: 65536}
+	r := Audit([]*rsa.PublicKey{key}, DefaultOptions)[0]
+	have := checks(r)
+	if !have["invalid-exponent"] || !have["small-modulus"] || r.Compromised() {
+		t.Fatalf("unexpected findings: %+v", r.Findings)
+	}
+}
+
+func TestBatchGCD(t *testing.T) {
+	if r := BatchGCD(nil); len(r) != 0 {
+		t.Fatal("expected empty result")
+	}
+
+	moduli := []*big.Int{
+		big.NewInt(3 * 5),
+		big.NewInt(7 * 11),
+		big.NewInt(13 * 3),
+		big.NewInt(17 * 19),
+		big.NewInt(23 * 29),
+	}
+	want := []int64{3, 1, 3, 1, 1}
+	for i, g := range BatchGCD(moduli) {
+		if g.Int64() != want[i] {
+			t.Fatalf("%d: want %d, have %d", i, want[i], g)
+		}
+	}
+}
+
+func TestFermat(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		for _, n := range []int64{0, 4, 1} {
+			if _, ok := Fermat(big.NewInt(n), 10); ok {
+				t.Fatalf("%d: expected failure", n)
+			}
+		}
+	})
+
+	t.Run("FarPrimes", func(t *testing.T) {
+		n := new(big.Int).Mul(randomPrime(t, 256), randomPrime(t, 768))
+		if _, ok := Fermat(n, 1000); ok {
+			t.Fatal("expected failure")
+		}
+	})
+
+	t.Run("Square", func(t *testing.T) {
+		p := randomPrime(t, 256)
+		have, ok := Fermat(new(big.Int).Mul(p, p), 1)
+		if !ok || have.Cmp(p) != 0 {
+			t.Fatal("expected p")
+		}
+	})
+
+	t.Run("ClosePrimes", func(t *testing.T) {
+		p := randomPrime(t, 512)
+		q := nextPrime(nextPrime(p))
+		have, ok := Fermat(new(big.Int).Mul(p, q), 1000)
+		if !ok || have.Cmp(q) != 0 {
+			t.Fatal("expected q")
+		}
+	})
+}
+
+func TestIsROCAVulnerable(t *testing.T) {
+	if IsROCAVulnerable(big.NewInt(0)) {
+		t.Fatal("0 is not vulnerable")
+	}
+	for i := 0; i < 5; i++ {
+		n := new(big.Int).Mul(randomPrime(t, 512), randomPrime(t, 512))
+		if IsROCAVulnerable(n) {
+			t.Fatal("random modulus is not expected to be vulnerable")
+		}
+	}
+	n := new(big.Int).Mul(rocaPrime(t), rocaPrime(t))
+	if !IsROCAVulnerable(n) {
+		t.Fatal("expected vulnerable modulus")
+	}
+}
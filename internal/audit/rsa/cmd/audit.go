@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+
+	auditrsa "bandr.me/p/pocryp/internal/audit/rsa"
+	rsautil "bandr.me/p/pocryp/internal/encoding/rsa/util"
+)
+
+var Cmd = &cmd.Command{
+	Name:  "rsa-audit",
+	Run:   run,
+	Brief: "Audit RSA public keys for known weaknesses",
+
+	Usage: `Usage: pocryp rsa-audit [-min-bits N] [-min-exp N] [-fermat-rounds N] [-out OUTPUT] KEY...
+
+Audit the given RSA keys for known weaknesses:
+  - batch-gcd: two or more keys share a prime, all of them can be factored
+  - duplicate-modulus: the same modulus was given more than once, it is
+    reported(DUPLICATE) but not compromised
+  - fermat: the primes are too close and the modulus is factored with Fermat's method
+  - roca: the modulus has the fingerprint of the Infineon ROCA vulnerability(CVE-2017-15361)
+  - small-modulus: the modulus is smaller than -min-bits
+  - small-exponent: the public exponent is smaller than -min-exp
+
+Keys can be given as PEM or DER, encoded as PKCS#1, PKCS#8 or PKIX.
+For private keys only the public part is used.
+
+The report lists every key and its findings.
+If a key is compromised and prime factors were recovered, they are printed as
+hex. Only the factor 2 is printed for an even modulus, unless N/2 is prime.
+If at least one key is compromised, an error is returned.
+
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func run(cmd *cmd.Command) error {
+	fOutput := cmd.Flags.String("out", "", "Write the report to the file at path OUTPUT.")
+	fOpts := stdfile.OptionsFlags(cmd.Flags)
+	fMinBits := cmd.Flags.Int("min-bits", auditrsa.DefaultOptions.MinBits, "Minimum accepted size of the modulus.")
+	fMinExp := cmd.Flags.Int("min-exp", auditrsa.DefaultOptions.MinExponent, "Minimum accepted public exponent.")
+	fFermatRounds := cmd.Flags.Int(
+		"fermat-rounds",
+		auditrsa.DefaultOptions.FermatRounds,
+		"Number of iterations for Fermat's factorization, 0 disables it.",
+	)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if cmd.Flags.NArg() == 0 {
+		cmd.Flags.Usage()
+		return errors.New("no keys specified")
+	}
+
+	var keys []*rsa.PublicKey
+	for _, file := range cmd.Flags.Args() {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		key, err := rsautil.ParseKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			keys = append(keys, &k.PublicKey)
+		case *rsa.PublicKey:
+			keys = append(keys, k)
+		}
+	}
+
+	sf, err := stdfile.New("", *fOutput, *fOpts)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	opts := auditrsa.Options{
+		MinBits:      *fMinBits,
+		MinExponent:  *fMinExp,
+		FermatRounds: *fFermatRounds,
+	}
+
+	reports := auditrsa.Audit(keys, opts)
+
+	type jsonFinding struct {
+		Check       string `json:"check"`
+		Message     string `json:"message"`
+		Compromised bool   `json:"compromised"`
+	}
+	type jsonReport struct {
+		File     string        `json:"file"`
+		Bits     int           `json:"bits"`
+		E        int           `json:"e"`
+		Status   string        `json:"status"`
+		Findings []jsonFinding `json:"findings"`
+		Factors  []stdfile.Hex `json:"factors,omitempty"`
+	}
+	var jsonReports []jsonReport
+
+	compromised := 0
+	for i, r := range reports {
+		status := "OK"
+		switch {
+		case r.Compromised():
+			status = "COMPROMISED"
+			compromised++
+		case onlyDuplicate(r):
+			status = "DUPLICATE"
+		case len(r.Findings) != 0:
+			status = "WEAK"
+		}
+		if cmd.JSON {
+			jr := jsonReport{
+				File:     cmd.Flags.Arg(i),
+				Bits:     r.Key.N.BitLen(),
+				E:        r.Key.E,
+				Status:   status,
+				Findings: []jsonFinding{},
+			}
+			for _, f := range r.Findings {
+				jr.Findings = append(jr.Findings, jsonFinding{f.Check, f.Message, f.Compromised})
+			}
+			for _, factor := range r.Factors {
+				jr.Factors = append(jr.Factors, factor.Bytes())
+			}
+			jsonReports = append(jsonReports, jr)
+			continue
+		}
+		fmt.Fprintf(
+			sf.Out, "key %d: %s: %d bits, e=%d: %s\n",
+			i+1, cmd.Flags.Arg(i), r.Key.N.BitLen(), r.Key.E, status,
+		)
+		for _, f := range r.Findings {
+			fmt.Fprintf(sf.Out, "  %s: %s\n", f.Check, f.Message)
+		}
+		for j, factor := range r.Factors {
+			fmt.Fprintf(sf.Out, "  factor %d: %s\n", j+1, hex.EncodeToString(factor.Bytes()))
+		}
+	}
+
+	// the report is written even if keys are compromised
+	if cmd.JSON {
+		err = sf.WriteJSON(stdfile.Result{"keys": jsonReports, "compromised": compromised})
+	} else {
+		err = sf.Commit()
+	}
+	if err != nil {
+		return err
+	}
+
+	if compromised != 0 {
+		return util.VerificationFailed(fmt.Errorf("%d of %d keys are compromised", compromised, len(reports)))
+	}
+
+	return nil
+}
+
+// onlyDuplicate returns true if the only finding of r is a duplicate modulus.
+func onlyDuplicate(r auditrsa.Report) bool {
+	return len(r.Findings) == 1 && r.Findings[0].Check == "duplicate-modulus"
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestCmd(t *testing.T) {
+	tmp := t.TempDir()
+	out := filepath.Join(tmp, "out")
+
+	writeKey := func(name string, key *rsa.PublicKey) string {
+		path := filepath.Join(tmp, name)
+		block := &pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(key)}
+		testutil.SetupIn(t, path, pem.EncodeToMemory(block))
+		return path
+	}
+
+	prime := func() *big.Int {
+		p, err := rand.Prime(rand.Reader, 512)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	shared := prime()
+	good := writeKey("good", &rsa.PublicKey{N: new(big.Int).Mul(prime(), prime()), E: 65537})
+	bad1 := writeKey("bad1", &rsa.PublicKey{N: new(big.Int).Mul(shared, prime()), E: 65537})
+	bad2 := writeKey("bad2", &rsa.PublicKey{N: new(big.Int).Mul(shared, prime()), E: 65537})
+
+	t.Run("NoKeys", func(t *testing.T) {
+		if err := testutil.RunCmd(Cmd); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("NotAKey", func(t *testing.T) {
+		if err := testutil.RunCmd(Cmd, out); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		if err := testutil.RunCmd(Cmd, "-min-bits", "1024", "-out", out, good); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Duplicate", func(t *testing.T) {
+		if err := testutil.RunCmd(Cmd, "-min-bits", "1024", "-force", "-out", out, good, good); err != nil {
+			t.Fatal(err)
+		}
+		report, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := string(report); strings.Count(s, ": DUPLICATE") != 2 || strings.Contains(s, "COMPROMISED") {
+			t.Fatalf("unexpected report:\n%s", s)
+		}
+	})
+
+	t.Run("Compromised", func(t *testing.T) {
+		if err := testutil.RunCmd(Cmd, "-min-bits", "1024", "-force", "-out", out, good, bad1, bad2); err == nil {
+			t.Fatal("expected error")
+		}
+		report, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(report)
+		if strings.Count(s, "COMPROMISED") != 2 || strings.Count(s, ": OK") != 1 {
+			t.Fatalf("unexpected report:\n%s", s)
+		}
+		if !strings.Contains(s, shared.Text(16)) {
+			t.Fatalf("shared prime not in report:\n%s", s)
+		}
+	})
+}
@@ -4,17 +4,25 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"runtime/debug"
 	"strings"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
 type App struct {
 	categories []category
 
+	// the command tree, the commands of categories are not part of it
+	groups []*Group
+
 	printVersion bool
+	json         bool
 }
 
 type category struct {
@@ -42,11 +50,19 @@ func printAppVersion() {
 	)
 }
 
-func (a *App) Run(args ...string) error {
+// flagSet returns the global flags, given before the command.
+func (a *App) flagSet() *flag.FlagSet {
 	fset := flag.NewFlagSet("pocryp", flag.ExitOnError)
 	fset.SetOutput(os.Stdout)
 	fset.Usage = a.Usage
-	fset.BoolVar(&a.printVersion, "version", false, "")
+	fset.BoolVar(&a.printVersion, "version", false, "Print version information")
+	fset.BoolVar(&secret.Mlock, "mlock", false, "Lock keys in memory, so they are not swapped to disk")
+	fset.BoolVar(&a.json, "json", false, "Write the result of the command as a JSON object")
+	return fset
+}
+
+func (a *App) Run(args ...string) error {
+	fset := a.flagSet()
 	if err := fset.Parse(args); err != nil {
 		if !errors.Is(err, flag.ErrHelp) {
 			return err
@@ -66,19 +82,106 @@ func (a *App) Run(args ...string) error {
 		return nil
 	}
 
-	name := args[0]
-	args = args[1:]
+	return a.dispatch(args[0], args[1:])
+}
+
+// dispatch runs the group, command or plugin with the given name.
+func (a *App) dispatch(name string, args []string) error {
+	for _, g := range a.groups {
+		if g.Name == name {
+			return g.run("pocryp "+name, args, a.json)
+		}
+	}
 
 	for _, category := range a.categories {
 		for _, cmd := range category.commands {
 			if cmd.Name == name {
-				cmd.Args = args
-				return cmd.Run(cmd)
+				cmd.JSON = a.json
+				return cmd.Execute(args)
 			}
 		}
 	}
 
-	return fmt.Errorf("unknown command '%s'", name)
+	if p, ok := lookupPlugin(name); ok {
+		return p.run(args, a.json, secret.Mlock)
+	}
+
+	return cmd.WithCategory(cmd.CategoryUsage, fmt.Errorf("unknown command '%s'", name))
+}
+
+// hasName returns true if name is the name of a group or a command.
+func (a *App) hasName(name string) bool {
+	for _, g := range a.groups {
+		if g.Name == name {
+			return true
+		}
+	}
+	for _, c := range a.categories {
+		if c.hasCmd(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// plugins returns the plugins found in PATH, without the ones which have
+// the name of a group or a command.
+func (a *App) plugins() []plugin {
+	var r []plugin
+	for _, p := range findPlugins() {
+		if !a.hasName(p.name) {
+			r = append(r, p)
+		}
+	}
+	return r
+}
+
+// ExitCode returns the exit status for err, see the usage of the app.
+func ExitCode(err error) int {
+	var pluginErr *PluginExitError
+	if errors.As(err, &pluginErr) {
+		return pluginErr.Code
+	}
+	return cmd.CategoryOf(err).ExitCode()
+}
+
+// PrintError writes err to w, as a JSON object with its category as code
+// if -json was given, else as text. The errors of plugins are not written,
+// they were reported by the plugins.
+func (a *App) PrintError(w io.Writer, err error) {
+	var pluginErr *PluginExitError
+	if errors.As(err, &pluginErr) {
+		return
+	}
+	if !a.json {
+		fmt.Fprintln(w, "error:", err)
+		return
+	}
+	type jsonError struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	}
+	stdfile.WriteJSON(w, struct {
+		Error jsonError `json:"error"`
+	}{jsonError{cmd.CategoryOf(err).String(), err.Error()}})
+}
+
+// Group returns the top level group with the given name, it is added if it
+// does not exist. Its name must not be the name of a command.
+func (a *App) Group(name, brief string) *Group {
+	for _, g := range a.groups {
+		if g.Name == name {
+			return g
+		}
+	}
+	for _, c := range a.categories {
+		if err := c.hasCmd(name); err != nil {
+			panic(fmt.Sprintf("group '%s' has the name of a command", name))
+		}
+	}
+	g := &Group{Name: name, Brief: brief}
+	a.groups = append(a.groups, g)
+	return g
 }
 
 func (a *App) Add(categoryName string, cmds ...*cmd.Command) {
@@ -97,6 +200,11 @@ func (a *App) Add(categoryName string, cmds ...*cmd.Command) {
 		if err := cat.hasCmd(cmd.Name); err != nil {
 			panic(err.Error())
 		}
+		for _, g := range a.groups {
+			if g.Name == cmd.Name {
+				panic(fmt.Sprintf("command '%s' has the name of a group", cmd.Name))
+			}
+		}
 		cmd.Init()
 	}
 	cat.commands = append(cat.commands, cmds...)
@@ -127,15 +235,32 @@ func (a App) maxCommandName(category string) int {
 }
 
 func (a App) Usage() {
-	fmt.Print(`Usage: pocryp command [ARGS]
+	fmt.Print(`Usage: pocryp [FLAGS] command [ARGS]
+       pocryp [FLAGS] group... command [ARGS]
 
 Flags:
   -h, --help  Print this message
   --version   Print version information
-
-Commands(by category):
+  --mlock     Lock keys in memory, so they are not swapped to disk
+  --json      Write the result of the command as a JSON object,
+              errors are written to stderr as {"error":{"code","message"}}
 
 `)
+	if len(a.groups) != 0 {
+		fmt.Print("Groups:\n")
+		mlen := 0
+		for _, g := range a.groups {
+			if len(g.Name) > mlen {
+				mlen = len(g.Name)
+			}
+		}
+		for _, g := range a.groups {
+			padding := strings.Repeat(" ", mlen-len(g.Name))
+			fmt.Printf("  %s%s  %s\n", g.Name, padding, g.Brief)
+		}
+		fmt.Print("\nRun 'pocryp group -h' to list the commands of a group.\n\n")
+	}
+	fmt.Print("Commands(by category):\n\n")
 	for _, v := range a.categories {
 		fmt.Printf("%s:\n", v.name)
 		mlen := a.maxCommandName(v.name)
@@ -145,5 +270,31 @@ Commands(by category):
 		}
 		fmt.Print("\n")
 	}
+	if plugins := a.plugins(); len(plugins) != 0 {
+		fmt.Print("Plugins:\n")
+		mlen := 0
+		for _, p := range plugins {
+			if len(p.name) > mlen {
+				mlen = len(p.name)
+			}
+		}
+		for _, p := range plugins {
+			padding := strings.Repeat(" ", mlen-len(p.name))
+			fmt.Printf("  %s%s  %s\n", p.name, padding, p.brief())
+		}
+		fmt.Print("\n")
+	}
+	fmt.Printf("Secrets:\n%s\n%s\n", util.SourceHelp, util.KeyRefHelp)
+	fmt.Print(`Exit status:
+  0  success
+  1  error: any other error
+  2  usage: invalid flags or arguments
+  3  io: a file cannot be read or written
+  4  invalid-input: malformed data, key or parameter
+  5  verification-failed: a MAC, signature, tag or key check did not pass
+  6  crypto-failure: a cryptographic operation or the key backend failed
+With --json, the error code is the name of the category.
+
+`)
 	fmt.Print("Run 'pocryp command -h' for more information about a command.\n")
 }
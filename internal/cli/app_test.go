@@ -1,9 +1,15 @@
 package cli
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
 	"testing"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/util"
 )
 
 func TestApp(t *testing.T) {
@@ -46,3 +52,94 @@ func TestApp(t *testing.T) {
 
 	app.Usage()
 }
+
+func TestExitCode(t *testing.T) {
+	var app App
+	if code := ExitCode(app.Run("nothing")); code != 2 {
+		t.Fatalf("unknown command: want exit code 2, have %d", code)
+	}
+	if code := ExitCode(fmt.Errorf("%w: foo", util.ErrNotValid)); code != 5 {
+		t.Fatalf("not valid: want exit code 5, have %d", code)
+	}
+	if code := ExitCode(errors.New("foo")); code != 1 {
+		t.Fatalf("want exit code 1, have %d", code)
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	var app App
+	err := app.Run("-json", "nothing")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	var b bytes.Buffer
+	app.PrintError(&b, err)
+
+	var have struct {
+		Error struct {
+			Code    string
+			Message string
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &have); err != nil {
+		t.Fatal(err)
+	}
+	if have.Error.Code != "usage" || have.Error.Message != err.Error() {
+		t.Fatalf("unexpected error object: %s", b.String())
+	}
+
+	b.Reset()
+	app.json = false
+	app.PrintError(&b, err)
+	if b.String() != "error: "+err.Error()+"\n" {
+		t.Fatalf("unexpected error: %s", b.String())
+	}
+}
+
+func TestGroup(t *testing.T) {
+	var app App
+	var args []string
+	app.Add("foo", &cmd.Command{
+		Name:  "bar",
+		Brief: "bar",
+		Usage: "bar",
+		Run: func(c *cmd.Command) error {
+			args = c.Args
+			return nil
+		},
+	})
+	app.Group("fizz", "fizz").Group("buzz", "buzz").Add(
+		cmd.Alias("baz", "baz", app.categories[0].commands[0], "-x"),
+	)
+
+	if err := app.Run("fizz", "buzz", "baz", "y"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, " ") != "-x y" {
+		t.Fatalf("unexpected args %v", args)
+	}
+
+	for _, v := range [][]string{{"fizz"}, {"fizz", "-h"}, {"fizz", "buzz", "--help"}} {
+		if err := app.Run(v...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := app.Run("fizz", "nothing")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if code := ExitCode(err); code != 2 {
+		t.Fatalf("unknown command: want exit code 2, have %d", code)
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		app.Group("bar", "bar")
+	})
+}
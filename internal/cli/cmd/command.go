@@ -4,6 +4,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -15,11 +16,83 @@ type Command struct {
 
 	Args  []string
 	Flags *flag.FlagSet
+
+	// set by the global -json flag, Run writes a JSON object instead of
+	// its usual output and the usage is printed only for -h
+	JSON bool
+
+	// set when Flags.Usage is called
+	usageShown bool
+
+	// set by DefinedFlags, nothing is printed
+	quiet bool
+
+	// set by Alias, the command which is run
+	target *Command
+}
+
+// Alias returns a command named name which runs c with args given before
+// its own, e.g. encrypt for 'aes-gcm -e'. The usage is the one of c.
+func Alias(name, brief string, c *Command, args ...string) *Command {
+	return &Command{
+		Name:   name,
+		Brief:  brief,
+		Usage:  c.Usage,
+		target: c,
+		Run: func(a *Command) error {
+			c.JSON = a.JSON
+			return c.Execute(append(args[:len(args):len(args)], a.Args...))
+		},
+	}
+}
+
+// DefinedFlags returns the flags defined by Run, which is called with -h
+// without printing the usage, or the flags of the aliased command. Flags is
+// left unchanged.
+func (c *Command) DefinedFlags() *flag.FlagSet {
+	if c.target != nil {
+		return c.target.DefinedFlags()
+	}
+	prev := c.Flags
+	c.Init()
+	c.quiet = true
+	c.Args = []string{"-h"}
+	// the error is flag.ErrHelp, which Run ignores
+	_ = c.Run(c)
+	fs := c.Flags
+	c.Flags = prev
+	c.quiet = false
+	return fs
+}
+
+// Execute runs the command with args, on new Flags so it can be run more
+// than once. An error returned after the usage was shown(e.g. for a missing
+// argument) is a usage error, unless it has another category.
+func (c *Command) Execute(args []string) error {
+	c.Init()
+	c.Args = args
+	c.usageShown = false
+	err := c.Run(c)
+	var e *Error
+	if err != nil && c.usageShown && !errors.As(err, &e) {
+		err = WithCategory(CategoryUsage, err)
+	}
+	return err
 }
 
 func (c *Command) Parse() (help bool, err error) {
+	if c.JSON || c.quiet {
+		c.Flags.SetOutput(io.Discard)
+	}
 	err = c.Flags.Parse(c.Args)
-	return errors.Is(err, flag.ErrHelp), err
+	help = errors.Is(err, flag.ErrHelp)
+	if help && c.JSON && !c.quiet {
+		c.printUsage()
+	}
+	if err != nil && !help {
+		err = WithCategory(CategoryUsage, err)
+	}
+	return help, err
 }
 
 func (c *Command) Init() {
@@ -40,16 +113,24 @@ func (c *Command) Init() {
 	c.Flags.SetOutput(os.Stdout)
 
 	c.Flags.Usage = func() {
-		nFlags := 0
-		c.Flags.VisitAll(func(f *flag.Flag) { nFlags++ })
+		c.usageShown = true
+		if !c.JSON && !c.quiet {
+			c.printUsage()
+		}
+	}
+}
 
-		fmt.Print(c.Usage)
-		fmt.Println("")
+func (c *Command) printUsage() {
+	nFlags := 0
+	c.Flags.VisitAll(func(f *flag.Flag) { nFlags++ })
 
-		if nFlags != 0 {
-			fmt.Println("Options:")
-			c.Flags.PrintDefaults()
-			fmt.Println("")
-		}
+	fmt.Print(c.Usage)
+	fmt.Println("")
+
+	if nFlags != 0 {
+		fmt.Println("Options:")
+		c.Flags.SetOutput(os.Stdout)
+		c.Flags.PrintDefaults()
+		fmt.Println("")
 	}
 }
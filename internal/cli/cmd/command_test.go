@@ -38,6 +38,27 @@ func TestParse(t *testing.T) {
 		}
 	})
 
+	t.Run("UsageError", func(t *testing.T) {
+		c.Args = []string{"-foo"}
+		_, err := c.Parse()
+		if CategoryOf(err) != CategoryUsage {
+			t.Fatal("expected usage error, have", err)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		c.JSON = true
+		defer func() { c.JSON = false }()
+		c.Args = []string{"-foo"}
+		if isHelp, err := c.Parse(); err == nil || isHelp {
+			t.Fatal("expected error")
+		}
+		c.Args = []string{"-h"}
+		if isHelp, _ := c.Parse(); !isHelp {
+			t.Fatal("expected help")
+		}
+	})
+
 	t.Run("Ok", func(t *testing.T) {
 		c.Args = []string{"foo", "bar"}
 		isHelp, err := c.Parse()
@@ -109,6 +130,55 @@ func TestInit(t *testing.T) {
 	})
 }
 
+func TestDefinedFlags(t *testing.T) {
+	c := Command{
+		Name:  "foo",
+		Usage: "bar",
+		Brief: "baz",
+		Run: func(c *Command) error {
+			c.Flags.String("a", "", "the a flag")
+			c.Flags.Bool("b", false, "the b flag")
+			_, err := c.Parse()
+			return err
+		},
+	}
+	fs := c.DefinedFlags()
+	if fs.Lookup("a") == nil || fs.Lookup("b") == nil {
+		t.Fatal("flags not defined")
+	}
+	if c.Flags != nil {
+		t.Fatal("Flags changed")
+	}
+}
+
+func TestAlias(t *testing.T) {
+	var args []string
+	c := &Command{
+		Name:  "foo",
+		Usage: "bar",
+		Brief: "baz",
+		Run: func(c *Command) error {
+			c.Flags.Bool("e", false, "the e flag")
+			if _, err := c.Parse(); err != nil {
+				return err
+			}
+			args = c.Flags.Args()
+			return nil
+		},
+	}
+	a := Alias("encrypt", "encrypt", c, "-e")
+	a.Init()
+	if err := a.Execute([]string{"x"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[0] != "x" {
+		t.Fatalf("unexpected args %v", args)
+	}
+	if a.DefinedFlags().Lookup("e") == nil {
+		t.Fatal("flags of the aliased command not returned")
+	}
+}
+
 func expectPanic(t *testing.T, msg string) {
 	t.Helper()
 	r := recover()
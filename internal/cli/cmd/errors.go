@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// Category classifies the errors returned by the commands,
+// every category has its own exit code.
+type Category int
+
+const (
+	// errors which don't fit in another category
+	CategoryFailure Category = iota
+	// invalid flags or arguments
+	CategoryUsage
+	// a file cannot be read or written
+	CategoryIO
+	// malformed data, key or parameter
+	CategoryInvalidInput
+	// a MAC, signature, tag or key check did not pass
+	CategoryVerificationFailed
+	// a cryptographic operation or the key backend failed
+	CategoryCryptoFailure
+)
+
+var categoryNames = [...]string{
+	CategoryFailure:            "error",
+	CategoryUsage:              "usage",
+	CategoryIO:                 "io",
+	CategoryInvalidInput:       "invalid-input",
+	CategoryVerificationFailed: "verification-failed",
+	CategoryCryptoFailure:      "crypto-failure",
+}
+
+// String returns the name of the category, used as error code.
+func (c Category) String() string {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return categoryNames[CategoryFailure]
+	}
+	return categoryNames[c]
+}
+
+// ExitCode returns the exit status of the process for an error of category c.
+func (c Category) ExitCode() int {
+	if c < 0 || int(c) >= len(categoryNames) {
+		return 1
+	}
+	return int(c) + 1
+}
+
+// Error is an error of a known category.
+type Error struct {
+	Category Category
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCategory returns err as an error of category c, nil if err is nil.
+func WithCategory(c Category, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Category: c, Err: err}
+}
+
+// CategoryOf returns the category given to err with WithCategory or,
+// if there is none, the category derived from the type of err.
+func CategoryOf(err error) Category {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Category
+	}
+
+	var (
+		pathErr    *fs.PathError
+		linkErr    *os.LinkError
+		syscallErr *os.SyscallError
+	)
+	if errors.As(err, &pathErr) || errors.As(err, &linkErr) || errors.As(err, &syscallErr) {
+		return CategoryIO
+	}
+
+	var (
+		hexErr        hex.InvalidByteError
+		base64Err     base64.CorruptInputError
+		jsonErr       *json.SyntaxError
+		jsonTypeErr   *json.UnmarshalTypeError
+		numErr        *strconv.NumError
+		asn1Err       asn1.StructuralError
+		asn1SyntaxErr asn1.SyntaxError
+		keySizeErr    aes.KeySizeError
+	)
+	switch {
+	case errors.As(err, &hexErr), errors.Is(err, hex.ErrLength),
+		errors.As(err, &base64Err),
+		errors.As(err, &jsonErr), errors.As(err, &jsonTypeErr),
+		errors.As(err, &numErr),
+		errors.As(err, &asn1Err), errors.As(err, &asn1SyntaxErr),
+		errors.As(err, &keySizeErr),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, rsa.ErrMessageTooLong):
+		return CategoryInvalidInput
+	case errors.Is(err, rsa.ErrVerification):
+		return CategoryVerificationFailed
+	case errors.Is(err, rsa.ErrDecryption):
+		return CategoryCryptoFailure
+	}
+
+	return CategoryFailure
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestCategoryOf(t *testing.T) {
+	_, openErr := os.Open("does-not-exist")
+	_, hexErr := hex.DecodeString("0g")
+	_, numErr := strconv.Atoi("x")
+	_, keyErr := aes.NewCipher(nil)
+
+	tests := []struct {
+		err  error
+		want Category
+	}{
+		{errors.New("foo"), CategoryFailure},
+		{WithCategory(CategoryCryptoFailure, errors.New("foo")), CategoryCryptoFailure},
+		{fmt.Errorf("key: %w", WithCategory(CategoryUsage, openErr)), CategoryUsage},
+		{fmt.Errorf("key: %w", openErr), CategoryIO},
+		{hexErr, CategoryInvalidInput},
+		{numErr, CategoryInvalidInput},
+		{keyErr, CategoryInvalidInput},
+		{rsa.ErrVerification, CategoryVerificationFailed},
+		{rsa.ErrDecryption, CategoryCryptoFailure},
+	}
+	for _, tt := range tests {
+		if have := CategoryOf(tt.err); have != tt.want {
+			t.Errorf("%v: want %s, have %s", tt.err, tt.want, have)
+		}
+	}
+
+	if WithCategory(CategoryIO, nil) != nil {
+		t.Fatal("expected nil")
+	}
+}
+
+func TestCategory(t *testing.T) {
+	codes := map[int]bool{}
+	for c := CategoryFailure; c <= CategoryCryptoFailure; c++ {
+		code := c.ExitCode()
+		if code == 0 || codes[code] {
+			t.Fatalf("%s: exit code %d is not unique", c, code)
+		}
+		codes[code] = true
+	}
+	if c := Category(100); c.String() != "error" || c.ExitCode() != 1 {
+		t.Fatal("expected the failure category for an unknown category")
+	}
+}
+
+func TestExecute(t *testing.T) {
+	c := Command{
+		Name:  "foo",
+		Usage: "bar",
+		Brief: "baz",
+		Run: func(c *Command) error {
+			if _, err := c.Parse(); err != nil {
+				return err
+			}
+			if c.Flags.NArg() == 0 {
+				c.Flags.Usage()
+				return errors.New("missing argument")
+			}
+			return WithCategory(CategoryIO, errors.New("io"))
+		},
+	}
+	c.Init()
+	c.JSON = true
+
+	if err := c.Execute(nil); CategoryOf(err) != CategoryUsage {
+		t.Fatal("expected usage error, have", err)
+	}
+	if err := c.Execute([]string{"arg"}); CategoryOf(err) != CategoryIO {
+		t.Fatal("expected io error, have", err)
+	}
+}
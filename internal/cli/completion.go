@@ -0,0 +1,444 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/common"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+// CompletionCmd returns the command which prints the completion script of
+// a shell for the commands of a, it is added to a like the other commands.
+func (a *App) CompletionCmd() *cmd.Command {
+	return &cmd.Command{
+		Name:  "completion",
+		Run:   a.runCompletion,
+		Brief: "Generate the shell completion script",
+
+		Usage: `Usage: pocryp completion bash|zsh|fish
+
+Print the completion script of the given shell, it completes the commands,
+their flags, the hash algorithms and formats and the file paths, e.g.:
+  bash: source <(pocryp completion bash)
+  zsh:  pocryp completion zsh > "${fpath[1]}/_pocryp"
+  fish: pocryp completion fish > ~/.config/fish/completions/pocryp.fish
+`,
+	}
+}
+
+// completionShells contains the script generator of every supported shell.
+var completionShells = map[string]func(*strings.Builder, []completionFlag, []completionGroup, []completionCommand){
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+func (a *App) runCompletion(c *cmd.Command) error {
+	if isHelp, err := c.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if c.Flags.NArg() != 1 {
+		c.Flags.Usage()
+		return errors.New("shell not specified")
+	}
+	shell := c.Flags.Arg(0)
+	gen, ok := completionShells[shell]
+	if !ok {
+		c.Flags.Usage()
+		return fmt.Errorf("unknown shell %q", shell)
+	}
+
+	var b strings.Builder
+	groups, commands := a.completionTree()
+	gen(&b, completionFlags(a.flagSet()), groups, commands)
+
+	if c.JSON {
+		return stdfile.WriteJSON(os.Stdout, stdfile.Result{"shell": shell, "script": b.String()})
+	}
+	_, err := fmt.Print(b.String())
+	return err
+}
+
+// completionFlag is a flag and how its value is completed.
+type completionFlag struct {
+	name  string
+	usage string
+
+	// the flag has no value
+	isBool bool
+	// the value is a path
+	file bool
+	// the valid values, if known
+	values []string
+}
+
+// completionCommand is a command, name is its path in the command tree,
+// e.g. 'aes gcm encrypt'.
+type completionCommand struct {
+	name  string
+	brief string
+	flags []completionFlag
+}
+
+// completionGroup is a group, or the app if path is empty, and the names
+// of its groups and commands.
+type completionGroup struct {
+	path     string
+	children []completionCommand
+}
+
+// completionTree returns the groups and commands of a, the commands of
+// the categories and the plugins are children of the app.
+func (a *App) completionTree() ([]completionGroup, []completionCommand) {
+	root := completionGroup{}
+	var groups []completionGroup
+	var commands []completionCommand
+	var walk func(path string, g *Group)
+	walk = func(path string, g *Group) {
+		cg := completionGroup{path: path}
+		for _, n := range g.nodes {
+			child := completionCommand{name: n.name(), brief: n.brief()}
+			cg.children = append(cg.children, child)
+			if n.group != nil {
+				walk(path+" "+n.group.Name, n.group)
+				continue
+			}
+			child.name = path + " " + child.name
+			child.flags = completionFlags(n.cmd.DefinedFlags())
+			commands = append(commands, child)
+		}
+		groups = append(groups, cg)
+	}
+	for _, g := range a.groups {
+		root.children = append(root.children, completionCommand{name: g.Name, brief: g.Brief})
+		walk(g.Name, g)
+	}
+	for _, category := range a.categories {
+		for _, c := range category.commands {
+			v := completionCommand{
+				name:  c.Name,
+				brief: c.Brief,
+				flags: completionFlags(c.DefinedFlags()),
+			}
+			root.children = append(root.children, completionCommand{name: v.name, brief: v.brief})
+			commands = append(commands, v)
+		}
+	}
+	// the flags of plugins are not known
+	for _, p := range a.plugins() {
+		root.children = append(root.children, completionCommand{name: p.name, brief: p.brief()})
+	}
+	return append([]completionGroup{root}, groups...), commands
+}
+
+func completionFlags(fs *flag.FlagSet) []completionFlag {
+	var r []completionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		v := completionFlag{
+			name:   f.Name,
+			usage:  f.Usage,
+			values: flagValues(f),
+			file:   isFileFlag(f),
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			v.isBool = true
+		}
+		r = append(r, v)
+	})
+	return r
+}
+
+// flagValues returns the valid values of f: the hash algorithms for the
+// flags listing common.SHAAlgs and the formats for the format flags.
+func flagValues(f *flag.Flag) []string {
+	switch {
+	case strings.Contains(f.Usage, common.SHAAlgs):
+		return strings.Split(common.SHAAlgs, ";")
+	case f.Name == "out-format":
+		return stdfile.OutputFormats
+	case strings.HasSuffix(f.Name, "-format"):
+		return stdfile.InputFormats
+	}
+	return nil
+}
+
+// isFileFlag returns true if the value of f is a path.
+func isFileFlag(f *flag.Flag) bool {
+	switch f.Name {
+	case "in", "out", "aad", "state", "ledger", "keystore":
+		return true
+	}
+	return strings.HasSuffix(f.Name, "-file") || strings.HasPrefix(f.Usage, "Path ")
+}
+
+// firstLine returns the first line of the usage of a flag, without the
+// trailing period.
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	return strings.TrimSuffix(s, ".")
+}
+
+func childNames(g completionGroup) []string {
+	var names []string
+	for _, c := range g.children {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func bashCompletion(b *strings.Builder, global []completionFlag, groups []completionGroup, commands []completionCommand) {
+	b.WriteString(`# bash completion for pocryp, generated by 'pocryp completion bash'
+
+# prints the groups and commands of the group given by its path
+_pocryp_children() {
+    case $1 in
+`)
+	for _, g := range groups {
+		names := childNames(g)
+		if g.path == "" {
+			names = append(flagNames(global), names...)
+		}
+		fmt.Fprintf(b, "    %q) echo %q ;;\n", g.path, strings.Join(names, " "))
+	}
+	b.WriteString(`    *) return 1 ;;
+    esac
+}
+
+_pocryp() {
+    local cur prev cmdpath children i
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    prev="${COMP_WORDS[COMP_CWORD-1]}"
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        [[ ${COMP_WORDS[i]} == -* ]] && continue
+        _pocryp_children "$cmdpath" >/dev/null || break
+        cmdpath="${cmdpath:+$cmdpath }${COMP_WORDS[i]}"
+    done
+
+    if children=$(_pocryp_children "$cmdpath"); then
+        COMPREPLY=($(compgen -W "$children" -- "$cur"))
+        return
+    fi
+
+    # flags can be given as -name or --name
+    prev="${prev#-}"
+    prev="${prev#-}"
+    case "$cmdpath $prev" in
+`)
+	// the values of the flags, grouped by kind
+	values := map[string][]string{}
+	var keys []string
+	for _, c := range commands {
+		for _, f := range c.flags {
+			var key string
+			switch {
+			case f.values != nil:
+				key = fmt.Sprintf("COMPREPLY=($(compgen -W %q -- \"$cur\"))", strings.Join(f.values, " "))
+			case f.file:
+				key = `COMPREPLY=($(compgen -f -- "$cur"))`
+			case !f.isBool:
+				// a value which cannot be completed
+				key = "COMPREPLY=()"
+			default:
+				continue
+			}
+			if _, ok := values[key]; !ok {
+				keys = append(keys, key)
+			}
+			values[key] = append(values[key], fmt.Sprintf("%q", c.name+" "+f.name))
+		}
+	}
+	for _, key := range keys {
+		fmt.Fprintf(b, "    %s)\n        %s\n        return\n        ;;\n", strings.Join(values[key], "|"), key)
+	}
+	b.WriteString(`    esac
+
+    case $cmdpath in
+`)
+	for _, c := range commands {
+		fmt.Fprintf(b, "    %q)\n        COMPREPLY=($(compgen -W %q -- \"$cur\"))\n        ;;\n", c.name, strings.Join(flagNames(c.flags), " "))
+	}
+	b.WriteString(`    esac
+}
+
+complete -o default -F _pocryp pocryp
+`)
+}
+
+func flagNames(flags []completionFlag) []string {
+	names := []string{"-h"}
+	for _, f := range flags {
+		names = append(names, "-"+f.name)
+	}
+	return names
+}
+
+// zshQuote escapes s for a single quoted _arguments or _describe spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer(`'`, `'\''`, `[`, `\[`, `]`, `\]`, `:`, `\:`).Replace(s)
+}
+
+func zshFlagSpec(f completionFlag) string {
+	spec := fmt.Sprintf("'-%s[%s]", f.name, zshQuote(firstLine(f.usage)))
+	switch {
+	case f.isBool:
+	case f.values != nil:
+		spec += fmt.Sprintf(":%s:(%s)", f.name, zshQuote(strings.Join(f.values, " ")))
+	case f.file:
+		spec += fmt.Sprintf(":%s:_files", f.name)
+	default:
+		spec += fmt.Sprintf(":%s: ", f.name)
+	}
+	return spec + "'"
+}
+
+func zshCompletion(b *strings.Builder, global []completionFlag, groups []completionGroup, commands []completionCommand) {
+	b.WriteString(`#compdef pocryp
+# zsh completion for pocryp, generated by 'pocryp completion zsh'
+
+# sets children to the groups and commands of the group given by its path
+_pocryp_children() {
+    case $1 in
+`)
+	for _, g := range groups {
+		fmt.Fprintf(b, "    '%s')\n        children=(\n", g.path)
+		for _, c := range g.children {
+			fmt.Fprintf(b, "            '%s:%s'\n", c.name, zshQuote(c.brief))
+		}
+		b.WriteString("        )\n        ;;\n")
+	}
+	b.WriteString(`    *) return 1 ;;
+    esac
+}
+
+_pocryp() {
+    local i last=1 cmdpath=''
+    local -a children
+    for ((i = 2; i < CURRENT; i++)); do
+        [[ $words[i] == -* ]] && continue
+        _pocryp_children "$cmdpath" || break
+        cmdpath="${cmdpath:+$cmdpath }$words[i]"
+        last=$i
+    done
+
+    if _pocryp_children "$cmdpath"; then
+        if [[ -n $cmdpath ]]; then
+            _describe command children
+            return
+        fi
+        _arguments \
+`)
+	for _, f := range global {
+		fmt.Fprintf(b, "            %s \\\n", zshFlagSpec(f))
+	}
+	b.WriteString(`            '1:command:{_describe command children}'
+        return
+    fi
+
+    words=("${(@)words[last,-1]}")
+    (( CURRENT -= last - 1 ))
+
+    case $cmdpath in
+`)
+	for _, c := range commands {
+		fmt.Fprintf(b, "    '%s')\n        _arguments \\\n", c.name)
+		for _, f := range c.flags {
+			fmt.Fprintf(b, "            %s \\\n", zshFlagSpec(f))
+		}
+		b.WriteString("            '*:file:_files'\n        ;;\n")
+	}
+	b.WriteString(`    esac
+}
+
+if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+    _pocryp "$@"
+else
+    compdef _pocryp pocryp
+fi
+`)
+}
+
+// fishQuote returns s as a single quoted fish string.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+func fishFlag(b *strings.Builder, condition string, f completionFlag) {
+	fmt.Fprintf(b, "complete -c pocryp -n %s -o %s", condition, f.name)
+	switch {
+	case f.isBool:
+	case f.values != nil:
+		fmt.Fprintf(b, " -x -a %s", fishQuote(strings.Join(f.values, " ")))
+	case f.file:
+		b.WriteString(" -r -F")
+	default:
+		b.WriteString(" -x")
+	}
+	fmt.Fprintf(b, " -d %s\n", fishQuote(firstLine(f.usage)))
+}
+
+func fishCompletion(b *strings.Builder, global []completionFlag, groups []completionGroup, commands []completionCommand) {
+	var paths []string
+	for _, g := range groups {
+		paths = append(paths, fishQuote(g.path))
+	}
+
+	b.WriteString(`# fish completion for pocryp, generated by 'pocryp completion fish'
+
+function __pocryp_is_group
+    switch "$argv[1]"
+        case ` + strings.Join(paths, " ") + `
+            return 0
+    end
+    return 1
+end
+
+# prints the path of the group or command given on the command line
+function __pocryp_path
+    set -l p ''
+    for w in (commandline -opc)[2..-1]
+        string match -q -- '-*' $w; and continue
+        __pocryp_is_group "$p"; or break
+        if test -z "$p"
+            set p $w
+        else
+            set p "$p $w"
+        end
+    end
+    echo $p
+end
+
+function __pocryp_using
+    set -l p (__pocryp_path)
+    test "$p" = "$argv[1]"
+end
+
+complete -c pocryp -f
+`)
+	root := fishQuote("__pocryp_using ''")
+	for _, f := range global {
+		fishFlag(b, root, f)
+	}
+	for _, g := range groups {
+		b.WriteString("\n")
+		condition := fishQuote("__pocryp_using " + fishQuote(g.path))
+		for _, c := range g.children {
+			fmt.Fprintf(b, "complete -c pocryp -n %s -a %s -d %s\n", condition, c.name, fishQuote(c.brief))
+		}
+	}
+	for _, c := range commands {
+		b.WriteString("\n")
+		condition := fishQuote("__pocryp_using " + fishQuote(c.name))
+		for _, f := range c.flags {
+			fishFlag(b, condition, f)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/common"
+)
+
+func TestCompletion(t *testing.T) {
+	var app App
+	app.Add("foo", &cmd.Command{
+		Name:  "hash",
+		Brief: "hash it",
+		Usage: "hash",
+		Run: func(c *cmd.Command) error {
+			c.Flags.String("alg", "SHA-256", "SHA algorithm to use; one of: "+common.SHAAlgs)
+			c.Flags.String("in", "", "Read data from the file at path INPUT.")
+			c.Flags.Bool("bin", false, "Print output in binary form not hex.")
+			if isHelp, err := c.Parse(); err != nil {
+				if isHelp {
+					return nil
+				}
+				return err
+			}
+			return nil
+		},
+	})
+	app.Add("bar", app.CompletionCmd())
+	app.Group("fizz", "fizz it").Group("buzz", "buzz it").Add(
+		cmd.Alias("sha", "sha it", app.categories[0].commands[0], "-alg", "SHA-1"),
+	)
+
+	global := completionFlags(app.flagSet())
+	groups, commands := app.completionTree()
+	if len(groups) != 3 {
+		t.Fatalf("expected 3 groups, got %d", len(groups))
+	}
+	if len(commands) != 3 {
+		t.Fatalf("expected 3 commands, got %d", len(commands))
+	}
+	if commands[0].name != "fizz buzz sha" {
+		t.Fatalf("wrong command path %q", commands[0].name)
+	}
+	flags := commands[0].flags
+	if len(flags) != 3 {
+		t.Fatalf("expected 3 flags, got %d", len(flags))
+	}
+	for _, f := range flags {
+		switch f.name {
+		case "alg":
+			if len(f.values) != strings.Count(common.SHAAlgs, ";")+1 {
+				t.Errorf("alg: wrong values %v", f.values)
+			}
+		case "in":
+			if !f.file {
+				t.Error("in: expected a file flag")
+			}
+		case "bin":
+			if !f.isBool {
+				t.Error("bin: expected a bool flag")
+			}
+		}
+	}
+
+	for shell, gen := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var b strings.Builder
+			gen(&b, global, groups, commands)
+			s := b.String()
+			for _, v := range []string{"hash", "completion", "fizz buzz", "alg", "bin", "json", "SHA3-512"} {
+				if !strings.Contains(s, v) {
+					t.Errorf("%q not found in the script", v)
+				}
+			}
+		})
+	}
+
+	if err := app.Run("completion", "foo"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if err := app.Run("completion"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
@@ -0,0 +1,116 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+// Group is a node of the command tree, its commands are run as
+// 'pocryp GROUP... COMMAND', e.g. 'pocryp aes gcm encrypt'.
+type Group struct {
+	Name  string
+	Brief string
+
+	// in the order they were added
+	nodes []node
+}
+
+// node is either a group or a command.
+type node struct {
+	group *Group
+	cmd   *cmd.Command
+}
+
+func (n node) name() string {
+	if n.group != nil {
+		return n.group.Name
+	}
+	return n.cmd.Name
+}
+
+func (n node) brief() string {
+	if n.group != nil {
+		return n.group.Brief
+	}
+	return n.cmd.Brief
+}
+
+func (g *Group) lookup(name string) (node, bool) {
+	for _, n := range g.nodes {
+		if n.name() == name {
+			return n, true
+		}
+	}
+	return node{}, false
+}
+
+// Group returns the subgroup of g with the given name, it is added if it
+// does not exist.
+func (g *Group) Group(name, brief string) *Group {
+	if n, ok := g.lookup(name); ok {
+		if n.group == nil {
+			panic(fmt.Sprintf("group '%s' already has a command named '%s'", g.Name, name))
+		}
+		return n.group
+	}
+	sub := &Group{Name: name, Brief: brief}
+	g.nodes = append(g.nodes, node{group: sub})
+	return sub
+}
+
+// Add adds the commands to g, usually aliases of the flat commands.
+func (g *Group) Add(cmds ...*cmd.Command) *Group {
+	for _, c := range cmds {
+		if _, ok := g.lookup(c.Name); ok {
+			panic(fmt.Sprintf("group '%s' already has a command named '%s'", g.Name, c.Name))
+		}
+		c.Init()
+		g.nodes = append(g.nodes, node{cmd: c})
+	}
+	return g
+}
+
+func isHelpArg(arg string) bool {
+	switch arg {
+	case "-h", "-help", "--h", "--help":
+		return true
+	}
+	return false
+}
+
+// run runs the command given by args, path is the command line which
+// selected g, e.g. 'pocryp aes'.
+func (g *Group) run(path string, args []string, json bool) error {
+	if len(args) == 0 || isHelpArg(args[0]) {
+		g.usage(path)
+		return nil
+	}
+
+	n, ok := g.lookup(args[0])
+	if !ok {
+		name := strings.TrimPrefix(path+" "+args[0], "pocryp ")
+		return cmd.WithCategory(cmd.CategoryUsage, fmt.Errorf("unknown command '%s'", name))
+	}
+	if n.group != nil {
+		return n.group.run(path+" "+n.group.Name, args[1:], json)
+	}
+	n.cmd.JSON = json
+	return n.cmd.Execute(args[1:])
+}
+
+func (g *Group) usage(path string) {
+	fmt.Printf("Usage: %s command [ARGS]\n\n%s.\n\nCommands:\n", path, g.Brief)
+	max := 0
+	for _, n := range g.nodes {
+		if len(n.name()) > max {
+			max = len(n.name())
+		}
+	}
+	for _, n := range g.nodes {
+		padding := strings.Repeat(" ", max-len(n.name()))
+		fmt.Printf("  %s%s  %s\n", n.name(), padding, n.brief())
+	}
+	fmt.Printf("\nRun '%s command -h' for more information about a command.\n", path)
+}
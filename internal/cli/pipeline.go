@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/pipeline"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+// PipelineCmd returns the command which runs a pipeline of the commands of
+// a, it is added to a like the other commands.
+func (a *App) PipelineCmd() *cmd.Command {
+	return &cmd.Command{
+		Name:  "run",
+		Run:   a.runPipeline,
+		Brief: "Run a pipeline of commands from a YAML file",
+
+		Usage: `Usage: pocryp run PIPELINE
+
+Run the steps of PIPELINE, a YAML file, in order and print the outputs.
+The results of the steps are passed in memory, nothing is written to disk
+unless a step has -out, e.g.:
+
+  vars:
+    kek: 000102030405060708090a0b0c0d0e0f
+  steps:
+    - name: key
+      run: aes-keygen 128
+    - name: wrap
+      run: aes keywrap wrap -key ${kek}
+      in: ${key.key}
+    - name: unwrap
+      run: [aes-keywrap, -u, -key, "${kek}"]
+      in: ${wrap.wrapped_key}
+      expect:
+        key: ${key.key}
+    - run: aes-cmac-verify -key ${key.key} -mac 00
+      in-text: hello
+      expect-error: verification-failed
+  outputs: [wrap.wrapped_key]
+
+A step runs a command with -json, the fields of its result are the
+variables STEP.FIELD. ${NAME} is replaced by the value of the variable
+NAME, binary values are hex. The stdin of a command is given as hex(in)
+or as text(in-text). A step fails if a field of expect has another value
+or if the command does not fail with the category of expect-error.
+`,
+	}
+}
+
+func (a *App) runPipeline(c *cmd.Command) error {
+	if isHelp, err := c.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if c.Flags.NArg() != 1 {
+		c.Flags.Usage()
+		return errors.New("pipeline not specified")
+	}
+
+	data, err := os.ReadFile(c.Flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	p, err := pipeline.Parse(data)
+	if err != nil {
+		return cmd.WithCategory(cmd.CategoryInvalidInput, err)
+	}
+
+	var steps []string
+	r := pipeline.Runner{
+		Exec: a.execStep,
+		Category: func(err error) string {
+			return cmd.CategoryOf(err).String()
+		},
+		Done: func(label string) {
+			steps = append(steps, label)
+			if !c.JSON {
+				fmt.Printf("ok  %s\n", label)
+			}
+		},
+	}
+	outputs, err := r.Run(p)
+	switch {
+	case errors.Is(err, pipeline.ErrAssertion):
+		return cmd.WithCategory(cmd.CategoryVerificationFailed, err)
+	case errors.Is(err, pipeline.ErrUnknownVariable):
+		return cmd.WithCategory(cmd.CategoryInvalidInput, err)
+	case err != nil:
+		return err
+	}
+
+	if c.JSON {
+		m := map[string]string{}
+		for _, o := range outputs {
+			m[o.Name] = o.Value
+		}
+		return stdfile.WriteJSON(os.Stdout, stdfile.Result{"steps": steps, "outputs": m})
+	}
+	for _, o := range outputs {
+		fmt.Printf("%s: %s\n", o.Name, o.Value)
+	}
+	return nil
+}
+
+// execStep runs the command line args of a step with -json, stdin and
+// stdout are pipes so the data stays in memory.
+func (a *App) execStep(args []string, stdin []byte) ([]byte, error) {
+	if args[0] == "run" {
+		return nil, cmd.WithCategory(cmd.CategoryUsage, errors.New("a step cannot run a pipeline"))
+	}
+
+	inR, inW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		inR.Close()
+		inW.Close()
+		return nil, err
+	}
+
+	written := make(chan struct{})
+	go func() {
+		inW.Write(stdin)
+		inW.Close()
+		close(written)
+	}()
+	var out bytes.Buffer
+	read := make(chan error)
+	go func() {
+		_, err := io.Copy(&out, outR)
+		read <- err
+	}()
+
+	prevIn, prevOut, prevJSON := os.Stdin, os.Stdout, a.json
+	os.Stdin, os.Stdout, a.json = inR, outW, true
+	err = func() error {
+		defer func() { os.Stdin, os.Stdout, a.json = prevIn, prevOut, prevJSON }()
+		return a.dispatch(args[0], args[1:])
+	}()
+
+	// the command may not read all of stdin
+	inR.Close()
+	<-written
+	outW.Close()
+	readErr := <-read
+	outR.Close()
+
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), readErr
+}
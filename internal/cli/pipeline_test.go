@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+const testPipeline = `
+steps:
+  - name: a
+    run: rev -n 1
+    in-text: abc
+    expect:
+      out: "636261"
+  - name: b
+    run: fizz rev -n 2
+    in: ${a.out}
+    expect:
+      out: "616263"
+  - run: rev -n x
+    expect-error: usage
+  - run: rev -n 3 -fail
+    expect-error: verification-failed
+outputs: [b.out]
+`
+
+func TestPipeline(t *testing.T) {
+	rev := &cmd.Command{
+		Name:  "rev",
+		Brief: "rev",
+		Usage: "rev",
+		Run: func(c *cmd.Command) error {
+			c.Flags.Int("n", 0, "a flag")
+			fail := c.Flags.Bool("fail", false, "fail")
+			if isHelp, err := c.Parse(); err != nil {
+				if isHelp {
+					return nil
+				}
+				return err
+			}
+			if *fail {
+				return util.ErrNotValid
+			}
+			if !c.JSON {
+				t.Fatal("not run with -json")
+			}
+			in, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			for i, j := 0, len(in)-1; i < j; i, j = i+1, j-1 {
+				in[i], in[j] = in[j], in[i]
+			}
+			return stdfile.WriteJSON(os.Stdout, stdfile.Result{"out": stdfile.Hex(in)})
+		},
+	}
+
+	var app App
+	app.Add("foo", rev, app.PipelineCmd())
+	app.Group("fizz", "fizz").Add(cmd.Alias("rev", "rev", rev))
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pipeline.yaml")
+	if err := os.WriteFile(path, []byte(testPipeline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	if err := app.Run("run", path); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stdout != stdout {
+		t.Fatal("stdout not restored")
+	}
+
+	if err := os.WriteFile(path, []byte("steps:\n  - run: rev\n    in-text: a\n    expect: {out: '00'}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := ExitCode(app.Run("run", path)); code != 5 {
+		t.Fatalf("assertion: want exit code 5, have %d", code)
+	}
+
+	if err := os.WriteFile(path, []byte("steps:\n  - run: run x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := ExitCode(app.Run("run", path)); code != 2 {
+		t.Fatalf("nested pipeline: want exit code 2, have %d", code)
+	}
+
+	if err := os.WriteFile(path, []byte("steps: [{foo: bar}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code := ExitCode(app.Run("run", path)); code != 4 {
+		t.Fatalf("invalid pipeline: want exit code 4, have %d", code)
+	}
+}
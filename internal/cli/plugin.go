@@ -0,0 +1,185 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A plugin is an executable named pocryp-NAME found in PATH, it is run as
+// 'pocryp NAME [ARGS]' with ARGS and the environment of pocryp.
+//
+// Run with DescribeArg as the only argument, a plugin writes its
+// PluginDescription as a JSON object to stdout and exits with status 0:
+//
+//	{"brief": "Derive a key using the OEM KDF", "usage": "Usage: pocryp oem-kdf ..."}
+//
+// The global flags are given to plugins in the environment: JSONEnv is set
+// to 1 for -json and MlockEnv to 1 for -mlock. A plugin should use the exit
+// status and, with -json, the error object of pocryp.
+const (
+	PluginPrefix = "pocryp-"
+	DescribeArg  = "--pocryp-describe"
+
+	JSONEnv  = "POCRYP_JSON"
+	MlockEnv = "POCRYP_MLOCK"
+)
+
+// describeTimeout is how long a plugin can take to describe itself.
+const describeTimeout = 2 * time.Second
+
+// PluginDescription is written by a plugin run with DescribeArg.
+type PluginDescription struct {
+	// one line, shown in the usage of pocryp
+	Brief string `json:"brief"`
+	// printed for 'pocryp NAME -h', if empty -h is given to the plugin
+	Usage string `json:"usage"`
+}
+
+type plugin struct {
+	name string
+	path string
+}
+
+// pluginName returns the name of the plugin for a file in PATH, or false if
+// the file is not a plugin.
+func pluginName(file string) (string, bool) {
+	name, ok := strings.CutPrefix(file, PluginPrefix)
+	if ok && runtime.GOOS == "windows" {
+		ext := filepath.Ext(name)
+		ok = strings.EqualFold(ext, ".exe")
+		name = strings.TrimSuffix(name, ext)
+	}
+	if !ok || name == "" || strings.HasPrefix(name, "-") {
+		return "", false
+	}
+	return name, true
+}
+
+func isExecutable(fi os.FileInfo) bool {
+	if fi.IsDir() {
+		return false
+	}
+	return runtime.GOOS == "windows" || fi.Mode().Perm()&0111 != 0
+}
+
+// findPlugins returns the plugins found in PATH, sorted by name. Like for
+// exec.LookPath, the first directory which has a plugin wins and relative
+// directories, e.g. ".", are ignored.
+func findPlugins() []plugin {
+	seen := map[string]bool{}
+	var r []plugin
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := pluginName(e.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, e.Name())
+			fi, err := os.Stat(path)
+			if err != nil || !isExecutable(fi) {
+				continue
+			}
+			seen[name] = true
+			r = append(r, plugin{name: name, path: path})
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].name < r[j].name })
+	return r
+}
+
+// lookupPlugin returns the plugin with the given name, or false if there
+// is none in PATH.
+func lookupPlugin(name string) (plugin, bool) {
+	if strings.ContainsAny(name, `/\`) || strings.HasPrefix(name, "-") {
+		return plugin{}, false
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return plugin{}, false
+	}
+	return plugin{name: name, path: path}, true
+}
+
+// describe runs p with DescribeArg.
+func (p plugin) describe() (PluginDescription, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, p.path, DescribeArg).Output()
+	if err != nil {
+		return PluginDescription{}, fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	var d PluginDescription
+	if err := json.Unmarshal(out, &d); err != nil {
+		return PluginDescription{}, fmt.Errorf("plugin %s: invalid description: %w", p.name, err)
+	}
+	return d, nil
+}
+
+// brief returns the brief of p, or where it was found if it cannot
+// describe itself.
+func (p plugin) brief() string {
+	d, err := p.describe()
+	if err != nil || d.Brief == "" {
+		return "Plugin at " + p.path
+	}
+	return firstLine(d.Brief)
+}
+
+// PluginExitError is returned when a plugin exits with a non-zero status,
+// which is the exit status of pocryp. The plugin reported the error itself.
+type PluginExitError struct {
+	Name string
+	Code int
+}
+
+func (e *PluginExitError) Error() string {
+	return fmt.Sprintf("plugin %s exited with status %d", e.Name, e.Code)
+}
+
+// run runs p with args, with the standard streams of pocryp.
+func (p plugin) run(args []string, jsonOutput, mlock bool) error {
+	if len(args) == 1 && isHelpArg(args[0]) {
+		if d, err := p.describe(); err == nil && d.Usage != "" {
+			fmt.Print(d.Usage)
+			return nil
+		}
+	}
+
+	c := exec.Command(p.path, args...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = os.Environ()
+	if jsonOutput {
+		c.Env = append(c.Env, JSONEnv+"=1")
+	}
+	if mlock {
+		c.Env = append(c.Env, MlockEnv+"=1")
+	}
+
+	err := c.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() > 0 {
+		return &PluginExitError{Name: p.name, Code: exitErr.ExitCode()}
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.name, err)
+	}
+	return nil
+}
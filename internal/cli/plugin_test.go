@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+const testPlugin = `#!/bin/sh
+if [ "$1" = "--pocryp-describe" ]; then
+	printf '%s\n' '{"brief": "Foo it", "usage": "Usage: pocryp foo\n"}'
+	exit 0
+fi
+echo "$POCRYP_JSON $*" > "$POCRYP_TEST_OUT"
+exit 3
+`
+
+func TestPlugin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pocryp-foo"), []byte(testPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "pocryp-bar"), []byte(testPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// not executable
+	if err := os.WriteFile(filepath.Join(dir, "pocryp-baz"), []byte(testPlugin), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	t.Setenv("PATH", dir)
+	t.Setenv("POCRYP_TEST_OUT", out)
+
+	var app App
+	app.Add("foo", &cmd.Command{
+		Name:  "bar",
+		Brief: "bar",
+		Usage: "bar",
+		Run:   func(*cmd.Command) error { return nil },
+	})
+
+	plugins := app.plugins()
+	if len(plugins) != 1 || plugins[0].name != "foo" {
+		t.Fatalf("unexpected plugins %v", plugins)
+	}
+	if brief := plugins[0].brief(); brief != "Foo it" {
+		t.Fatalf("unexpected brief %q", brief)
+	}
+
+	err := app.Run("-json", "foo", "a", "b")
+	var pluginErr *PluginExitError
+	if !errors.As(err, &pluginErr) {
+		t.Fatalf("expected a plugin exit error, have %v", err)
+	}
+	if code := ExitCode(err); code != 3 {
+		t.Fatalf("want exit code 3, have %d", code)
+	}
+	have, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(have) != "1 a b\n" {
+		t.Fatalf("unexpected plugin output %q", have)
+	}
+
+	// printed from the description
+	if err := app.Run("foo", "-h"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.Run("baz"); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestPluginRelativePath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test plugin is a shell script")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pocryp-foo"), []byte(testPlugin), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	t.Setenv("PATH", ".")
+
+	var app App
+	if plugins := app.plugins(); len(plugins) != 0 {
+		t.Fatalf("unexpected plugins %v", plugins)
+	}
+	if _, ok := lookupPlugin("foo"); ok {
+		t.Fatal("plugin found in the working directory")
+	}
+}
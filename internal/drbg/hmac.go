@@ -0,0 +1,109 @@
+package drbg
+
+import (
+	"crypto/hmac"
+	"errors"
+	"hash"
+)
+
+// maxBytesPerRequest is the maximum number of bytes returned by one generate
+// call, as specified in NIST SP 800-90A Rev. 1, Table 2.
+const maxBytesPerRequest = 1 << 16
+
+// HMAC implements HMAC_DRBG as specified in NIST SP 800-90A Rev. 1, section 10.1.2,
+// without prediction resistance.
+//
+// It is a deterministic generator: the same seed material always produces the
+// same output. It must not be used to generate keys for production.
+type HMAC struct {
+	newHash func() hash.Hash
+	k       []byte
+	v       []byte
+}
+
+// NewHMAC instantiates a HMAC_DRBG from the given seed material.
+func NewHMAC(newHash func() hash.Hash, entropy, nonce, personalization []byte) (*HMAC, error) {
+	if len(entropy) == 0 {
+		return nil, errors.New("drbg: entropy input is empty")
+	}
+
+	size := newHash().Size()
+
+	d := &HMAC{
+		newHash: newHash,
+		k:       make([]byte, size),
+		v:       make([]byte, size),
+	}
+	for i := range d.v {
+		d.v[i] = 0x01
+	}
+
+	d.update(entropy, nonce, personalization)
+
+	return d, nil
+}
+
+// Reseed mixes new entropy in the internal state.
+func (d *HMAC) Reseed(entropy, additional []byte) {
+	d.update(entropy, additional)
+}
+
+// Generate fills b with pseudorandom bytes.
+func (d *HMAC) Generate(b, additional []byte) error {
+	if len(b) > maxBytesPerRequest {
+		return errors.New("drbg: too many bytes requested")
+	}
+
+	if len(additional) != 0 {
+		d.update(additional)
+	}
+
+	for n := 0; n < len(b); {
+		d.v = d.mac(d.k, d.v)
+		n += copy(b[n:], d.v)
+	}
+
+	d.update(additional)
+
+	return nil
+}
+
+// Read implements io.Reader, so the generator can be used as a source of randomness.
+func (d *HMAC) Read(b []byte) (int, error) {
+	n := 0
+	for n < len(b) {
+		end := min(n+maxBytesPerRequest, len(b))
+		if err := d.Generate(b[n:end], nil); err != nil {
+			return n, err
+		}
+		n = end
+	}
+	return n, nil
+}
+
+func (d *HMAC) update(data ...[]byte) {
+	provided := false
+	for _, v := range data {
+		if len(v) != 0 {
+			provided = true
+		}
+	}
+
+	d.k = d.mac(d.k, append([][]byte{d.v, {0x00}}, data...)...)
+	d.v = d.mac(d.k, d.v)
+
+	if !provided {
+		return
+	}
+
+	d.k = d.mac(d.k, append([][]byte{d.v, {0x01}}, data...)...)
+	d.v = d.mac(d.k, d.v)
+}
+
+func (d *HMAC) mac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(d.newHash, key)
+	for _, v := range data {
+		h.Write(v)
+	}
+	return h.Sum(nil)
+}
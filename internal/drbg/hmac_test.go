@@ -0,0 +1,88 @@
+package drbg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestHMAC(t *testing.T) {
+	t.Run("NoEntropy", func(t *testing.T) {
+		if _, err := NewHMAC(sha256.New, nil, nil, nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	// NIST CAVP HMAC_DRBG.rsp, [SHA-256], no prediction resistance, COUNT = 0
+	t.Run("KAT", func(t *testing.T) {
+		d, err := NewHMAC(
+			sha256.New,
+			testutil.BytesFromHex(t, "ca851911349384bffe89de1cbdc46e6831e44d34a4fb935ee285dd14b71a7488"),
+			testutil.BytesFromHex(t, "659ba96c601dc69fc902940805ec0ca8"),
+			nil,
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, 128)
+		if err := d.Generate(out, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Generate(out, nil); err != nil {
+			t.Fatal(err)
+		}
+		want := testutil.BytesFromHex(t, ""+
+			"e528e9abf2dece54d47c7e75e5fe302149f817ea9fb4bee6f4199697d04d5b89"+
+			"d54fbb978a15b5c443c9ec21036d2460b6f73ebad0dc2aba6e624abf07745bc1"+
+			"07694bb7547bb0995f70de25d6b29e2d3011bb19d27676c07162c8b5ccde0668"+
+			"961df86803482cb37ed6d5c0bb8d50cf1f50d476aa0458bdaba806f48be9dcb8")
+		if !bytes.Equal(out, want) {
+			t.Logf("want %x", want)
+			t.Logf("have %x", out)
+			t.Fatal("not equal")
+		}
+	})
+
+	t.Run("TooManyBytes", func(t *testing.T) {
+		d, err := NewHMAC(sha256.New, []byte("seed"), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Generate(make([]byte, maxBytesPerRequest+1), nil); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("Read", func(t *testing.T) {
+		newDrbg := func() *HMAC {
+			d, err := NewHMAC(sha256.New, []byte("seed"), []byte("nonce"), []byte("pers"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return d
+		}
+
+		a := make([]byte, maxBytesPerRequest*2+5)
+		if _, err := newDrbg().Read(a); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, len(a))
+		if _, err := newDrbg().Read(b); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(a, b) {
+			t.Fatal("output is not deterministic")
+		}
+
+		d := newDrbg()
+		d.Reseed([]byte("more entropy"), nil)
+		if _, err := d.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Equal(a, b) {
+			t.Fatal("reseed did not change the output")
+		}
+	})
+}
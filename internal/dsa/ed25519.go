@@ -6,6 +6,8 @@ import (
 	"fmt"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/pkcs11"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
@@ -21,15 +23,17 @@ Generate signature using ED25519.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
-`,
+` + "\n" + pkcs11.URIHelp,
 }
 
 func runEd25519Sign(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -38,30 +42,43 @@ func runEd25519Sign(cmd *cmd.Command) error {
 		return err
 	}
 
-	keyData, err := util.FileOrHex(*fKeyFile, *fKey)
-	if err != nil {
-		return fmt.Errorf("key: %w", err)
+	var keyData *secret.Buffer
+	if !pkcs11.IsURI(*fKey) {
+		var err error
+		keyData, err = util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+		if err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+		defer keyData.Destroy()
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	key := ed25519.PrivateKey(keyData)
-
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
-	output, err := key.Sign(nil, input, crypto.Hash(0))
+	var output []byte
+	if keyData == nil {
+		output, err = pkcs11.SignEd25519(*fKey, input)
+		err = util.CryptoFailure(err)
+	} else {
+		output, err = ed25519.PrivateKey(keyData.Bytes()).Sign(nil, input, crypto.Hash(0))
+	}
 	if err != nil {
 		return err
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"signature": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
 
 var Ed25519VerifyCmd = &cmd.Command{
@@ -79,10 +96,13 @@ If -in is not specified, stdin will be read.
 
 func runEd25519Verify(cmd *cmd.Command) error {
 	fInput := cmd.Flags.String("in", "", "Read message from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fSig := cmd.Flags.String("sig", "", "Expected signature as hex string.")
 	fSigFile := cmd.Flags.String("sig-file", "", "File which contains the signature as binary/text.")
+	fSigFormat := util.FormatFlag(cmd.Flags, "sig", "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -91,31 +111,45 @@ func runEd25519Verify(cmd *cmd.Command) error {
 		return err
 	}
 
-	keyData, err := util.FileOrHex(*fKeyFile, *fKey)
+	keyData, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		return fmt.Errorf("key: %w", err)
 	}
+	defer keyData.Destroy()
 
-	sig, err := util.FileOrHex(*fSigFile, *fSig)
+	sig, err := util.FileOrHexAs(*fSigFile, *fSig, *fSigFormat)
 	if err != nil {
 		return fmt.Errorf("sig: %w", err)
 	}
 
-	sf, err := stdfile.New(*fInput, "")
+	sf, err := stdfile.New(*fInput, "", stdfile.Options{})
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
-	key := ed25519.PublicKey(keyData)
+	key := ed25519.PublicKey(keyData.Bytes())
+	if util.IsKeyRef(*fKey) || util.IsKeyRef(*fKeyFile) {
+		// the keystore contains the private key
+		if keyData.Len() != ed25519.PrivateKeySize {
+			return fmt.Errorf("key: invalid private key size: %d", keyData.Len())
+		}
+		key = ed25519.PrivateKey(keyData.Bytes()).Public().(ed25519.PublicKey)
+	}
 
-	if ok := ed25519.Verify(key, input, sig); !ok {
-		return fmt.Errorf("not valid")
+	valid := ed25519.Verify(key, input, sig)
+	if cmd.JSON {
+		if err := sf.WriteJSON(stdfile.Result{"valid": valid}); err != nil {
+			return err
+		}
+	}
+	if !valid {
+		return util.ErrNotValid
 	}
 
 	return nil
@@ -0,0 +1,247 @@
+package asn1
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ClassUniversal       = 0
+	ClassApplication     = 1
+	ClassContextSpecific = 2
+	ClassPrivate         = 3
+)
+
+const (
+	TagBoolean         = 1
+	TagInteger         = 2
+	TagBitString       = 3
+	TagOctetString     = 4
+	TagNull            = 5
+	TagOID             = 6
+	TagEnum            = 10
+	TagUTF8String      = 12
+	TagSequence        = 16
+	TagSet             = 17
+	TagNumericString   = 18
+	TagPrintableString = 19
+	TagT61String       = 20
+	TagIA5String       = 22
+	TagUTCTime         = 23
+	TagGeneralizedTime = 24
+	TagVisibleString   = 26
+	TagGeneralString   = 27
+	TagBMPString       = 30
+)
+
+// Node is one element of a parsed BER/DER structure.
+type Node struct {
+	// Raw contains the complete encoding of the element(header and content)
+	Raw []byte
+	// Content contains only the content octets
+	Content []byte
+	// Children contains the parsed content of constructed elements and of
+	// BIT/OCTET STRINGs which encapsulate another DER structure
+	Children []*Node
+
+	Class int
+	Tag   int
+
+	// Offset of the element relative to the start of the input
+	Offset int
+	// HeaderLen is the number of octets used by identifier and length
+	HeaderLen int
+
+	Constructed bool
+	// Indefinite is set for BER indefinite length encoding
+	Indefinite bool
+	// Encapsulated is set when the children were found inside a primitive
+	// BIT STRING or OCTET STRING
+	Encapsulated bool
+}
+
+const maxDepth = 64
+
+// Parse decodes all the BER/DER elements found in b.
+func Parse(b []byte) ([]*Node, error) {
+	nodes, rest, err := parseList(b, 0, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("offset %d: trailing data", len(b)-len(rest))
+	}
+	return nodes, nil
+}
+
+func parseList(b []byte, offset, depth int, untilEOC bool) ([]*Node, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, fmt.Errorf("offset %d: maximum nesting depth exceeded", offset)
+	}
+	var nodes []*Node
+	for len(b) > 0 {
+		if untilEOC && len(b) >= 2 && b[0] == 0 && b[1] == 0 {
+			return nodes, b[2:], nil
+		}
+		n, rest, err := parseNode(b, offset, depth)
+		if err != nil {
+			return nil, nil, err
+		}
+		nodes = append(nodes, n)
+		offset += len(b) - len(rest)
+		b = rest
+	}
+	if untilEOC {
+		return nil, nil, fmt.Errorf("offset %d: missing end-of-contents", offset)
+	}
+	return nodes, b, nil
+}
+
+func parseNode(b []byte, offset, depth int) (*Node, []byte, error) {
+	n := &Node{Offset: offset}
+
+	if len(b) < 2 {
+		return nil, nil, fmt.Errorf("offset %d: truncated header", offset)
+	}
+
+	i := 0
+	n.Class = int(b[i] >> 6)
+	n.Constructed = b[i]&0x20 != 0
+	n.Tag = int(b[i] & 0x1f)
+	i++
+
+	// high tag number form
+	if n.Tag == 0x1f {
+		n.Tag = 0
+		for {
+			if i >= len(b) {
+				return nil, nil, fmt.Errorf("offset %d: truncated tag", offset)
+			}
+			if n.Tag > (1<<24)-1 {
+				return nil, nil, fmt.Errorf("offset %d: tag number too large", offset)
+			}
+			n.Tag = n.Tag<<7 | int(b[i]&0x7f)
+			i++
+			if b[i-1]&0x80 == 0 {
+				break
+			}
+		}
+	}
+
+	if i >= len(b) {
+		return nil, nil, fmt.Errorf("offset %d: truncated length", offset)
+	}
+
+	length := 0
+	switch l := b[i]; {
+	case l < 0x80:
+		length = int(l)
+		i++
+	case l == 0x80:
+		if !n.Constructed {
+			return nil, nil, fmt.Errorf("offset %d: indefinite length for primitive element", offset)
+		}
+		n.Indefinite = true
+		i++
+	case l == 0xff:
+		return nil, nil, fmt.Errorf("offset %d: reserved length octet", offset)
+	default:
+		numOctets := int(l & 0x7f)
+		i++
+		if numOctets > 4 {
+			return nil, nil, fmt.Errorf("offset %d: length too large", offset)
+		}
+		if i+numOctets > len(b) {
+			return nil, nil, fmt.Errorf("offset %d: truncated length", offset)
+		}
+		for _, v := range b[i : i+numOctets] {
+			length = length<<8 | int(v)
+		}
+		i += numOctets
+	}
+
+	n.HeaderLen = i
+
+	if n.Indefinite {
+		children, rest, err := parseList(b[i:], offset+i, depth+1, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		end := len(b) - len(rest)
+		n.Children = children
+		n.Content = b[i : end-2]
+		n.Raw = b[:end]
+		return n, rest, nil
+	}
+
+	if length > len(b)-i {
+		return nil, nil, fmt.Errorf("offset %d: length %d exceeds available data(%d)", offset, length, len(b)-i)
+	}
+
+	n.Content = b[i : i+length]
+	n.Raw = b[:i+length]
+
+	if n.Constructed {
+		children, _, err := parseList(n.Content, offset+i, depth+1, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		n.Children = children
+	} else if n.Class == ClassUniversal {
+		n.parseEncapsulated(depth)
+	}
+
+	return n, b[i+length:], nil
+}
+
+// parseEncapsulated tries to decode the content of a BIT STRING or OCTET
+// STRING as a single constructed element, as done for example in
+// SubjectPublicKeyInfo or PKCS#8.
+func (n *Node) parseEncapsulated(depth int) {
+	content := n.Content
+	offset := n.Offset + n.HeaderLen
+	switch n.Tag {
+	case TagOctetString:
+	case TagBitString:
+		if len(content) < 1 || content[0] != 0 {
+			return
+		}
+		content = content[1:]
+		offset++
+	default:
+		return
+	}
+	if len(content) < 2 || content[0]&0x20 == 0 {
+		return
+	}
+	child, rest, err := parseNode(content, offset, depth+1)
+	if err != nil || len(rest) != 0 {
+		return
+	}
+	n.Children = []*Node{child}
+	n.Encapsulated = true
+}
+
+// Find returns the element found at the given path.
+// The path is a list of dot separated indexes, e.g. "0.1.2" selects the
+// third child of the second child of the first top level element.
+func Find(nodes []*Node, path string) (*Node, error) {
+	if path == "" {
+		return nil, errors.New("empty path")
+	}
+	var n *Node
+	for _, v := range strings.Split(path, ".") {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path element %q", v)
+		}
+		if i < 0 || i >= len(nodes) {
+			return nil, fmt.Errorf("path element %d out of range, have %d elements", i, len(nodes))
+		}
+		n = nodes[i]
+		nodes = n.Children
+	}
+	return n, nil
+}
@@ -0,0 +1,159 @@
+package asn1
+
+import (
+	"bytes"
+	"crypto/x509"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+
+	rsautil "bandr.me/p/pocryp/internal/encoding/rsa/util"
+)
+
+func TestParse(t *testing.T) {
+	t.Run("Empty", func(t *testing.T) {
+		nodes, err := Parse(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 0 {
+			t.Fatalf("expected no nodes, have %d", len(nodes))
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			input string
+		}{
+			{"TruncatedHeader", "30"},
+			{"TruncatedContent", "300302"},
+			{"TruncatedLength", "3082"},
+			{"LengthTooLarge", "3085ffffffffff"},
+			{"IndefinitePrimitive", "0480"},
+			{"MissingEOC", "30800201"},
+			{"InvalidChild", "3003020501"},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if _, err := Parse(testutil.BytesFromHex(t, test.input)); err == nil {
+					t.Fatal("expected error")
+				}
+			})
+		}
+	})
+
+	t.Run("Sequence", func(t *testing.T) {
+		// SEQUENCE { INTEGER 5, OCTET STRING 0102, [0] { NULL } }
+		input := testutil.BytesFromHex(t, "300b02010504020102a0020500")
+		nodes, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 1 {
+			t.Fatalf("expected 1 node, have %d", len(nodes))
+		}
+		seq := nodes[0]
+		if seq.Tag != TagSequence || !seq.Constructed || len(seq.Children) != 3 {
+			t.Fatalf("unexpected node: %+v", seq)
+		}
+		if seq.Children[1].Offset != 5 || seq.Children[1].HeaderLen != 2 {
+			t.Fatalf("unexpected offset/header: %d/%d", seq.Children[1].Offset, seq.Children[1].HeaderLen)
+		}
+		ctx := seq.Children[2]
+		if ctx.Class != ClassContextSpecific || ctx.Tag != 0 || len(ctx.Children) != 1 {
+			t.Fatalf("unexpected node: %+v", ctx)
+		}
+		if !bytes.Equal(seq.Raw, input) {
+			t.Fatal("raw is not equal to input")
+		}
+	})
+
+	t.Run("IndefiniteLength", func(t *testing.T) {
+		input := testutil.BytesFromHex(t, "308002010502010600000500")
+		nodes, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(nodes) != 2 {
+			t.Fatalf("expected 2 nodes, have %d", len(nodes))
+		}
+		if !nodes[0].Indefinite || len(nodes[0].Children) != 2 {
+			t.Fatalf("unexpected node: %+v", nodes[0])
+		}
+		if nodes[1].Offset != 10 || nodes[1].Tag != TagNull {
+			t.Fatalf("unexpected node: %+v", nodes[1])
+		}
+	})
+
+	t.Run("HighTagNumber", func(t *testing.T) {
+		nodes, err := Parse(testutil.BytesFromHex(t, "9f81000100"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nodes[0].Tag != 128 || nodes[0].Class != ClassContextSpecific {
+			t.Fatalf("unexpected node: %+v", nodes[0])
+		}
+	})
+
+	t.Run("Encapsulated", func(t *testing.T) {
+		pub, err := rsautil.PublicKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_public_key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodes, err := Parse(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+		bitString := nodes[0].Children[1]
+		if !bitString.Encapsulated || len(bitString.Children) != 1 {
+			t.Fatalf("expected encapsulated content: %+v", bitString)
+		}
+		if !bytes.Equal(bitString.Children[0].Raw, x509.MarshalPKCS1PublicKey(pub)) {
+			t.Fatal("encapsulated content is not the PKCS#1 public key")
+		}
+	})
+}
+
+func TestFind(t *testing.T) {
+	// SEQUENCE { INTEGER 5, OCTET STRING { SEQUENCE { INTEGER 7 } } }
+	input := testutil.BytesFromHex(t, "300b0201050406300402020007")
+	nodes, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, path := range []string{"", "a", "1", "0.2", "0.-1", "0.0.0"} {
+			if _, err := Find(nodes, path); err == nil {
+				t.Fatalf("%q: expected error", path)
+			}
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := []struct {
+			path string
+			want string
+		}{
+			{"0", "300b0201050406300402020007"},
+			{"0.0", "020105"},
+			{"0.1", "0406300402020007"},
+			{"0.1.0", "300402020007"},
+			{"0.1.0.0", "02020007"},
+		}
+		for _, test := range tests {
+			n, err := Find(nodes, test.path)
+			if err != nil {
+				t.Fatal(test.path, err)
+			}
+			if want := testutil.BytesFromHex(t, test.want); !bytes.Equal(n.Raw, want) {
+				t.Fatalf("%s: want %x, have %x", test.path, want, n.Raw)
+			}
+		}
+	})
+}
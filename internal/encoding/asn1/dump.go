@@ -0,0 +1,291 @@
+package asn1
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var DumpCmd = &cmd.Command{
+	Name:  "asn1-dump",
+	Run:   runDump,
+	Brief: "Print the structure of BER/DER encoded data",
+
+	Usage: `Usage: pocryp asn1-dump [-in-format FORMAT] [-path PATH [-bin]] [-in INPUT] [-out OUTPUT]
+
+Print the structure of BER/DER encoded data as an indented tree.
+
+Every line contains the offset of the element, the header and content length,
+the path of the element, its tag and its decoded value.
+
+If -path is specified, the element found at PATH is written as DER instead.
+PATH is a list of dot separated indexes as printed in the tree, e.g. 0.1.
+
+If -in is not specified, stdin will be read.
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func runDump(cmd *cmd.Command) error {
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "auto")
+	fPath := cmd.Flags.String("path", "", "Extract the element found at PATH as DER.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	der, err := sf.ReadAs(fInFormat)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := Parse(der)
+	if err != nil {
+		return err
+	}
+
+	if *fPath != "" {
+		n, err := Find(nodes, *fPath)
+		if err != nil {
+			return err
+		}
+		if cmd.JSON {
+			return sf.WriteJSON(stdfile.Result{"path": *fPath, "der": stdfile.Hex(n.Raw)})
+		}
+		return sf.Write(n.Raw, fOut)
+	}
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"nodes": jsonNodes(nodes, "")})
+	}
+
+	if err := Dump(sf.Out, nodes); err != nil {
+		return err
+	}
+
+	return sf.Commit()
+}
+
+// Dump writes a human readable tree of the given nodes to w.
+func Dump(w io.Writer, nodes []*Node) error {
+	for i, n := range nodes {
+		if err := dumpNode(w, n, strconv.Itoa(i), 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonNode is the JSON form of a line printed by Dump.
+type jsonNode struct {
+	Path      string     `json:"path"`
+	Offset    int        `json:"offset"`
+	HeaderLen int        `json:"header_length"`
+	Length    int        `json:"length"`
+	Tag       string     `json:"tag"`
+	Value     string     `json:"value,omitempty"`
+	Children  []jsonNode `json:"children,omitempty"`
+}
+
+func jsonNodes(nodes []*Node, parent string) []jsonNode {
+	var r []jsonNode
+	for i, n := range nodes {
+		path := strconv.Itoa(i)
+		if parent != "" {
+			path = parent + "." + path
+		}
+		v := jsonNode{
+			Path:      path,
+			Offset:    n.Offset,
+			HeaderLen: n.HeaderLen,
+			Length:    len(n.Content),
+			Tag:       n.TagName(),
+			Children:  jsonNodes(n.Children, path),
+		}
+		if n.Indefinite {
+			// no length octets
+			v.Length = -1
+		}
+		if desc := n.Describe(); len(desc) > len(v.Tag) {
+			v.Value = desc[len(v.Tag)+1:]
+		}
+		r = append(r, v)
+	}
+	return r
+}
+
+func dumpNode(w io.Writer, n *Node, path string, depth int) error {
+	length := strconv.Itoa(len(n.Content))
+	if n.Indefinite {
+		length = "inf"
+	}
+	line := fmt.Sprintf(
+		"%6d %2d+%-5s %-12s %s%s",
+		n.Offset, n.HeaderLen, length, path, strings.Repeat("  ", depth), n.Describe(),
+	)
+	if _, err := fmt.Fprintln(w, strings.TrimRight(line, " ")); err != nil {
+		return err
+	}
+	for i, child := range n.Children {
+		if err := dumpNode(w, child, path+"."+strconv.Itoa(i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describe returns the tag name followed by the decoded value of n.
+func (n Node) Describe() string {
+	name := n.TagName()
+	if n.Constructed {
+		return name
+	}
+	value := n.value()
+	if n.Encapsulated {
+		value = "encapsulates"
+	}
+	if value == "" {
+		return name
+	}
+	return name + " " + value
+}
+
+var universalNames = map[int]string{
+	0:                  "END-OF-CONTENTS",
+	TagBoolean:         "BOOLEAN",
+	TagInteger:         "INTEGER",
+	TagBitString:       "BIT STRING",
+	TagOctetString:     "OCTET STRING",
+	TagNull:            "NULL",
+	TagOID:             "OBJECT IDENTIFIER",
+	7:                  "ObjectDescriptor",
+	8:                  "EXTERNAL",
+	9:                  "REAL",
+	TagEnum:            "ENUMERATED",
+	TagUTF8String:      "UTF8String",
+	13:                 "RELATIVE-OID",
+	TagSequence:        "SEQUENCE",
+	TagSet:             "SET",
+	TagNumericString:   "NumericString",
+	TagPrintableString: "PrintableString",
+	TagT61String:       "T61String",
+	21:                 "VideotexString",
+	TagIA5String:       "IA5String",
+	TagUTCTime:         "UTCTime",
+	TagGeneralizedTime: "GeneralizedTime",
+	25:                 "GraphicString",
+	TagVisibleString:   "VisibleString",
+	TagGeneralString:   "GeneralString",
+	28:                 "UniversalString",
+	TagBMPString:       "BMPString",
+}
+
+// TagName returns the name of the tag of n, e.g. "SEQUENCE" or "[0]".
+func (n Node) TagName() string {
+	switch n.Class {
+	case ClassUniversal:
+		if name, ok := universalNames[n.Tag]; ok {
+			return name
+		}
+		return fmt.Sprintf("[UNIVERSAL %d]", n.Tag)
+	case ClassApplication:
+		return fmt.Sprintf("[APPLICATION %d]", n.Tag)
+	case ClassContextSpecific:
+		return fmt.Sprintf("[%d]", n.Tag)
+	default:
+		return fmt.Sprintf("[PRIVATE %d]", n.Tag)
+	}
+}
+
+func (n Node) value() string {
+	c := n.Content
+	if n.Class != ClassUniversal {
+		return hex.EncodeToString(c)
+	}
+	switch n.Tag {
+	case TagBoolean:
+		if len(c) != 1 {
+			return "(invalid) " + hex.EncodeToString(c)
+		}
+		if c[0] == 0 {
+			return "FALSE"
+		}
+		return "TRUE"
+	case TagInteger, TagEnum:
+		return formatInteger(c)
+	case TagBitString:
+		if len(c) == 0 {
+			return "(invalid)"
+		}
+		if c[0] == 0 {
+			return hex.EncodeToString(c[1:])
+		}
+		return fmt.Sprintf("(%d unused bits) %s", c[0], hex.EncodeToString(c[1:]))
+	case TagNull:
+		return ""
+	case TagOID:
+		oid, err := DecodeOID(c)
+		if err != nil {
+			return "(invalid) " + hex.EncodeToString(c)
+		}
+		if name := OIDName(oid); name != "" {
+			return oid + " (" + name + ")"
+		}
+		return oid
+	case TagUTF8String,
+		TagNumericString,
+		TagPrintableString,
+		TagT61String,
+		TagIA5String,
+		TagUTCTime,
+		TagGeneralizedTime,
+		TagVisibleString,
+		TagGeneralString:
+		return strconv.Quote(string(c))
+	case TagBMPString:
+		if len(c)%2 != 0 {
+			return "(invalid) " + hex.EncodeToString(c)
+		}
+		u := make([]uint16, len(c)/2)
+		for i := range u {
+			u[i] = uint16(c[2*i])<<8 | uint16(c[2*i+1])
+		}
+		return strconv.Quote(string(utf16.Decode(u)))
+	default:
+		return hex.EncodeToString(c)
+	}
+}
+
+func formatInteger(c []byte) string {
+	if len(c) == 0 {
+		return "(invalid)"
+	}
+	if len(c) > 8 {
+		return hex.EncodeToString(c)
+	}
+	v := new(big.Int).SetBytes(c)
+	if c[0]&0x80 != 0 {
+		// two's complement
+		v.Sub(v, new(big.Int).Lsh(big.NewInt(1), uint(len(c)*8)))
+	}
+	return v.String()
+}
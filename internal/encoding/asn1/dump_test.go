@@ -0,0 +1,112 @@
+package asn1
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestDumpCmd(t *testing.T) {
+	tmp := t.TempDir()
+	in := filepath.Join(tmp, "in")
+	out := filepath.Join(tmp, "out")
+
+	pemData := testutil.ReadFile(t, "testdata/rsa2048_public_key.pem")
+	block, _ := pem.Decode(pemData)
+	pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		testutil.SetupIn(t, in, pemData)
+		if err := testutil.RunCmd(DumpCmd, "-in", in, "-in-format", "foo"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("InvalidPath", func(t *testing.T) {
+		testutil.SetupIn(t, in, pemData)
+		if err := testutil.RunCmd(DumpCmd, "-in", in, "-path", "0.5"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	inputs := map[string][]byte{
+		"pem": pemData,
+		"bin": block.Bytes,
+		"hex": []byte(strings.ToUpper(hex.EncodeToString(block.Bytes)) + "\n"),
+	}
+	for format, input := range inputs {
+		t.Run("Tree-"+format, func(t *testing.T) {
+			testutil.SetupInOut(t, in, out, input)
+			if err := testutil.RunCmd(DumpCmd, "-in", in, "-out", out); err != nil {
+				t.Fatal(err)
+			}
+			result, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines := strings.Split(strings.TrimSpace(string(result)), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("expected 3 lines, have %d:\n%s", len(lines), result)
+			}
+			if !strings.HasSuffix(lines[0], "0            SEQUENCE") {
+				t.Fatalf("unexpected line: %q", lines[0])
+			}
+			if !strings.HasSuffix(lines[2], "0.1            INTEGER 65537") {
+				t.Fatalf("unexpected line: %q", lines[2])
+			}
+		})
+	}
+
+	t.Run("Path", func(t *testing.T) {
+		testutil.SetupInOut(t, in, out, pemData)
+		if err := testutil.RunCmd(DumpCmd, "-in", in, "-out", out, "-bin", "-path", "0.0"); err != nil {
+			t.Fatal(err)
+		}
+		result := testutil.ReadFile(t, out)
+		nodes, err := Parse(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nodes[0].Tag != TagInteger || !bytes.Equal(nodes[0].Content[1:], pub.N.Bytes()) {
+			t.Fatal("extracted element is not the modulus")
+		}
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0101ff", "BOOLEAN TRUE"},
+		{"010100", "BOOLEAN FALSE"},
+		{"0201ff", "INTEGER -1"},
+		{"0500", "NULL"},
+		{"06032b6570", "OBJECT IDENTIFIER 1.3.101.112 (Ed25519)"},
+		{"0303060102", "BIT STRING (6 unused bits) 0102"},
+		{"1303414243", `PrintableString "ABC"`},
+		{"1e0400680069", `BMPString "hi"`},
+		{"8001ff", "[0] ff"},
+		{"6100", "[APPLICATION 1]"},
+		{"df0100", "[PRIVATE 1]"},
+	}
+	for _, test := range tests {
+		nodes, err := Parse(testutil.BytesFromHex(t, test.input))
+		if err != nil {
+			t.Fatal(test.input, err)
+		}
+		if have := nodes[0].Describe(); have != test.want {
+			t.Fatalf("want %q, have %q", test.want, have)
+		}
+	}
+}
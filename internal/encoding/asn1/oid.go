@@ -0,0 +1,160 @@
+package asn1
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var oidNames = map[string]string{
+	// PKCS#1
+	"1.2.840.113549.1.1.1":  "rsaEncryption",
+	"1.2.840.113549.1.1.5":  "sha1WithRSAEncryption",
+	"1.2.840.113549.1.1.7":  "rsaOAEP",
+	"1.2.840.113549.1.1.8":  "pkcs1-MGF",
+	"1.2.840.113549.1.1.10": "rsassaPss",
+	"1.2.840.113549.1.1.11": "sha256WithRSAEncryption",
+	"1.2.840.113549.1.1.12": "sha384WithRSAEncryption",
+	"1.2.840.113549.1.1.13": "sha512WithRSAEncryption",
+	"1.2.840.113549.1.1.14": "sha224WithRSAEncryption",
+
+	// PKCS#5
+	"1.2.840.113549.1.5.12": "PBKDF2",
+	"1.2.840.113549.1.5.13": "PBES2",
+
+	// PKCS#7 and PKCS#9
+	"1.2.840.113549.1.7.1":  "data",
+	"1.2.840.113549.1.7.2":  "signedData",
+	"1.2.840.113549.1.7.3":  "envelopedData",
+	"1.2.840.113549.1.7.6":  "encryptedData",
+	"1.2.840.113549.1.9.1":  "emailAddress",
+	"1.2.840.113549.1.9.3":  "contentType",
+	"1.2.840.113549.1.9.4":  "messageDigest",
+	"1.2.840.113549.1.9.5":  "signingTime",
+	"1.2.840.113549.1.9.14": "extensionRequest",
+
+	// HMAC
+	"1.2.840.113549.2.7":  "hmacWithSHA1",
+	"1.2.840.113549.2.8":  "hmacWithSHA224",
+	"1.2.840.113549.2.9":  "hmacWithSHA256",
+	"1.2.840.113549.2.10": "hmacWithSHA384",
+	"1.2.840.113549.2.11": "hmacWithSHA512",
+
+	// EC
+	"1.2.840.10045.2.1":   "ecPublicKey",
+	"1.2.840.10045.3.1.7": "prime256v1",
+	"1.3.132.0.34":        "secp384r1",
+	"1.3.132.0.35":        "secp521r1",
+	"1.2.840.10045.4.3.2": "ecdsa-with-SHA256",
+	"1.2.840.10045.4.3.3": "ecdsa-with-SHA384",
+	"1.2.840.10045.4.3.4": "ecdsa-with-SHA512",
+
+	// Edwards and Montgomery curves
+	"1.3.101.110": "X25519",
+	"1.3.101.111": "X448",
+	"1.3.101.112": "Ed25519",
+	"1.3.101.113": "Ed448",
+
+	// Hash functions
+	"1.3.14.3.2.26":           "sha1",
+	"2.16.840.1.101.3.4.2.1":  "sha256",
+	"2.16.840.1.101.3.4.2.2":  "sha384",
+	"2.16.840.1.101.3.4.2.3":  "sha512",
+	"2.16.840.1.101.3.4.2.4":  "sha224",
+	"2.16.840.1.101.3.4.2.5":  "sha512-224",
+	"2.16.840.1.101.3.4.2.6":  "sha512-256",
+	"2.16.840.1.101.3.4.2.7":  "sha3-224",
+	"2.16.840.1.101.3.4.2.8":  "sha3-256",
+	"2.16.840.1.101.3.4.2.9":  "sha3-384",
+	"2.16.840.1.101.3.4.2.10": "sha3-512",
+
+	// AES
+	"2.16.840.1.101.3.4.1.2":  "aes128-CBC",
+	"2.16.840.1.101.3.4.1.5":  "aes128-wrap",
+	"2.16.840.1.101.3.4.1.6":  "aes128-GCM",
+	"2.16.840.1.101.3.4.1.22": "aes192-CBC",
+	"2.16.840.1.101.3.4.1.25": "aes192-wrap",
+	"2.16.840.1.101.3.4.1.26": "aes192-GCM",
+	"2.16.840.1.101.3.4.1.42": "aes256-CBC",
+	"2.16.840.1.101.3.4.1.45": "aes256-wrap",
+	"2.16.840.1.101.3.4.1.46": "aes256-GCM",
+
+	// RSA-KEM(RFC5990)
+	"1.2.840.113549.1.9.16.3.14": "id-rsa-kem",
+	"1.0.18033.2.2.4":            "id-kem-rsa",
+
+	// X.500 attributes
+	"2.5.4.3":  "commonName",
+	"2.5.4.5":  "serialNumber",
+	"2.5.4.6":  "countryName",
+	"2.5.4.7":  "localityName",
+	"2.5.4.8":  "stateOrProvinceName",
+	"2.5.4.10": "organizationName",
+	"2.5.4.11": "organizationalUnitName",
+
+	// X.509 extensions
+	"2.5.29.14": "subjectKeyIdentifier",
+	"2.5.29.15": "keyUsage",
+	"2.5.29.17": "subjectAltName",
+	"2.5.29.19": "basicConstraints",
+	"2.5.29.31": "cRLDistributionPoints",
+	"2.5.29.32": "certificatePolicies",
+	"2.5.29.35": "authorityKeyIdentifier",
+	"2.5.29.37": "extKeyUsage",
+
+	"1.3.6.1.5.5.7.1.1":  "authorityInfoAccess",
+	"1.3.6.1.5.5.7.3.1":  "serverAuth",
+	"1.3.6.1.5.5.7.3.2":  "clientAuth",
+	"1.3.6.1.5.5.7.3.3":  "codeSigning",
+	"1.3.6.1.5.5.7.48.1": "ocsp",
+	"1.3.6.1.5.5.7.48.2": "caIssuers",
+}
+
+// OIDName returns the friendly name of the given dotted OID or "" if unknown.
+func OIDName(oid string) string {
+	return oidNames[oid]
+}
+
+// DecodeOID converts the content octets of an OBJECT IDENTIFIER to its
+// dotted string form.
+func DecodeOID(b []byte) (string, error) {
+	if len(b) == 0 {
+		return "", errors.New("empty OID")
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		return "", errors.New("truncated OID")
+	}
+
+	var arcs []string
+	arc := new(big.Int)
+	first := true
+	for _, v := range b {
+		arc.Lsh(arc, 7)
+		arc.Or(arc, big.NewInt(int64(v&0x7f)))
+		if v&0x80 != 0 {
+			continue
+		}
+		if first {
+			// the first subidentifier encodes the first two arcs
+			x := big.NewInt(2)
+			y := new(big.Int)
+			switch {
+			case arc.Cmp(big.NewInt(40)) < 0:
+				x.SetInt64(0)
+				y.Set(arc)
+			case arc.Cmp(big.NewInt(80)) < 0:
+				x.SetInt64(1)
+				y.Sub(arc, big.NewInt(40))
+			default:
+				y.Sub(arc, big.NewInt(80))
+			}
+			arcs = append(arcs, x.String(), y.String())
+			first = false
+		} else {
+			arcs = append(arcs, arc.String())
+		}
+		arc.SetInt64(0)
+	}
+
+	return strings.Join(arcs, "."), nil
+}
@@ -0,0 +1,43 @@
+package asn1
+
+import (
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestDecodeOID(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		for _, input := range []string{"", "2a86", "ff"} {
+			if _, err := DecodeOID(testutil.BytesFromHex(t, input)); err == nil {
+				t.Fatalf("%q: expected error", input)
+			}
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := []struct {
+			input string
+			want  string
+			name  string
+		}{
+			{"2a864886f70d010101", "1.2.840.113549.1.1.1", "rsaEncryption"},
+			{"2b6570", "1.3.101.112", "Ed25519"},
+			{"608648016503040201", "2.16.840.1.101.3.4.2.1", "sha256"},
+			{"0c", "0.12", ""},
+			{"8837", "2.999", ""},
+		}
+		for _, test := range tests {
+			have, err := DecodeOID(testutil.BytesFromHex(t, test.input))
+			if err != nil {
+				t.Fatal(test.input, err)
+			}
+			if have != test.want {
+				t.Fatalf("want %s, have %s", test.want, have)
+			}
+			if name := OIDName(have); name != test.name {
+				t.Fatalf("want %q, have %q", test.name, name)
+			}
+		}
+	})
+}
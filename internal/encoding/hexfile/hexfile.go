@@ -0,0 +1,123 @@
+// Package hexfile decodes and encodes the Intel HEX and Motorola S-record formats used
+// for firmware images.
+package hexfile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Segment is a contiguous block of data starting at Address.
+type Segment struct {
+	Address uint32
+	Data    []byte
+}
+
+// Image returns the data of the segments as one contiguous block starting
+// at the lowest address, the gaps between segments are filled with fill.
+func Image(segments []Segment, fill byte) (address uint32, data []byte, err error) {
+	if len(segments) == 0 {
+		return 0, nil, nil
+	}
+
+	sorted := make([]Segment, len(segments))
+	copy(sorted, segments)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Address < sorted[j].Address
+	})
+
+	start := uint64(sorted[0].Address)
+	end := start
+	for _, s := range sorted {
+		if uint64(s.Address) < end {
+			return 0, nil, fmt.Errorf("overlapping data at address 0x%08x", s.Address)
+		}
+		end = uint64(s.Address) + uint64(len(s.Data))
+	}
+
+	const maxImageSize = 1 << 28
+	if end-start > maxImageSize {
+		return 0, nil, fmt.Errorf("image is too big: 0x%x bytes", end-start)
+	}
+
+	data = bytes.Repeat([]byte{fill}, int(end-start))
+	for _, s := range sorted {
+		copy(data[uint64(s.Address)-start:], s.Data)
+	}
+
+	return uint32(start), data, nil
+}
+
+// Detect returns "ihex", "srec" or "bin" depending on the first character of data.
+func Detect(data []byte) string {
+	s := bytes.TrimSpace(data)
+	if len(s) == 0 {
+		return "bin"
+	}
+	switch s[0] {
+	case ':':
+		if isText(s) {
+			return "ihex"
+		}
+	case 'S':
+		if isText(s) {
+			return "srec"
+		}
+	}
+	return "bin"
+}
+
+func isText(data []byte) bool {
+	for _, c := range data {
+		if c != '\r' && c != '\n' && (c < 0x20 || c > 0x7e) {
+			return false
+		}
+	}
+	return true
+}
+
+// appendData adds data at address, merging it with the last segment if contiguous.
+func appendData(segments []Segment, address uint32, data []byte) []Segment {
+	if len(data) == 0 {
+		return segments
+	}
+	if n := len(segments); n > 0 {
+		last := &segments[n-1]
+		if uint64(last.Address)+uint64(len(last.Data)) == uint64(address) {
+			last.Data = append(last.Data, data...)
+			return segments
+		}
+	}
+	return append(segments, Segment{Address: address, Data: append([]byte{}, data...)})
+}
+
+func lines(data []byte) [][]byte {
+	return bytes.Split(bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n")), []byte("\n"))
+}
+
+// Decode returns the image contained in data and its start address,
+// format is one of bin, ihex, srec or auto.
+// For bin, the data is returned as is, at address 0.
+func Decode(data []byte, format string, fill byte) (address uint32, image []byte, err error) {
+	if format == "auto" {
+		format = Detect(data)
+	}
+
+	var segments []Segment
+	switch format {
+	case "bin":
+		return 0, data, nil
+	case "ihex":
+		segments, err = DecodeIntelHex(data)
+	case "srec":
+		segments, err = DecodeSRecord(data)
+	default:
+		return 0, nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return Image(segments, fill)
+}
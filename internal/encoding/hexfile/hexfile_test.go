@@ -0,0 +1,206 @@
+package hexfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testImage = "214601360121470136007efe09d21901" +
+	"2146017e17c20001ff5f160021480119" +
+	"194e79234623965778239eda3f01b2ca" +
+	"3f0156702b5e712b722b732146013421"
+
+const testIntelHex = `:10010000214601360121470136007EFE09D2190140
+:100110002146017E17C20001FF5F16002148011928
+:10012000194E79234623965778239EDA3F01B2CAA7
+:100130003F0156702B5E712B722B732146013421C7
+:00000001FF
+`
+
+const testSRecord = `S00600004844521B
+S1130100214601360121470136007EFE09D219013C
+S11301102146017E17C20001FF5F16002148011924
+S1130120194E79234623965778239EDA3F01B2CAA3
+S11301303F0156702B5E712B722B732146013421C3
+S5030004F8
+S9030000FC
+`
+
+func expectImage(t *testing.T, data []byte, format string, wantAddress uint32, want string) {
+	t.Helper()
+	address, image, err := Decode(data, format, 0xff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != wantAddress {
+		t.Fatalf("want address 0x%x, have 0x%x", wantAddress, address)
+	}
+	if hex.EncodeToString(image) != want {
+		t.Log("want", want)
+		t.Log("have", hex.EncodeToString(image))
+		t.Fatal("image")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	t.Run("IntelHex", func(t *testing.T) {
+		expectImage(t, []byte(testIntelHex), "ihex", 0x100, testImage)
+		expectImage(t, []byte(strings.ReplaceAll(testIntelHex, "\n", "\r\n")), "auto", 0x100, testImage)
+	})
+
+	t.Run("SRecord", func(t *testing.T) {
+		expectImage(t, []byte(testSRecord), "srec", 0x100, testImage)
+		expectImage(t, []byte(testSRecord), "auto", 0x100, testImage)
+	})
+
+	t.Run("Bin", func(t *testing.T) {
+		expectImage(t, []byte{0x01, 0x02}, "auto", 0, "0102")
+		expectImage(t, []byte(":"), "bin", 0, "3a")
+	})
+
+	t.Run("ExtendedAddressAndGap", func(t *testing.T) {
+		data := ":020000040800F2\n" +
+			":0200000001FFFE\n" +
+			":0100040002F9\n" +
+			":00000001FF\n"
+		expectImage(t, []byte(data), "auto", 0x08000000, "01ffffff02")
+	})
+
+	t.Run("ExtendedSegmentAddress", func(t *testing.T) {
+		data := ":020000021000EC\n" +
+			":0100000055AA\n" +
+			":00000001FF\n"
+		expectImage(t, []byte(data), "ihex", 0x10000, "55")
+	})
+
+	t.Run("S3", func(t *testing.T) {
+		expectImage(t, []byte("S3090800000001020304E4\nS70508000000F2\n"), "auto", 0x08000000, "01020304")
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		if _, _, err := Decode(nil, "elf", 0); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
+func TestDecodeErrors(t *testing.T) {
+	ihex := []string{
+		":10010000214601360121470136007EFE09D2190141\n:00000001FF\n",
+		":10010000214601360121470136007EFE09D21901\n:00000001FF\n",
+		"10010000214601360121470136007EFE09D2190140\n:00000001FF\n",
+		":1001000021460136012147013600ZZFE09D2190140\n:00000001FF\n",
+		":0100000655A4\n:00000001FF\n",
+		":10010000214601360121470136007EFE09D2190140\n",
+		":00000001FF\n:0100000055AA\n",
+		":03000004080000F1\n:00000001FF\n",
+	}
+	for i, data := range ihex {
+		if _, err := DecodeIntelHex([]byte(data)); err == nil {
+			t.Fatalf("ihex %d: expected error", i)
+		}
+	}
+
+	srec := []string{
+		"S1130100214601360121470136007EFE09D219013D\n",
+		"S1130100214601360121470136007EFE09D21901\n",
+		"X1130100214601360121470136007EFE09D219013C\n",
+		"S4030000FC\n",
+		"S30300FC\n",
+		"S\n",
+	}
+	for i, data := range srec {
+		if _, err := DecodeSRecord([]byte(data)); err == nil {
+			t.Fatalf("srec %d: expected error", i)
+		}
+	}
+}
+
+func TestImage(t *testing.T) {
+	address, data, err := Image([]Segment{
+		{Address: 0x10, Data: []byte{3}},
+		{Address: 0x0c, Data: []byte{1, 2}},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address != 0x0c || !bytes.Equal(data, []byte{1, 2, 0, 0, 3}) {
+		t.Fatal("unexpected image", address, data)
+	}
+
+	if _, _, err := Image([]Segment{
+		{Address: 0x10, Data: []byte{1, 2}},
+		{Address: 0x11, Data: []byte{3}},
+	}, 0); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if _, _, err := Image([]Segment{
+		{Address: 0, Data: []byte{1}},
+		{Address: 0xffffff00, Data: []byte{1}},
+	}, 0); err == nil {
+		t.Fatal("expected error")
+	}
+
+	address, data, err = Image(nil, 0)
+	if err != nil || address != 0 || data != nil {
+		t.Fatal("unexpected result for empty image")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	image, _ := hex.DecodeString(testImage)
+
+	t.Run("IntelHex", func(t *testing.T) {
+		out, err := EncodeIntelHex(0x100, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != testIntelHex {
+			t.Fatalf("have:\n%s", out)
+		}
+	})
+
+	t.Run("SRecord", func(t *testing.T) {
+		out, err := EncodeSRecord(0x100, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "S0030000FC\n" +
+			strings.Join(strings.Split(testSRecord, "\n")[1:5], "\n") + "\n" +
+			"S9030100FB\n"
+		if string(out) != want {
+			t.Fatalf("have:\n%s", out)
+		}
+	})
+
+	for _, address := range []uint32{0xfff8, 0xfffff8, 0x8000fff0, 0xffffffc0} {
+		for _, format := range []string{"ihex", "srec"} {
+			t.Run(fmt.Sprintf("%s/0x%x", format, address), func(t *testing.T) {
+				var out []byte
+				var err error
+				if format == "ihex" {
+					out, err = EncodeIntelHex(address, image)
+				} else {
+					out, err = EncodeSRecord(address, image)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				expectImage(t, out, "auto", address, testImage)
+			})
+		}
+	}
+
+	t.Run("Overflow", func(t *testing.T) {
+		if _, err := EncodeIntelHex(0xfffffff0, image); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := EncodeSRecord(0xfffffff0, image); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
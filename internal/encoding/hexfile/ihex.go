@@ -0,0 +1,124 @@
+package hexfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	ihexData                   = 0x00
+	ihexEndOfFile              = 0x01
+	ihexExtendedSegmentAddress = 0x02
+	ihexStartSegmentAddress    = 0x03
+	ihexExtendedLinearAddress  = 0x04
+	ihexStartLinearAddress     = 0x05
+)
+
+// DecodeIntelHex decodes the data records of an Intel HEX file.
+func DecodeIntelHex(data []byte) ([]Segment, error) {
+	var segments []Segment
+	var base uint32
+	eof := false
+
+	for i, line := range lines(data) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if eof {
+			return nil, fmt.Errorf("line %d: data after end of file record", i+1)
+		}
+		if line[0] != ':' {
+			return nil, fmt.Errorf("line %d: missing start code", i+1)
+		}
+		b, err := hex.DecodeString(string(line[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(b) < 5 || len(b) != int(b[0])+5 {
+			return nil, fmt.Errorf("line %d: invalid record length", i+1)
+		}
+		var sum byte
+		for _, v := range b {
+			sum += v
+		}
+		if sum != 0 {
+			return nil, fmt.Errorf("line %d: invalid checksum", i+1)
+		}
+
+		offset := uint32(b[1])<<8 | uint32(b[2])
+		payload := b[4 : len(b)-1]
+
+		switch b[3] {
+		case ihexData:
+			address := base + offset
+			if uint64(address)+uint64(len(payload)) > 1<<32 {
+				return nil, fmt.Errorf("line %d: address overflow", i+1)
+			}
+			segments = appendData(segments, address, payload)
+		case ihexEndOfFile:
+			eof = true
+		case ihexExtendedSegmentAddress:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended segment address", i+1)
+			}
+			base = (uint32(payload[0])<<8 | uint32(payload[1])) << 4
+		case ihexExtendedLinearAddress:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("line %d: invalid extended linear address", i+1)
+			}
+			base = (uint32(payload[0])<<8 | uint32(payload[1])) << 16
+		case ihexStartSegmentAddress, ihexStartLinearAddress:
+			// execution start address, not part of the image
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type 0x%02x", i+1, b[3])
+		}
+	}
+
+	if !eof {
+		return nil, errors.New("missing end of file record")
+	}
+
+	return segments, nil
+}
+
+// EncodeIntelHex encodes data, loaded at address, as Intel HEX with 16 bytes
+// per data record. Extended linear address records are added as needed.
+func EncodeIntelHex(address uint32, data []byte) ([]byte, error) {
+	if uint64(address)+uint64(len(data)) > 1<<32 {
+		return nil, errors.New("address overflow")
+	}
+
+	var out bytes.Buffer
+	base := uint32(0)
+	for len(data) > 0 {
+		if address&0xffff0000 != base {
+			base = address & 0xffff0000
+			writeIntelHexRecord(&out, 0, ihexExtendedLinearAddress, []byte{byte(base >> 24), byte(base >> 16)})
+		}
+		n := min(len(data), 16)
+		// a record cannot cross a 64 KiB boundary
+		if end := uint64(address&0xffff) + uint64(n); end > 0x10000 {
+			n -= int(end - 0x10000)
+		}
+		writeIntelHexRecord(&out, uint16(address), ihexData, data[:n])
+		data = data[n:]
+		address += uint32(n)
+	}
+	writeIntelHexRecord(&out, 0, ihexEndOfFile, nil)
+
+	return out.Bytes(), nil
+}
+
+func writeIntelHexRecord(out *bytes.Buffer, offset uint16, recordType byte, payload []byte) {
+	b := []byte{byte(len(payload)), byte(offset >> 8), byte(offset), recordType}
+	b = append(b, payload...)
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	b = append(b, -sum)
+	fmt.Fprintf(out, ":%X\n", b)
+}
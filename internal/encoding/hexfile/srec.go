@@ -0,0 +1,119 @@
+package hexfile
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// DecodeSRecord decodes the data records(S1, S2, S3) of a Motorola S-record file.
+func DecodeSRecord(data []byte) ([]Segment, error) {
+	var segments []Segment
+
+	for i, line := range lines(data) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[0] != 'S' {
+			return nil, fmt.Errorf("line %d: missing start code", i+1)
+		}
+		recordType := line[1]
+		b, err := hex.DecodeString(string(line[2:]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		if len(b) < 1 || len(b) != int(b[0])+1 {
+			return nil, fmt.Errorf("line %d: invalid record length", i+1)
+		}
+		var sum byte
+		for _, v := range b {
+			sum += v
+		}
+		if sum != 0xff {
+			return nil, fmt.Errorf("line %d: invalid checksum", i+1)
+		}
+
+		var addressLen int
+		switch recordType {
+		case '0', '1', '5', '9':
+			addressLen = 2
+		case '2', '6', '8':
+			addressLen = 3
+		case '3', '7':
+			addressLen = 4
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type S%c", i+1, recordType)
+		}
+		if len(b) < 2+addressLen {
+			return nil, fmt.Errorf("line %d: invalid record length", i+1)
+		}
+
+		var address uint32
+		for _, v := range b[1 : 1+addressLen] {
+			address = address<<8 | uint32(v)
+		}
+		payload := b[1+addressLen : len(b)-1]
+
+		switch recordType {
+		case '1', '2', '3':
+			if uint64(address)+uint64(len(payload)) > 1<<32 {
+				return nil, fmt.Errorf("line %d: address overflow", i+1)
+			}
+			segments = appendData(segments, address, payload)
+		default:
+			// header, record count and start address are not part of the image
+		}
+	}
+
+	return segments, nil
+}
+
+// EncodeSRecord encodes data, loaded at address, as Motorola S-record with
+// 16 bytes per data record. The smallest record type(S1, S2 or S3) that can
+// hold the last address is used, the start address record points to address.
+func EncodeSRecord(address uint32, data []byte) ([]byte, error) {
+	end := uint64(address) + uint64(len(data))
+	if end > 1<<32 {
+		return nil, errors.New("address overflow")
+	}
+
+	var dataType, startType byte
+	var addressLen int
+	switch {
+	case end <= 1<<16:
+		dataType, startType, addressLen = '1', '9', 2
+	case end <= 1<<24:
+		dataType, startType, addressLen = '2', '8', 3
+	default:
+		dataType, startType, addressLen = '3', '7', 4
+	}
+
+	start := address
+	var out bytes.Buffer
+	writeSRecord(&out, '0', 2, 0, nil)
+	for len(data) > 0 {
+		n := min(len(data), 16)
+		writeSRecord(&out, dataType, addressLen, address, data[:n])
+		data = data[n:]
+		address += uint32(n)
+	}
+	writeSRecord(&out, startType, addressLen, start, nil)
+
+	return out.Bytes(), nil
+}
+
+func writeSRecord(out *bytes.Buffer, recordType byte, addressLen int, address uint32, payload []byte) {
+	b := []byte{byte(addressLen + len(payload) + 1)}
+	for i := addressLen - 1; i >= 0; i-- {
+		b = append(b, byte(address>>(8*i)))
+	}
+	b = append(b, payload...)
+	var sum byte
+	for _, v := range b {
+		sum += v
+	}
+	b = append(b, ^sum)
+	fmt.Fprintf(out, "S%c%X\n", recordType, b)
+}
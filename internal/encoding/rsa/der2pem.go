@@ -5,6 +5,7 @@ import (
 	"errors"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
@@ -20,7 +21,10 @@ Convert RSA key from PKCS#1 ASN.1 DER to PEM.
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
 
-DER input must be specified in binary form.
+DER input is read in binary form, use -in-format for another encoding.
+
+If -bin or -out-format is specified, the PEM is written in that format,
+e.g. as a C array of its text.
 `,
 }
 
@@ -28,7 +32,9 @@ func runDer2Pem(cmd *cmd.Command) error {
 	fPriv := cmd.Flags.Bool("priv", false, "Encode PrivateKey from given input.")
 	fPub := cmd.Flags.Bool("pub", false, "Encode PublicKey from given input.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -37,13 +43,14 @@ func runDer2Pem(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	fOut.Secret = *fPriv
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -64,5 +71,19 @@ func runDer2Pem(cmd *cmd.Command) error {
 		Bytes: input,
 	}
 
-	return pem.Encode(sf.Out, block)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"pem": string(pem.EncodeToMemory(block))})
+	}
+
+	if fOut.IsSet() {
+		data := pem.EncodeToMemory(block)
+		defer secret.Wipe(data)
+		return sf.Write(data, fOut)
+	}
+
+	if err := pem.Encode(sf.Out, block); err != nil {
+		return err
+	}
+
+	return sf.Commit()
 }
@@ -5,8 +5,12 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"os"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
 var Der2RawCmd = &cmd.Command{
@@ -14,17 +18,29 @@ var Der2RawCmd = &cmd.Command{
 	Run:   runDer2Raw,
 	Brief: "Convert RSA key from PKCS#1 ASN.1 DER to raw values(n, e, d, p, q)",
 
-	Usage: `pocryp rsa-der2raw -priv/-pub DER
+	Usage: `Usage: pocryp rsa-der2raw [-json] -priv/-pub [-in INPUT] [-in-format FORMAT] [DER]
 
 Convert RSA key from PKCS#1 ASN.1 DER to raw values(n, e, d, p, q).
+For private keys, the additional primes of multi-prime keys and
+the CRT values(dp, dq, qinv) are printed as well.
+The public exponent is printed as decimal, the other values as hex, so they
+can be given to rsa-raw2der.
 
-DER must be specified in hex form.
+If -json(or the global --json) is specified, the values are printed as a JSON
+object which can be given to 'rsa-raw2der -json'.
+
+DER must be specified in hex form. If DER is not specified, the key is read
+from INPUT, in binary form unless -in-format is specified.
+If -in is not specified, stdin will be read.
 `,
 }
 
 func runDer2Raw(cmd *cmd.Command) error {
 	fPriv := cmd.Flags.Bool("priv", false, "Encode PrivateKey from given input.")
 	fPub := cmd.Flags.Bool("pub", false, "Encode PublicKey from given input.")
+	fJSON := cmd.Flags.Bool("json", false, "Print the values as JSON.")
+	fInput := cmd.Flags.String("in", "", "Read the DER from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -33,15 +49,31 @@ func runDer2Raw(cmd *cmd.Command) error {
 		return err
 	}
 
-	if cmd.Flags.NArg() != 1 {
+	var input []byte
+	switch cmd.Flags.NArg() {
+	case 0:
+		sf, err := stdfile.New(*fInput, "", stdfile.Options{})
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		if input, err = sf.ReadAs(fInFormat); err != nil {
+			return err
+		}
+	case 1:
+		if *fInput != "" {
+			cmd.Flags.Usage()
+			return errors.New("cannot specify DER and -in at the same time")
+		}
+		var err error
+		if input, err = hex.DecodeString(cmd.Flags.Arg(0)); err != nil {
+			return err
+		}
+	default:
 		cmd.Flags.Usage()
-		return errors.New("DER hex string not specified")
-	}
-
-	input, err := hex.DecodeString(cmd.Flags.Arg(0))
-	if err != nil {
-		return err
+		return errors.New("too many arguments")
 	}
+	defer secret.Wipe(input)
 
 	switch {
 	case *fPriv:
@@ -49,18 +81,30 @@ func runDer2Raw(cmd *cmd.Command) error {
 		if err != nil {
 			return err
 		}
+		if *fJSON || cmd.JSON {
+			return printJSON(util.ComponentsFromPrivateKey(key))
+		}
 		fmt.Printf("n=%s\n", hex.EncodeToString(key.N.Bytes()))
-		fmt.Printf("e=%x\n", key.E)
+		fmt.Printf("e=%d\n", key.E)
 		fmt.Printf("d=%s\n", hex.EncodeToString(key.D.Bytes()))
 		fmt.Printf("p=%s\n", hex.EncodeToString(key.Primes[0].Bytes()))
 		fmt.Printf("q=%s\n", hex.EncodeToString(key.Primes[1].Bytes()))
+		for _, prime := range key.Primes[2:] {
+			fmt.Printf("prime=%s\n", hex.EncodeToString(prime.Bytes()))
+		}
+		fmt.Printf("dp=%s\n", hex.EncodeToString(key.Precomputed.Dp.Bytes()))
+		fmt.Printf("dq=%s\n", hex.EncodeToString(key.Precomputed.Dq.Bytes()))
+		fmt.Printf("qinv=%s\n", hex.EncodeToString(key.Precomputed.Qinv.Bytes()))
 	case *fPub:
 		key, err := x509.ParsePKCS1PublicKey(input)
 		if err != nil {
 			return err
 		}
+		if *fJSON || cmd.JSON {
+			return printJSON(util.ComponentsFromPublicKey(key))
+		}
 		fmt.Printf("n=%s\n", hex.EncodeToString(key.N.Bytes()))
-		fmt.Printf("e=%x\n", key.E)
+		fmt.Printf("e=%d\n", key.E)
 	default:
 		cmd.Flags.Usage()
 		return errors.New("need to specify one of -priv or -pub")
@@ -68,3 +112,7 @@ func runDer2Raw(cmd *cmd.Command) error {
 
 	return nil
 }
+
+func printJSON(c util.KeyComponents) error {
+	return stdfile.WriteJSON(os.Stdout, c)
+}
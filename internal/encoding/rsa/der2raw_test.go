@@ -0,0 +1,63 @@
+package rsa
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestDer2Raw(t *testing.T) {
+	key, err := util.PrivateKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_private_key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv := hex.EncodeToString(x509.MarshalPKCS1PrivateKey(key))
+	pub := hex.EncodeToString(x509.MarshalPKCS1PublicKey(&key.PublicKey))
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"MissingIn", []string{"-priv", "-in", "testdata/missing"}},
+			{"NotHex", []string{"-priv", "xyz"}},
+			{"NoPrivOrPub", []string{priv}},
+			{"PubAsPriv", []string{"-priv", pub}},
+			{"DERAndIn", []string{"-priv", "-in", "foo", priv}},
+			{"TooManyArgs", []string{"-priv", priv, priv}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if err := testutil.RunCmd(Der2RawCmd, test.args...); err == nil {
+					t.Fatal("expected error")
+				}
+			})
+		}
+	})
+
+	tmp := t.TempDir()
+	in := filepath.Join(tmp, "in")
+	pubIn := filepath.Join(tmp, "pub")
+	testutil.SetupIn(t, in, x509.MarshalPKCS1PrivateKey(key))
+	testutil.SetupIn(t, pubIn, []byte(pub))
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := [][]string{
+			{"-priv", priv},
+			{"-priv", "-json", priv},
+			{"-pub", pub},
+			{"-pub", "-json", pub},
+			{"-priv", "-in", in},
+			{"-pub", "-in", pubIn, "-in-format", "hex"},
+		}
+		for _, args := range tests {
+			if err := testutil.RunCmd(Der2RawCmd, args...); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
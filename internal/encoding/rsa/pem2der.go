@@ -25,7 +25,8 @@ If -out is not specified, the output will be printed to stdout.
 func runPem2Der(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
-	fBin := cmd.Flags.Bool("bin", false, "Write output as binary not hex.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -34,13 +35,14 @@ func runPem2Der(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	fOut.Secret = true
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -50,5 +52,9 @@ func runPem2Der(cmd *cmd.Command) error {
 		return errors.New("failed to parse PEM block")
 	}
 
-	return sf.WriteHexOrBin(block.Bytes, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"type": block.Type, "der": stdfile.Hex(block.Bytes)})
+	}
+
+	return sf.Write(block.Bytes, fOut)
 }
@@ -1,14 +1,17 @@
 package rsa
 
 import (
-	"crypto/rsa"
 	"crypto/x509"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"math/big"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
 var Raw2DerCmd = &cmd.Command{
@@ -16,9 +19,31 @@ var Raw2DerCmd = &cmd.Command{
 	Run:   runRaw2Der,
 	Brief: "Convert RSA key from raw values(n, e, d, p, q) to PKCS#1 ASN.1 DER",
 
-	Usage: `Usage: pocryp rsa-raw2der [-priv|-pub] -n modulus [-e publicExponent] -d privateExponent [-p prime1 -q prime2]
+	Usage: `Usage: pocryp rsa-raw2der [-priv|-pub] [-n modulus] -e publicExponent [-d privateExponent] [-p prime1 -q prime2 [-prime primeN]...] [-dp exponent1 -dq exponent2 -qinv coefficient] [-out OUTPUT]
+       pocryp rsa-raw2der [-priv|-pub] -json [-in INPUT] [-out OUTPUT]
 
 Convert RSA key from raw values(n, e, d, p, q) to PKCS#1 ASN.1 DER.
+
+For private keys, the missing values are derived from the given ones:
+  - p and q are recovered from n, e and d
+  - d is computed from e and the primes
+  - n is computed from the primes
+If specified, the CRT values(dP, dQ, qInv) are checked against the computed ones.
+Multi-prime keys are supported by specifying the additional primes with -prime.
+
+The key is validated before encoding: the product of the primes must be n
+and d·e must be congruent to 1 mod λ(n).
+
+The public exponent accepts decimal or 0x prefixed hex values.
+
+If -json is specified, the values are read from INPUT as a JSON object, e.g.:
+  {"n": "c1f3...", "e": "010001", "d": "...", "p": "...", "q": "...",
+   "otherPrimes": ["..."], "dP": "...", "dQ": "...", "qInv": "..."}
+All values are hex strings, the missing ones can be omitted.
+This is the format printed by 'rsa-der2raw -json'.
+If -in is not specified, stdin will be read.
+
+If -out is not specified, the output will be printed to stdout.
 `,
 }
 
@@ -26,10 +51,22 @@ func runRaw2Der(cmd *cmd.Command) error {
 	fPriv := cmd.Flags.Bool("priv", false, "Encode PrivateKey from given inputs.")
 	fPub := cmd.Flags.Bool("pub", false, "Encode PublicKey from given inputs.")
 	fMod := cmd.Flags.String("n", "", "Modulus as hex string")
-	fPubExp := cmd.Flags.Int("e", 0, "Public exponent as integer")
+	fPubExp := cmd.Flags.String("e", "", "Public exponent as decimal or 0x prefixed hex")
 	fPrivExp := cmd.Flags.String("d", "", "Private exponent as hex string")
 	fPrime1 := cmd.Flags.String("p", "", "First prime number as hex string")
 	fPrime2 := cmd.Flags.String("q", "", "Second prime number as hex string")
+	fDp := cmd.Flags.String("dp", "", "First CRT exponent(d mod (p-1)) as hex string")
+	fDq := cmd.Flags.String("dq", "", "Second CRT exponent(d mod (q-1)) as hex string")
+	fQinv := cmd.Flags.String("qinv", "", "CRT coefficient(q^-1 mod p) as hex string")
+	fJSON := cmd.Flags.Bool("json", false, "Read the values as JSON from INPUT.")
+	fInput := cmd.Flags.String("in", "", "Read JSON from the file at path INPUT.")
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+	var otherPrimes []string
+	cmd.Flags.Func("prime", "Additional prime number as hex string, can be repeated", func(s string) error {
+		otherPrimes = append(otherPrimes, s)
+		return nil
+	})
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -38,77 +75,107 @@ func runRaw2Der(cmd *cmd.Command) error {
 		return err
 	}
 
-	if *fMod == "" {
-		cmd.Flags.Usage()
-		return errors.New("modulus not specified, use -n to specify it")
-	}
-
 	if *fPub && *fPriv {
 		cmd.Flags.Usage()
 		return errors.New("cannot specify -priv and -pub at the same time, choose one")
 	}
 
-	nBytes, err := hex.DecodeString(*fMod)
-	if err != nil {
-		return err
-	}
-	n := new(big.Int)
-	n.SetBytes(nBytes)
-
-	var result []byte
-	switch {
-	case *fPriv:
-		if *fPubExp == 0 {
+	var c util.KeyComponents
+	if *fJSON {
+		var err error
+		cmd.Flags.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "priv", "pub", "json", "in", "out", "force", "bin", "out-format", "load-address", "var-name":
+			default:
+				err = fmt.Errorf("cannot use -%s together with -json", f.Name)
+			}
+		})
+		if err != nil {
 			cmd.Flags.Usage()
-			return errors.New("-e is needed")
+			return err
 		}
-		if *fPrivExp == "" {
-			cmd.Flags.Usage()
-			return errors.New("-d is needed")
+		sf, err := stdfile.New(*fInput, "", stdfile.Options{})
+		if err != nil {
+			return err
 		}
-		if *fPrime1 == "" {
-			cmd.Flags.Usage()
-			return errors.New("-p is needed")
+		defer sf.Close()
+		if err := json.NewDecoder(sf.In).Decode(&c); err != nil {
+			return err
 		}
-		if *fPrime2 == "" {
+		if c.E == nil {
+			return errors.New("e is needed")
+		}
+	} else {
+		if *fPubExp == "" {
 			cmd.Flags.Usage()
-			return errors.New("-q is needed")
+			return errors.New("-e is needed")
 		}
-		dBytes, err := hex.DecodeString(*fPrivExp)
-		if err != nil {
-			return err
+		e, ok := new(big.Int).SetString(*fPubExp, 0)
+		if !ok {
+			return fmt.Errorf("invalid public exponent %q", *fPubExp)
 		}
-		d := new(big.Int)
-		d.SetBytes(dBytes)
-		pBytes, err := hex.DecodeString(*fPrime1)
-		if err != nil {
-			return err
+		c.E = e
+
+		hexValues := []struct {
+			name  string
+			value string
+			dst   **big.Int
+		}{
+			{"n", *fMod, &c.N},
+			{"d", *fPrivExp, &c.D},
+			{"dp", *fDp, &c.Dp},
+			{"dq", *fDq, &c.Dq},
+			{"qinv", *fQinv, &c.Qinv},
 		}
-		p := new(big.Int)
-		p.SetBytes(pBytes)
-		qBytes, err := hex.DecodeString(*fPrime2)
+		for _, v := range hexValues {
+			if v.value == "" {
+				continue
+			}
+			i, err := bigIntFromHex(v.value)
+			if err != nil {
+				return fmt.Errorf("-%s: %w", v.name, err)
+			}
+			*v.dst = i
+		}
+
+		if *fPrime1 != "" || *fPrime2 != "" {
+			if *fPrime1 == "" {
+				cmd.Flags.Usage()
+				return errors.New("-p is needed")
+			}
+			if *fPrime2 == "" {
+				cmd.Flags.Usage()
+				return errors.New("-q is needed")
+			}
+			for _, v := range append([]string{*fPrime1, *fPrime2}, otherPrimes...) {
+				prime, err := bigIntFromHex(v)
+				if err != nil {
+					return fmt.Errorf("prime: %w", err)
+				}
+				c.Primes = append(c.Primes, prime)
+			}
+		} else if len(otherPrimes) != 0 {
+			cmd.Flags.Usage()
+			return errors.New("-prime needs -p and -q")
+		}
+	}
+
+	var result []byte
+	switch {
+	case *fPriv:
+		key, err := util.NewPrivateKey(c)
 		if err != nil {
 			return err
 		}
-		q := new(big.Int)
-		q.SetBytes(qBytes)
-		key := &rsa.PrivateKey{
-			PublicKey: rsa.PublicKey{
-				N: n,
-				E: *fPubExp,
-			},
-			D:      d,
-			Primes: []*big.Int{p, q},
-		}
 		result = x509.MarshalPKCS1PrivateKey(key)
 	case *fPub:
-		if *fPubExp == 0 {
+		if c.N == nil {
 			cmd.Flags.Usage()
-			return errors.New("-e is needed")
+			return errors.New("modulus not specified, use -n to specify it")
 		}
-		key := &rsa.PublicKey{
-			N: n,
-			E: *fPubExp,
+		key, err := util.NewPublicKey(c)
+		if err != nil {
+			return err
 		}
 		result = x509.MarshalPKCS1PublicKey(key)
 	default:
@@ -116,7 +183,24 @@ func runRaw2Der(cmd *cmd.Command) error {
 		return errors.New("need to specify one of -priv or -pub")
 	}
 
-	fmt.Println(hex.EncodeToString(result))
+	fOut.Secret = *fPriv
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
 
-	return nil
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"der": stdfile.Hex(result)})
+	}
+
+	return sf.Write(result, fOut)
+}
+
+func bigIntFromHex(s string) (*big.Int, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
 }
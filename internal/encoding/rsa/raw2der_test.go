@@ -0,0 +1,105 @@
+package rsa
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestRaw2Der(t *testing.T) {
+	key, err := util.PrivateKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_private_key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := hex.EncodeToString(key.N.Bytes())
+	d := hex.EncodeToString(key.D.Bytes())
+	p := hex.EncodeToString(key.Primes[0].Bytes())
+	q := hex.EncodeToString(key.Primes[1].Bytes())
+	dp := hex.EncodeToString(key.Precomputed.Dp.Bytes())
+	dq := hex.EncodeToString(key.Precomputed.Dq.Bytes())
+	qinv := hex.EncodeToString(key.Precomputed.Qinv.Bytes())
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"NoPrivOrPub", []string{"-n", n, "-e", "65537"}},
+			{"PrivAndPub", []string{"-priv", "-pub", "-n", n, "-e", "65537"}},
+			{"NoE", []string{"-pub", "-n", n}},
+			{"InvalidE", []string{"-pub", "-n", n, "-e", "foo"}},
+			{"PubNoN", []string{"-pub", "-e", "65537"}},
+			{"InvalidHex", []string{"-priv", "-n", "xyz", "-e", "65537", "-d", d}},
+			{"OnlyP", []string{"-priv", "-e", "65537", "-p", p}},
+			{"OnlyQ", []string{"-priv", "-e", "65537", "-q", q}},
+			{"PrimeWithoutPQ", []string{"-priv", "-e", "65537", "-prime", p}},
+			{"WrongD", []string{"-priv", "-n", n, "-e", "3", "-d", d, "-p", p, "-q", q}},
+			{"WrongDp", []string{"-priv", "-e", "65537", "-p", p, "-q", q, "-dp", dq}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if err := testutil.RunCmd(Raw2DerCmd, test.args...); err == nil {
+					t.Fatal("expected error")
+				}
+			})
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		tmp := t.TempDir()
+		in := filepath.Join(tmp, "in")
+
+		b, err := json.Marshal(util.ComponentsFromPrivateKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		testutil.SetupIn(t, in, b)
+
+		if err := testutil.RunCmd(Raw2DerCmd, "-priv", "-json", "-in", in); err != nil {
+			t.Fatal(err)
+		}
+		if err := testutil.RunCmd(Raw2DerCmd, "-pub", "-json", "-in", in); err != nil {
+			t.Fatal(err)
+		}
+		if err := testutil.RunCmd(Raw2DerCmd, "-priv", "-json", "-in", in, "-n", n); err == nil {
+			t.Fatal("expected error")
+		}
+
+		testutil.SetupIn(t, in, []byte(`{"n":"`+n+`"}`))
+		if err := testutil.RunCmd(Raw2DerCmd, "-pub", "-json", "-in", in); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := []struct {
+			name string
+			args []string
+		}{
+			{"Pub", []string{"-pub", "-n", n, "-e", "0x10001"}},
+			{"PrivAll", []string{"-priv", "-n", n, "-e", "65537", "-d", d, "-p", p, "-q", q, "-dp", dp, "-dq", dq, "-qinv", qinv}},
+			{"PrivRecoverPrimes", []string{"-priv", "-n", n, "-e", "65537", "-d", d}},
+			{"PrivFromPrimes", []string{"-priv", "-e", "65537", "-p", p, "-q", q}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if err := testutil.RunCmd(Raw2DerCmd, test.args...); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+
+	t.Run("Out", func(t *testing.T) {
+		out := filepath.Join(t.TempDir(), "out")
+		if err := testutil.RunCmd(Raw2DerCmd, "-pub", "-n", n, "-e", "65537", "-bin", "-out", out); err != nil {
+			t.Fatal(err)
+		}
+		testutil.ExpectFileContent(t, out, x509.MarshalPKCS1PublicKey(&key.PublicKey))
+	})
+}
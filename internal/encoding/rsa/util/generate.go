@@ -0,0 +1,135 @@
+package util
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+const (
+	MinKeyBits = 1024
+	MaxKeyBits = 16384
+
+	// minPrimeBits is the minimum size of the primes of multi-prime keys
+	minPrimeBits = 256
+)
+
+// CheckKeyParams returns an error if GenerateKey cannot generate a key of
+// the given size, number of primes and public exponent.
+func CheckKeyParams(bits, nprimes, e int) error {
+	if bits < MinKeyBits || bits > MaxKeyBits {
+		return fmt.Errorf("key size must be between %d and %d bits", MinKeyBits, MaxKeyBits)
+	}
+	if nprimes < 2 {
+		return errors.New("need at least two primes")
+	}
+	if bits/nprimes < minPrimeBits {
+		return fmt.Errorf("too many primes for %d bits, every prime needs at least %d bits", bits, minPrimeBits)
+	}
+	if e < 3 || e%2 == 0 {
+		return errors.New("public exponent must be odd and at least 3")
+	}
+	return nil
+}
+
+// GenerateKey generates a RSA key of the given size, with the given public
+// exponent and number of primes, reading the randomness from random.
+//
+// Unlike rsa.GenerateKey, it uses only the bytes read from random, so the
+// result is deterministic if random is deterministic. The primes differ by
+// more than 2^(size of the primes - 100).
+func GenerateKey(random io.Reader, bits, nprimes, e int) (*rsa.PrivateKey, error) {
+	if err := CheckKeyParams(bits, nprimes, e); err != nil {
+		return nil, err
+	}
+
+	bigE := big.NewInt(int64(e))
+
+	for {
+		primes := make([]*big.Int, nprimes)
+		remaining := bits
+		for i := range primes {
+			primeBits := remaining / (nprimes - i)
+			prime, err := generatePrime(random, primeBits, bigE)
+			if err != nil {
+				return nil, err
+			}
+			primes[i] = prime
+			remaining -= primeBits
+		}
+
+		n := new(big.Int).Set(bigOne)
+		distinct := true
+		for i, prime := range primes {
+			for _, other := range primes[:i] {
+				if !farApart(prime, other) {
+					distinct = false
+				}
+			}
+			n.Mul(n, prime)
+		}
+		if !distinct || n.BitLen() != bits {
+			continue
+		}
+
+		return NewPrivateKey(KeyComponents{
+			N:      n,
+			E:      bigE,
+			Primes: primes,
+		})
+	}
+}
+
+// minPrimeDistanceBits is subtracted from the size of the smaller prime to
+// get the minimum size of |p-q|, as in FIPS 186-4 B.3.3, so the key cannot
+// be factored with Fermat's method.
+const minPrimeDistanceBits = 100
+
+// farApart returns true if |p-q| > 2^(bits-100), where bits is the size of
+// the smaller of p and q.
+func farApart(p, q *big.Int) bool {
+	bits := min(p.BitLen(), q.BitLen())
+	d := new(big.Int).Sub(p, q)
+	return d.Abs(d).BitLen() > bits-minPrimeDistanceBits
+}
+
+// generatePrime returns a prime p of exactly bits size, with the two most
+// significant bits set and gcd(p-1, e) = 1.
+func generatePrime(random io.Reader, bits int, e *big.Int) (*big.Int, error) {
+	b := make([]byte, (bits+7)/8)
+	// number of bits to clear in the first byte
+	extra := uint(len(b)*8 - bits)
+
+	p := new(big.Int)
+	pMinusOne := new(big.Int)
+	gcd := new(big.Int)
+
+	for {
+		if _, err := io.ReadFull(random, b); err != nil {
+			return nil, err
+		}
+
+		b[0] &= byte(0xff >> extra)
+		// set the two most significant bits, so the product of two primes has the full size
+		if extra < 7 {
+			b[0] |= 0xc0 >> extra
+		} else {
+			b[0] |= 0x01
+			b[1] |= 0x80
+		}
+		b[len(b)-1] |= 1
+
+		p.SetBytes(b)
+
+		pMinusOne.Sub(p, bigOne)
+		if gcd.GCD(nil, nil, pMinusOne, e).Cmp(bigOne) != 0 {
+			continue
+		}
+
+		if p.ProbablyPrime(20) {
+			return p, nil
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/big"
+	"testing"
+)
+
+func TestGenerateKey(t *testing.T) {
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name             string
+			bits, nprimes, e int
+		}{
+			{"TooSmall", 512, 2, 65537},
+			{"TooBig", MaxKeyBits + 1, 2, 65537},
+			{"OnePrime", 2048, 1, 65537},
+			{"TooManyPrimes", 1024, 5, 65537},
+			{"EvenExponent", 2048, 2, 65536},
+			{"SmallExponent", 2048, 2, 1},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if _, err := GenerateKey(rand.Reader, test.bits, test.nprimes, test.e); err == nil {
+					t.Fatal("expected error")
+				}
+			})
+		}
+	})
+
+	t.Run("ReadError", func(t *testing.T) {
+		if _, err := GenerateKey(bytes.NewReader(nil), 1024, 2, 65537); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := []struct {
+			bits, nprimes, e int
+		}{
+			{1024, 2, 65537},
+			{1025, 2, 3},
+			{2048, 4, 65537},
+		}
+		for _, test := range tests {
+			key, err := GenerateKey(rand.Reader, test.bits, test.nprimes, test.e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.N.BitLen() != test.bits {
+				t.Fatalf("bits: want %d, have %d", test.bits, key.N.BitLen())
+			}
+			if len(key.Primes) != test.nprimes {
+				t.Fatalf("primes: want %d, have %d", test.nprimes, len(key.Primes))
+			}
+			if key.E != test.e {
+				t.Fatalf("e: want %d, have %d", test.e, key.E)
+			}
+		}
+	})
+}
+
+func TestFarApart(t *testing.T) {
+	p := new(big.Int).Lsh(bigOne, 511)
+	q := new(big.Int).Add(p, new(big.Int).Lsh(bigOne, 400))
+	if farApart(p, q) {
+		t.Fatal("primes which differ by 2^400 must be refused")
+	}
+	q.Add(p, new(big.Int).Lsh(bigOne, 420))
+	if !farApart(p, q) || !farApart(q, p) {
+		t.Fatal("primes which differ by 2^420 must be accepted")
+	}
+}
@@ -0,0 +1,432 @@
+package util
+
+import (
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// KeyComponents contains the raw values of an RSA key.
+// Any of them can be nil, see NewPrivateKey for what can be derived.
+type KeyComponents struct {
+	N *big.Int
+	E *big.Int
+	D *big.Int
+
+	// Primes contains p, q and, for multi-prime keys, r_3...r_u
+	Primes []*big.Int
+
+	// CRT values, used only to check consistency
+	Dp   *big.Int
+	Dq   *big.Int
+	Qinv *big.Int
+}
+
+var (
+	bigZero = big.NewInt(0)
+	bigOne  = big.NewInt(1)
+	bigTwo  = big.NewInt(2)
+)
+
+// NewPrivateKey creates a private key from the given components.
+//
+// E is always needed. The modulus is computed from the primes if missing.
+// If the primes are missing, they are recovered from n, e and d(two-prime keys only).
+// If d is missing, it is computed from e and the primes.
+// The CRT values are always computed and, if given, checked against the computed ones.
+//
+// The resulting key is validated with ValidatePrivateKey.
+func NewPrivateKey(c KeyComponents) (*rsa.PrivateKey, error) {
+	if c.E == nil {
+		return nil, errors.New("public exponent is missing")
+	}
+	e, err := exponentToInt(c.E)
+	if err != nil {
+		return nil, err
+	}
+
+	primes := c.Primes
+	n := c.N
+
+	switch {
+	case len(primes) == 0:
+		if n == nil || c.D == nil {
+			return nil, errors.New("need the primes or both n and d")
+		}
+		p, q, err := RecoverPrimes(n, c.E, c.D)
+		if err != nil {
+			return nil, err
+		}
+		primes = []*big.Int{p, q}
+	case len(primes) == 1:
+		return nil, errors.New("need at least two primes")
+	}
+
+	if n == nil {
+		n = new(big.Int).Set(bigOne)
+		for _, prime := range primes {
+			n.Mul(n, prime)
+		}
+	}
+
+	d := c.D
+	if d == nil {
+		d = new(big.Int).ModInverse(c.E, carmichael(primes))
+		if d == nil {
+			return nil, errors.New("public exponent is not invertible modulo λ(n)")
+		}
+	}
+
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: n,
+			E: e,
+		},
+		D:      d,
+		Primes: primes,
+	}
+
+	if err := ValidatePrivateKey(key); err != nil {
+		return nil, err
+	}
+
+	key.Precompute()
+
+	if c.Dp != nil && c.Dp.Cmp(key.Precomputed.Dp) != 0 {
+		return nil, errors.New("dP does not match d mod (p-1)")
+	}
+	if c.Dq != nil && c.Dq.Cmp(key.Precomputed.Dq) != 0 {
+		return nil, errors.New("dQ does not match d mod (q-1)")
+	}
+	if c.Qinv != nil && c.Qinv.Cmp(key.Precomputed.Qinv) != 0 {
+		return nil, errors.New("qInv does not match q^-1 mod p")
+	}
+
+	return key, nil
+}
+
+// NewPublicKey creates a public key from n and e and validates it with ValidatePublicKey.
+func NewPublicKey(c KeyComponents) (*rsa.PublicKey, error) {
+	if c.N == nil {
+		return nil, errors.New("modulus is missing")
+	}
+	if c.E == nil {
+		return nil, errors.New("public exponent is missing")
+	}
+	e, err := exponentToInt(c.E)
+	if err != nil {
+		return nil, err
+	}
+	key := &rsa.PublicKey{
+		N: c.N,
+		E: e,
+	}
+	if err := ValidatePublicKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ValidatePublicKey checks that the modulus and public exponent are sane.
+func ValidatePublicKey(key *rsa.PublicKey) error {
+	if key.N == nil || key.N.Sign() <= 0 {
+		return errors.New("modulus is missing")
+	}
+	if key.N.Bit(0) == 0 {
+		return errors.New("modulus is even")
+	}
+	if key.E < 3 {
+		return errors.New("public exponent is too small")
+	}
+	if key.E&1 == 0 {
+		return errors.New("public exponent is even")
+	}
+	if big.NewInt(int64(key.E)).Cmp(key.N) >= 0 {
+		return errors.New("public exponent is not smaller than the modulus")
+	}
+	return nil
+}
+
+// ValidatePrivateKey checks the consistency of the private key:
+// the primes are prime and their product is n, d·e ≡ 1 mod λ(n)
+// and the precomputed CRT values, if present, match the key.
+//
+// Unlike rsa.PrivateKey.Validate it doesn't trust the CRT values when checking d.
+func ValidatePrivateKey(key *rsa.PrivateKey) error {
+	if err := ValidatePublicKey(&key.PublicKey); err != nil {
+		return err
+	}
+	if len(key.Primes) < 2 {
+		return errors.New("need at least two primes")
+	}
+	if key.D == nil || key.D.Sign() <= 0 {
+		return errors.New("private exponent is missing")
+	}
+
+	product := new(big.Int).Set(bigOne)
+	for i, prime := range key.Primes {
+		if prime == nil || prime.Cmp(bigOne) <= 0 {
+			return fmt.Errorf("prime %d is invalid", i+1)
+		}
+		if !prime.ProbablyPrime(20) {
+			return fmt.Errorf("prime %d is not prime", i+1)
+		}
+		product.Mul(product, prime)
+	}
+	if product.Cmp(key.N) != 0 {
+		return errors.New("product of primes is not equal to the modulus")
+	}
+
+	lambda := carmichael(key.Primes)
+	de := new(big.Int).Mul(key.D, big.NewInt(int64(key.E)))
+	if de.Mod(de, lambda).Cmp(bigOne) != 0 {
+		return errors.New("d·e is not congruent to 1 mod λ(n)")
+	}
+
+	if err := validateCRT(key); err != nil {
+		return err
+	}
+
+	return key.Validate()
+}
+
+func validateCRT(key *rsa.PrivateKey) error {
+	pre := key.Precomputed
+	if pre.Dp == nil {
+		return nil
+	}
+
+	p, q := key.Primes[0], key.Primes[1]
+
+	if pre.Dp.Cmp(new(big.Int).Mod(key.D, new(big.Int).Sub(p, bigOne))) != 0 {
+		return errors.New("dP does not match d mod (p-1)")
+	}
+	if pre.Dq.Cmp(new(big.Int).Mod(key.D, new(big.Int).Sub(q, bigOne))) != 0 {
+		return errors.New("dQ does not match d mod (q-1)")
+	}
+	if new(big.Int).Mod(new(big.Int).Mul(pre.Qinv, q), p).Cmp(bigOne) != 0 {
+		return errors.New("qInv does not match q^-1 mod p")
+	}
+
+	r := new(big.Int).Mul(p, q)
+	for i, v := range pre.CRTValues {
+		prime := key.Primes[i+2]
+		if v.Exp.Cmp(new(big.Int).Mod(key.D, new(big.Int).Sub(prime, bigOne))) != 0 {
+			return fmt.Errorf("exponent of prime %d does not match", i+3)
+		}
+		if v.R.Cmp(r) != 0 {
+			return fmt.Errorf("CRT product of prime %d does not match", i+3)
+		}
+		if new(big.Int).Mod(new(big.Int).Mul(v.Coeff, r), prime).Cmp(bigOne) != 0 {
+			return fmt.Errorf("coefficient of prime %d does not match", i+3)
+		}
+		r.Mul(r, prime)
+	}
+
+	return nil
+}
+
+// RecoverPrimes factors n using the public and private exponents as
+// described in NIST SP 800-56B Rev. 2, Appendix C.
+func RecoverPrimes(n, e, d *big.Int) (p, q *big.Int, err error) {
+	if n.Sign() <= 0 || e.Sign() <= 0 || d.Sign() <= 0 {
+		return nil, nil, errors.New("n, e and d must be positive")
+	}
+
+	// k = d·e - 1 = 2^t·r, with r odd
+	k := new(big.Int).Mul(d, e)
+	k.Sub(k, bigOne)
+	if k.Sign() == 0 || k.Bit(0) == 1 {
+		return nil, nil, errors.New("cannot recover primes: d·e - 1 is not even")
+	}
+	t := k.TrailingZeroBits()
+	r := new(big.Int).Rsh(k, t)
+
+	nMinusOne := new(big.Int).Sub(n, bigOne)
+
+	// the probability to fail for one g is at most 1/2
+	for g := int64(2); g < 200; g++ {
+		y := new(big.Int).Exp(big.NewInt(g), r, n)
+		if y.Cmp(bigOne) == 0 || y.Cmp(nMinusOne) == 0 {
+			continue
+		}
+		for i := uint(1); i <= t; i++ {
+			x := new(big.Int).Exp(y, bigTwo, n)
+			if x.Cmp(bigOne) == 0 {
+				// y is a nontrivial square root of 1
+				p = new(big.Int).GCD(nil, nil, new(big.Int).Sub(y, bigOne), n)
+				q = new(big.Int).Div(n, p)
+				if p.Cmp(q) < 0 {
+					p, q = q, p
+				}
+				return p, q, nil
+			}
+			if x.Cmp(nMinusOne) == 0 {
+				break
+			}
+			y = x
+		}
+	}
+
+	return nil, nil, errors.New("cannot recover primes: n, e and d are not consistent")
+}
+
+// carmichael returns λ(n) = lcm(p_1-1, ..., p_u-1).
+func carmichael(primes []*big.Int) *big.Int {
+	lambda := new(big.Int).Set(bigOne)
+	for _, prime := range primes {
+		pMinusOne := new(big.Int).Sub(prime, bigOne)
+		gcd := new(big.Int).GCD(nil, nil, lambda, pMinusOne)
+		if gcd.Cmp(bigZero) == 0 {
+			continue
+		}
+		lambda.Mul(lambda, pMinusOne)
+		lambda.Div(lambda, gcd)
+	}
+	return lambda
+}
+
+func exponentToInt(e *big.Int) (int, error) {
+	if e.Sign() <= 0 {
+		return 0, errors.New("public exponent must be positive")
+	}
+	if e.BitLen() > 31 {
+		return 0, errors.New("public exponent is too large, max is 2^31-1")
+	}
+	return int(e.Int64()), nil
+}
+
+// ComponentsFromPrivateKey returns the components of the given private key,
+// including the CRT values.
+func ComponentsFromPrivateKey(key *rsa.PrivateKey) KeyComponents {
+	c := KeyComponents{
+		N:      key.N,
+		E:      big.NewInt(int64(key.E)),
+		D:      key.D,
+		Primes: key.Primes,
+	}
+	if key.Precomputed.Dp == nil {
+		key.Precompute()
+	}
+	c.Dp = key.Precomputed.Dp
+	c.Dq = key.Precomputed.Dq
+	c.Qinv = key.Precomputed.Qinv
+	return c
+}
+
+// ComponentsFromPublicKey returns the components(n and e) of the given public key.
+func ComponentsFromPublicKey(key *rsa.PublicKey) KeyComponents {
+	return KeyComponents{
+		N: key.N,
+		E: big.NewInt(int64(key.E)),
+	}
+}
+
+// keyComponentsJSON is the JSON form of KeyComponents, all values are hex strings.
+type keyComponentsJSON struct {
+	N           string   `json:"n,omitempty"`
+	E           string   `json:"e,omitempty"`
+	D           string   `json:"d,omitempty"`
+	P           string   `json:"p,omitempty"`
+	Q           string   `json:"q,omitempty"`
+	OtherPrimes []string `json:"otherPrimes,omitempty"`
+	Dp          string   `json:"dP,omitempty"`
+	Dq          string   `json:"dQ,omitempty"`
+	Qinv        string   `json:"qInv,omitempty"`
+}
+
+// MarshalJSON encodes the components as a JSON object with the members
+// n, e, d, p, q, otherPrimes, dP, dQ and qInv, all given as hex strings.
+// Missing components are omitted.
+func (c KeyComponents) MarshalJSON() ([]byte, error) {
+	v := keyComponentsJSON{
+		N:    bigIntToHex(c.N),
+		E:    bigIntToHex(c.E),
+		D:    bigIntToHex(c.D),
+		Dp:   bigIntToHex(c.Dp),
+		Dq:   bigIntToHex(c.Dq),
+		Qinv: bigIntToHex(c.Qinv),
+	}
+	for i, prime := range c.Primes {
+		switch i {
+		case 0:
+			v.P = bigIntToHex(prime)
+		case 1:
+			v.Q = bigIntToHex(prime)
+		default:
+			v.OtherPrimes = append(v.OtherPrimes, bigIntToHex(prime))
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes the JSON form produced by MarshalJSON.
+func (c *KeyComponents) UnmarshalJSON(b []byte) error {
+	var v keyComponentsJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	var r KeyComponents
+
+	values := []struct {
+		name  string
+		value string
+		dst   **big.Int
+	}{
+		{"n", v.N, &r.N},
+		{"e", v.E, &r.E},
+		{"d", v.D, &r.D},
+		{"dP", v.Dp, &r.Dp},
+		{"dQ", v.Dq, &r.Dq},
+		{"qInv", v.Qinv, &r.Qinv},
+	}
+	for _, value := range values {
+		i, err := bigIntFromHex(value.value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", value.name, err)
+		}
+		*value.dst = i
+	}
+
+	if v.P != "" || v.Q != "" {
+		if v.P == "" || v.Q == "" {
+			return errors.New("need both p and q")
+		}
+		for i, s := range append([]string{v.P, v.Q}, v.OtherPrimes...) {
+			prime, err := bigIntFromHex(s)
+			if err != nil {
+				return fmt.Errorf("prime %d: %w", i+1, err)
+			}
+			r.Primes = append(r.Primes, prime)
+		}
+	} else if len(v.OtherPrimes) != 0 {
+		return errors.New("otherPrimes need p and q")
+	}
+
+	*c = r
+
+	return nil
+}
+
+func bigIntToHex(i *big.Int) string {
+	if i == nil {
+		return ""
+	}
+	return hex.EncodeToString(i.Bytes())
+}
+
+// bigIntFromHex returns nil for an empty string.
+func bigIntFromHex(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,227 @@
+package util
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := PrivateKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_private_key.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestNewPrivateKey(t *testing.T) {
+	key := testKey(t)
+	e := big.NewInt(int64(key.E))
+	p, q := key.Primes[0], key.Primes[1]
+
+	t.Run("Invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			c    KeyComponents
+		}{
+			{"NoE", KeyComponents{N: key.N, D: key.D, Primes: key.Primes}},
+			{"EvenE", KeyComponents{N: key.N, E: big.NewInt(65536), D: key.D, Primes: key.Primes}},
+			{"BigE", KeyComponents{N: key.N, E: new(big.Int).Lsh(big.NewInt(1), 40), Primes: key.Primes}},
+			{"NoPrimesNoD", KeyComponents{N: key.N, E: e}},
+			{"OnePrime", KeyComponents{N: key.N, E: e, Primes: []*big.Int{p}}},
+			{"WrongD", KeyComponents{N: key.N, E: e, D: new(big.Int).Add(key.D, big.NewInt(2)), Primes: key.Primes}},
+			{"WrongN", KeyComponents{N: new(big.Int).Add(key.N, big.NewInt(2)), E: e, D: key.D, Primes: key.Primes}},
+			{"NotPrime", KeyComponents{E: e, Primes: []*big.Int{p, new(big.Int).Mul(q, big.NewInt(3))}}},
+			{"WrongDp", KeyComponents{E: e, Primes: key.Primes, Dp: big.NewInt(1)}},
+			{"WrongDq", KeyComponents{E: e, Primes: key.Primes, Dq: big.NewInt(1)}},
+			{"WrongQinv", KeyComponents{E: e, Primes: key.Primes, Qinv: big.NewInt(1)}},
+			{"Inconsistent", KeyComponents{N: key.N, E: big.NewInt(3), D: key.D}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				if _, err := NewPrivateKey(test.c); err == nil {
+					t.Fatal("expected error")
+				}
+			})
+		}
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		tests := []struct {
+			name string
+			c    KeyComponents
+		}{
+			{"All", KeyComponents{
+				N: key.N, E: e, D: key.D, Primes: key.Primes,
+				Dp: key.Precomputed.Dp, Dq: key.Precomputed.Dq, Qinv: key.Precomputed.Qinv,
+			}},
+			{"RecoverPrimes", KeyComponents{N: key.N, E: e, D: key.D}},
+			{"ComputeD", KeyComponents{N: key.N, E: e, Primes: key.Primes}},
+			{"ComputeN", KeyComponents{E: e, Primes: key.Primes}},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				have, err := NewPrivateKey(test.c)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if have.N.Cmp(key.N) != 0 {
+					t.Fatal("n not equal")
+				}
+				if have.Precomputed.Dp.Cmp(key.Precomputed.Dp) != 0 {
+					t.Fatal("dP not equal")
+				}
+				if have.Precomputed.Dq.Cmp(key.Precomputed.Dq) != 0 {
+					t.Fatal("dQ not equal")
+				}
+				if have.Precomputed.Qinv.Cmp(key.Precomputed.Qinv) != 0 {
+					t.Fatal("qInv not equal")
+				}
+			})
+		}
+	})
+
+	t.Run("MultiPrime", func(t *testing.T) {
+		//nolint:staticcheck // multi-prime keys are needed for testing
+		mpKey, err := rsa.GenerateMultiPrimeKey(rand.Reader, 3, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		have, err := NewPrivateKey(KeyComponents{E: big.NewInt(int64(mpKey.E)), Primes: mpKey.Primes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if have.N.Cmp(mpKey.N) != 0 {
+			t.Fatal("n not equal")
+		}
+		if len(have.Precomputed.CRTValues) != 1 {
+			t.Fatal("expected CRT values for the third prime")
+		}
+		if err := ValidatePrivateKey(have); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestNewPublicKey(t *testing.T) {
+	key := testKey(t)
+	e := big.NewInt(int64(key.E))
+
+	tests := []struct {
+		name string
+		c    KeyComponents
+	}{
+		{"NoN", KeyComponents{E: e}},
+		{"NoE", KeyComponents{N: key.N}},
+		{"EvenN", KeyComponents{N: new(big.Int).Add(key.N, big.NewInt(1)), E: e}},
+		{"SmallE", KeyComponents{N: key.N, E: big.NewInt(1)}},
+		{"ETooBig", KeyComponents{N: big.NewInt(15), E: big.NewInt(17)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewPublicKey(test.c); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	t.Run("Ok", func(t *testing.T) {
+		if _, err := NewPublicKey(KeyComponents{N: key.N, E: e}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestValidatePrivateKey(t *testing.T) {
+	key := testKey(t)
+	if err := ValidatePrivateKey(key); err != nil {
+		t.Fatal(err)
+	}
+
+	// rsa.PrivateKey.Validate uses only the CRT values, so it cannot detect this
+	bad := *key
+	bad.D = new(big.Int).Add(key.D, big.NewInt(2))
+	if err := ValidatePrivateKey(&bad); err == nil {
+		t.Fatal("expected error")
+	}
+
+	bad = *key
+	bad.Precomputed.Qinv = big.NewInt(1)
+	if err := ValidatePrivateKey(&bad); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestKeyComponentsJSON(t *testing.T) {
+	key := testKey(t)
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		b, err := json.Marshal(ComponentsFromPrivateKey(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c KeyComponents
+		if err := json.Unmarshal(b, &c); err != nil {
+			t.Fatal(err)
+		}
+		have, err := NewPrivateKey(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !have.Equal(key) {
+			t.Fatal("keys not equal")
+		}
+	})
+
+	t.Run("Public", func(t *testing.T) {
+		b, err := json.Marshal(ComponentsFromPublicKey(&key.PublicKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"n":"` + hex.EncodeToString(key.N.Bytes()) + `","e":"010001"}`
+		if string(b) != want {
+			t.Fatalf("want %s, have %s", want, b)
+		}
+	})
+
+	t.Run("MultiPrime", func(t *testing.T) {
+		c := KeyComponents{Primes: []*big.Int{big.NewInt(3), big.NewInt(5), big.NewInt(7)}}
+		b, err := json.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"p":"03","q":"05","otherPrimes":["07"]}`; string(b) != want {
+			t.Fatalf("want %s, have %s", want, b)
+		}
+		var have KeyComponents
+		if err := json.Unmarshal(b, &have); err != nil {
+			t.Fatal(err)
+		}
+		if len(have.Primes) != 3 || have.Primes[2].Int64() != 7 {
+			t.Fatalf("unexpected primes: %v", have.Primes)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		inputs := []string{
+			`[]`,
+			`{"n":"xyz"}`,
+			`{"p":"03"}`,
+			`{"q":"03"}`,
+			`{"otherPrimes":["07"]}`,
+			`{"p":"03","q":"zz"}`,
+		}
+		for _, input := range inputs {
+			var c KeyComponents
+			if err := json.Unmarshal([]byte(input), &c); err == nil {
+				t.Fatalf("%s: expected error", input)
+			}
+		}
+	})
+}
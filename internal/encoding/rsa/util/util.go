@@ -3,8 +3,12 @@ package util
 import (
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"encoding/pem"
 	"errors"
+	"fmt"
+	"math/big"
 )
 
 func PrivateKeyFromPem(p []byte) (*rsa.PrivateKey, error) {
@@ -22,3 +26,161 @@ func PublicKeyFromPem(p []byte) (*rsa.PublicKey, error) {
 	}
 	return x509.ParsePKCS1PublicKey(block.Bytes)
 }
+
+// ParseKey parses a RSA private or public key given as PEM or DER.
+// PKCS#1, PKCS#8 and PKIX(SubjectPublicKeyInfo) encodings are accepted.
+// The result is either *rsa.PrivateKey or *rsa.PublicKey.
+func ParseKey(data []byte) (any, error) {
+	return parseKey(data, x509.ParsePKCS1PrivateKey, parsePKCS8)
+}
+
+// ParseKeyUnvalidated is like ParseKey, but private keys are decoded as
+// they are stored, without the checks of crypto/x509 and with the stored CRT
+// values, so that an inconsistent key can be checked with ValidatePrivateKey.
+func ParseKeyUnvalidated(data []byte) (any, error) {
+	return parseKey(data, parsePKCS1Unvalidated, parsePKCS8Unvalidated)
+}
+
+func parseKey(data []byte, parsePKCS1, parsePKCS8 func([]byte) (*rsa.PrivateKey, error)) (any, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return parsePKCS1(block.Bytes)
+		case "RSA PUBLIC KEY":
+			return x509.ParsePKCS1PublicKey(block.Bytes)
+		case "PRIVATE KEY":
+			return parsePKCS8(block.Bytes)
+		case "PUBLIC KEY":
+			return parsePKIX(block.Bytes)
+		default:
+			return nil, fmt.Errorf("unknown PEM block type %q", block.Type)
+		}
+	}
+
+	if key, err := parsePKCS1(data); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PublicKey(data); err == nil {
+		return key, nil
+	}
+	if key, err := parsePKCS8(data); err == nil {
+		return key, nil
+	}
+	if key, err := parsePKIX(data); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("input is not a RSA key in PKCS#1, PKCS#8 or PKIX format")
+}
+
+func parsePKCS8(der []byte) (*rsa.PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("PKCS#8 key is not a RSA key")
+	}
+	return rsaKey, nil
+}
+
+// pkcs1PrivateKey is the RSAPrivateKey structure of RFC 8017, A.1.2.
+type pkcs1PrivateKey struct {
+	Version     int
+	N           *big.Int
+	E           *big.Int
+	D           *big.Int
+	P           *big.Int
+	Q           *big.Int
+	Dp          *big.Int
+	Dq          *big.Int
+	Qinv        *big.Int
+	OtherPrimes []pkcs1OtherPrime `asn1:"optional,omitempty"`
+}
+
+type pkcs1OtherPrime struct {
+	Prime *big.Int
+	Exp   *big.Int
+	Coeff *big.Int
+}
+
+// pkcs8 is the PrivateKeyInfo structure of RFC 5208, the attributes are
+// ignored.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+var oidRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// parsePKCS1Unvalidated decodes a PKCS#1 private key, the values are not
+// checked and the CRT values are the stored ones.
+func parsePKCS1Unvalidated(der []byte) (*rsa.PrivateKey, error) {
+	var k pkcs1PrivateKey
+	rest, err := asn1.Unmarshal(der, &k)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after the PKCS#1 key")
+	}
+	if k.Version > 1 {
+		return nil, fmt.Errorf("unknown PKCS#1 version %d", k.Version)
+	}
+	e, err := exponentToInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &rsa.PrivateKey{
+		PublicKey: rsa.PublicKey{
+			N: k.N,
+			E: e,
+		},
+		D:      k.D,
+		Primes: []*big.Int{k.P, k.Q},
+	}
+	key.Precomputed.Dp = k.Dp
+	key.Precomputed.Dq = k.Dq
+	key.Precomputed.Qinv = k.Qinv
+
+	r := new(big.Int).Mul(k.P, k.Q)
+	for _, other := range k.OtherPrimes {
+		key.Primes = append(key.Primes, other.Prime)
+		key.Precomputed.CRTValues = append(key.Precomputed.CRTValues, rsa.CRTValue{
+			Exp:   other.Exp,
+			Coeff: other.Coeff,
+			R:     new(big.Int).Set(r),
+		})
+		r.Mul(r, other.Prime)
+	}
+
+	return key, nil
+}
+
+// parsePKCS8Unvalidated decodes a PKCS#8 private key which contains a
+// PKCS#1 private key, see parsePKCS1Unvalidated.
+func parsePKCS8Unvalidated(der []byte) (*rsa.PrivateKey, error) {
+	var k pkcs8
+	if _, err := asn1.Unmarshal(der, &k); err != nil {
+		return nil, err
+	}
+	if !k.Algo.Algorithm.Equal(oidRSA) {
+		return nil, errors.New("PKCS#8 key is not a RSA key")
+	}
+	return parsePKCS1Unvalidated(k.PrivateKey)
+}
+
+func parsePKIX(der []byte) (*rsa.PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("PKIX key is not a RSA key")
+	}
+	return rsaKey, nil
+}
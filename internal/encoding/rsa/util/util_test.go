@@ -1,6 +1,9 @@
 package util
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"testing"
 
 	"bandr.me/p/pocryp/internal/testutil"
@@ -55,3 +58,78 @@ func TestPublicKeyFromPem(t *testing.T) {
 		}
 	})
 }
+
+func TestParseKey(t *testing.T) {
+	priv := testKey(t)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		input   []byte
+		private bool
+	}{
+		{"PKCS1PrivatePem", testutil.ReadFile(t, "testdata/rsa2048_private_key.pem"), true},
+		{"PKCS1PublicPem", testutil.ReadFile(t, "testdata/rsa2048_public_key.pem"), false},
+		{"PKCS1PrivateDer", x509.MarshalPKCS1PrivateKey(priv), true},
+		{"PKCS1PublicDer", x509.MarshalPKCS1PublicKey(&priv.PublicKey), false},
+		{"PKCS8Pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}), true},
+		{"PKCS8Der", pkcs8, true},
+		{"PKIXPem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}), false},
+		{"PKIXDer", pkix, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := ParseKey(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unvalidated, err := ParseKeyUnvalidated(test.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u, ok := unvalidated.(*rsa.PrivateKey); ok {
+				if err := ValidatePrivateKey(u); err != nil {
+					t.Fatal(err)
+				}
+				if !u.Equal(key) {
+					t.Fatal("unvalidated key is not the same")
+				}
+			}
+			switch key.(type) {
+			case *rsa.PrivateKey:
+				if !test.private {
+					t.Fatal("expected public key")
+				}
+			case *rsa.PublicKey:
+				if test.private {
+					t.Fatal("expected private key")
+				}
+			default:
+				t.Fatalf("unexpected type %T", key)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		inputs := [][]byte{
+			{1, 2, 3},
+			pem.EncodeToMemory(&pem.Block{Type: "FOO", Bytes: pkix}),
+		}
+		for _, input := range inputs {
+			if _, err := ParseKey(input); err == nil {
+				t.Fatal("expected error")
+			}
+			if _, err := ParseKeyUnvalidated(input); err == nil {
+				t.Fatal("expected error")
+			}
+		}
+	})
+}
@@ -0,0 +1,81 @@
+package rsa
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"os"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	rsautil "bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var ValidateCmd = &cmd.Command{
+	Name:  "rsa-validate",
+	Run:   runValidate,
+	Brief: "Check the consistency of a RSA key",
+
+	Usage: `Usage: pocryp rsa-validate [-in INPUT]
+
+Check the consistency of a RSA private or public key.
+
+For public keys, the modulus and public exponent are checked.
+For private keys, the primes must be prime and their product must be n,
+d·e must be congruent to 1 mod λ(n) and the CRT values must match the key.
+
+The key can be given as PEM or DER, encoded as PKCS#1, PKCS#8 or PKIX.
+
+If -in is not specified, stdin will be read.
+`,
+}
+
+func runValidate(cmd *cmd.Command) error {
+	fInput := cmd.Flags.String("in", "", "Read key from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	sf, err := stdfile.New(*fInput, "", stdfile.Options{})
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	input, err := sf.ReadAs(fInFormat)
+	if err != nil {
+		return err
+	}
+
+	// the key is checked below, not when parsing it
+	key, err := rsautil.ParseKeyUnvalidated(input)
+	if err != nil {
+		return err
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		err = rsautil.ValidatePrivateKey(k)
+	case *rsa.PublicKey:
+		err = rsautil.ValidatePublicKey(k)
+	}
+	if cmd.JSON {
+		r := stdfile.Result{"valid": err == nil}
+		if err != nil {
+			r["reason"] = err.Error()
+		}
+		if err := stdfile.WriteJSON(os.Stdout, r); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", util.ErrNotValid, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package rsa
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestValidate(t *testing.T) {
+	tmp := t.TempDir()
+	in := filepath.Join(tmp, "in")
+
+	t.Run("NotAKey", func(t *testing.T) {
+		testutil.SetupIn(t, in, []byte("foo"))
+		if err := testutil.RunCmd(ValidateCmd, "-in", in); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("InvalidPublicKey", func(t *testing.T) {
+		key, err := util.PublicKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_public_key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		key.E = 65536
+		testutil.SetupIn(t, in, x509.MarshalPKCS1PublicKey(key))
+		if err := testutil.RunCmd(ValidateCmd, "-in", in); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	// the key is encoded without crypto/x509, which would recompute the
+	// CRT values
+	marshal := func(c util.KeyComponents) []byte {
+		v := struct {
+			Version                     int
+			N, E, D, P, Q, Dp, Dq, Qinv *big.Int
+		}{0, c.N, c.E, c.D, c.Primes[0], c.Primes[1], c.Dp, c.Dq, c.Qinv}
+		der, err := asn1.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return der
+	}
+	components := func() util.KeyComponents {
+		key, err := util.PrivateKeyFromPem(testutil.ReadFile(t, "testdata/rsa2048_private_key.pem"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return util.ComponentsFromPrivateKey(key)
+	}
+	inc := func(i *big.Int) *big.Int {
+		return new(big.Int).Add(i, big.NewInt(2))
+	}
+
+	for _, tt := range []struct {
+		name   string
+		modify func(*util.KeyComponents)
+	}{
+		{"BadPrime", func(c *util.KeyComponents) { c.Primes[1] = inc(c.Primes[1]) }},
+		{"BadD", func(c *util.KeyComponents) { c.D = inc(c.D) }},
+		{"BadDp", func(c *util.KeyComponents) { c.Dp = inc(c.Dp) }},
+		{"BadDq", func(c *util.KeyComponents) { c.Dq = inc(c.Dq) }},
+		{"BadQinv", func(c *util.KeyComponents) { c.Qinv = inc(c.Qinv) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := components()
+			tt.modify(&c)
+			testutil.SetupIn(t, in, marshal(c))
+			err := testutil.RunCmd(ValidateCmd, "-in", in)
+			if cmd.CategoryOf(err) != cmd.CategoryVerificationFailed {
+				t.Fatal("expected verification-failed error, have", err)
+			}
+		})
+	}
+
+	t.Run("ValidPrivateKey", func(t *testing.T) {
+		testutil.SetupIn(t, in, marshal(components()))
+		if err := testutil.RunCmd(ValidateCmd, "-in", in); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	for _, file := range []string{"rsa2048_private_key.pem", "rsa2048_public_key.pem"} {
+		t.Run(file, func(t *testing.T) {
+			if err := testutil.RunCmd(ValidateCmd, "-in", filepath.Join("testdata", file)); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -28,7 +28,8 @@ func runSha(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
 	fAlg := cmd.Flags.String("alg", "", fmt.Sprintf("SHA algorithm to use; one of: %s.", common.SHAAlgs))
-	fBin := cmd.Flags.Bool("bin", false, "Write output as binary not hex.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -42,7 +43,7 @@ func runSha(cmd *cmd.Command) error {
 		return errors.New("hash alg not specified, use -alg")
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
@@ -56,11 +57,24 @@ func runSha(cmd *cmd.Command) error {
 
 	h := hashFunc()
 
-	if _, err := io.Copy(h, sf.In); err != nil {
-		return err
+	// the binary input is hashed as it is read, the others are decoded first
+	if fInFormat.Format == "bin" {
+		if _, err := io.Copy(h, sf.In); err != nil {
+			return err
+		}
+	} else {
+		input, err := sf.ReadAs(fInFormat)
+		if err != nil {
+			return err
+		}
+		h.Write(input)
 	}
 
 	digest := h.Sum(nil)
 
-	return sf.WriteHexOrBin(digest, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"digest": stdfile.Hex(digest)})
+	}
+
+	return sf.Write(digest, fOut)
 }
@@ -151,4 +151,17 @@ func TestShaCmd(t *testing.T) {
 			testutil.ExpectFileContentHex(t, out, test.output)
 		})
 	}
+
+	t.Run("InFormat", func(t *testing.T) {
+		out := filepath.Join(tmp, "out")
+		in := filepath.Join(tmp, "in")
+
+		testutil.SetupInOut(t, in, out, []byte("616263\n"))
+
+		if err := testutil.RunCmd(ShaCmd, "-alg", common.AlgSHA1, "-in", in, "-in-format", "hex", "-out", out, "-bin"); err != nil {
+			t.Fatal(err)
+		}
+
+		testutil.ExpectFileContentHex(t, out, "A9993E364706816ABA3E25717850C26C9CD0D89D")
+	})
 }
@@ -5,6 +5,7 @@ import (
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
 	"bandr.me/p/pocryp/internal/common"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 
@@ -28,8 +29,10 @@ func runPbkdf2(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
 	fSalt := cmd.Flags.String("salt", "", "Salt as hex.")
 	fSaltFile := cmd.Flags.String("salt-file", "", "File which contains the salt as binary/text.")
+	fSaltFormat := util.FormatFlag(cmd.Flags, "salt", "bin")
 	fIter := cmd.Flags.Int("iter", 1024, "Number of iterations.")
 	fLen := cmd.Flags.Int("len", 128, "Bit-length of the derived key.")
 	fHashFunc := cmd.Flags.String(
@@ -37,7 +40,7 @@ func runPbkdf2(cmd *cmd.Command) error {
 		common.AlgSHA256,
 		fmt.Sprintf("Hash function(valid options: %s).", common.SHAAlgs),
 	)
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -46,13 +49,14 @@ func runPbkdf2(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		cmd.Flags.Usage()
 		return fmt.Errorf("key: %w", err)
 	}
+	defer key.Destroy()
 
-	salt, err := util.FileOrHex(*fSaltFile, *fSalt)
+	salt, err := util.FileOrHexAs(*fSaltFile, *fSalt, *fSaltFormat)
 	if err != nil {
 		cmd.Flags.Usage()
 		return fmt.Errorf("salt: %w", err)
@@ -64,13 +68,19 @@ func runPbkdf2(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New("", *fOutput)
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	output := pbkdf2.Key(key, salt, *fIter, *fLen, hashFunc)
+	output := pbkdf2.Key(key.Bytes(), salt, *fIter, *fLen, hashFunc)
+	defer secret.Wipe(output)
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
@@ -55,11 +55,7 @@ func TestPbkdf2Cmd(t *testing.T) {
 	out := filepath.Join(tmp, "out")
 	for i, tv := range tvs {
 		t.Run(fmt.Sprintf("%d", i), func(t *testing.T) {
-			f, err := os.Create(out)
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer f.Close()
+			testutil.SetupOut(t, out)
 			args := []string{
 				"-bin",
 				"-key", hex.EncodeToString(tv.p),
@@ -83,6 +79,25 @@ func TestPbkdf2Cmd(t *testing.T) {
 			}
 		})
 	}
+	t.Run("SaltFormat", func(t *testing.T) {
+		testutil.SetupOut(t, out)
+		saltFile := filepath.Join(tmp, "salt")
+		testutil.SetupIn(t, saltFile, []byte(hex.EncodeToString(tvs[0].s)))
+		args := []string{
+			"-bin",
+			"-key", hex.EncodeToString(tvs[0].p),
+			"-salt-file", saltFile,
+			"-salt-format", "hex",
+			"-iter", fmt.Sprintf("%d", tvs[0].c),
+			"-len", fmt.Sprintf("%d", tvs[0].dkLen),
+			"-hash=SHA-1",
+			"-out", out,
+		}
+		if err := testutil.RunCmd(Pbkdf2Cmd, args...); err != nil {
+			t.Fatal(err)
+		}
+		testutil.ExpectFileContent(t, out, tvs[0].expected)
+	})
 	t.Run("NoKey", func(t *testing.T) {
 		if err := testutil.RunCmd(Pbkdf2Cmd); err == nil {
 			t.Fatal("expected and error")
@@ -2,13 +2,16 @@ package cmd
 
 import (
 	"crypto/rsa"
-	"encoding/hex"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
 	"bandr.me/p/pocryp/internal/common"
+	"bandr.me/p/pocryp/internal/pkcs11"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 
 	rsautil "bandr.me/p/pocryp/internal/encoding/rsa/util"
@@ -26,7 +29,7 @@ Encapsulate/Decapsulate INPUT to OUTPUT using RSA-KEM.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
-`,
+` + "\n" + pkcs11.URIHelp,
 }
 
 func run(cmd *cmd.Command) error {
@@ -34,7 +37,8 @@ func run(cmd *cmd.Command) error {
 	fDecapsulate := cmd.Flags.Bool("d", false, "Decapsulate the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
-	fKey := cmd.Flags.String("key", "", "Path to file which contains the key in PEM format")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fKey := cmd.Flags.String("key", "", "Path to file which contains the key in PEM format, or @NAME")
 	fKdfSalt := cmd.Flags.String("kdf-salt", "", "KDF salt as hex.")
 	fKdfIter := cmd.Flags.Int("kdf-iter", 5, "KDF iterations.")
 	fKdfKeyLen := cmd.Flags.Int("kdf-key-len", 16, "KDF key length.")
@@ -43,7 +47,7 @@ func run(cmd *cmd.Command) error {
 		common.AlgSHA256,
 		fmt.Sprintf("KDF hash function(valid options: %s).", common.SHAAlgs),
 	)
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -56,19 +60,47 @@ func run(cmd *cmd.Command) error {
 		cmd.Flags.Usage()
 		return errors.New("no key specified, use -key to specify it")
 	}
-	keyData, err := os.ReadFile(*fKey)
-	if err != nil {
-		return err
-	}
 
 	var key any
 	switch {
+	case pkcs11.IsURI(*fKey):
+		if !*fDecapsulate {
+			return errors.New("a PKCS#11 key can be used only to decapsulate(-d)")
+		}
+		k, err := pkcs11.OpenKey(*fKey)
+		if err != nil {
+			return util.CryptoFailure(err)
+		}
+		defer k.Close()
+		key = k
+	case util.IsKeyRef(*fKey):
+		keyData, err := util.ReadKeyRef(*fKey)
+		if err != nil {
+			return err
+		}
+		privKey, err := x509.ParsePKCS1PrivateKey(keyData)
+		if err != nil {
+			return fmt.Errorf("%s: %w", *fKey, err)
+		}
+		if *fDecapsulate {
+			key = privKey
+		} else {
+			key = &privKey.PublicKey
+		}
 	case *fDecapsulate:
+		keyData, err := os.ReadFile(*fKey)
+		if err != nil {
+			return err
+		}
 		key, err = rsautil.PrivateKeyFromPem(keyData)
 		if err != nil {
 			return err
 		}
 	default:
+		keyData, err := os.ReadFile(*fKey)
+		if err != nil {
+			return err
+		}
 		key, err = rsautil.PublicKeyFromPem(keyData)
 		if err != nil {
 			return err
@@ -79,7 +111,7 @@ func run(cmd *cmd.Command) error {
 		cmd.Flags.Usage()
 		return errors.New("KDF salt cannot be empty")
 	}
-	kdfSalt, err := hex.DecodeString(*fKdfSalt)
+	kdfSalt, err := util.HexOrSource(*fKdfSalt)
 	if err != nil {
 		return err
 	}
@@ -97,16 +129,19 @@ func run(cmd *cmd.Command) error {
 		HashFunc: kdfHashFunc,
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	fOut.Secret = *fDecapsulate
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
+	// the key, when encapsulating
+	defer secret.Wipe(input)
 
 	var output []byte
 	switch {
@@ -117,11 +152,14 @@ func run(cmd *cmd.Command) error {
 		}
 		output, err = kemrsa.Encapsulate(pubKey, input, kdfParams)
 	case *fDecapsulate:
-		privKey, ok := key.(*rsa.PrivateKey)
-		if !ok {
+		switch k := key.(type) {
+		case *rsa.PrivateKey:
+			output, err = kemrsa.Decapsulate(k, input, kdfParams)
+		case *pkcs11.Key:
+			output, err = kemrsa.DecapsulateRaw(k, input, kdfParams)
+		default:
 			return fmt.Errorf("rsa.PrivateKey type assertion failed")
 		}
-		output, err = kemrsa.Decapsulate(privKey, input, kdfParams)
 	default:
 		pubKey, ok := key.(*rsa.PublicKey)
 		if !ok {
@@ -130,8 +168,17 @@ func run(cmd *cmd.Command) error {
 		output, err = kemrsa.Encapsulate(pubKey, input, kdfParams)
 	}
 	if err != nil {
-		return err
+		return util.CryptoFailure(err)
+	}
+	// the key, when decapsulating
+	defer secret.Wipe(output)
+
+	if cmd.JSON {
+		if *fDecapsulate {
+			return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(output)})
+		}
+		return sf.WriteJSON(stdfile.Result{"ciphertext": stdfile.Hex(output)})
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	return sf.Write(output, fOut)
 }
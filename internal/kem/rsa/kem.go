@@ -9,6 +9,7 @@ import (
 	"math/big"
 
 	"bandr.me/p/pocryp/internal/keywrap/aes"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 
 	"golang.org/x/crypto/pbkdf2"
@@ -18,6 +19,7 @@ func generateZ(pubKey *rsa.PublicKey) (*big.Int, error) {
 	nLen := util.BitLenToByteLen(pubKey.N.BitLen())
 
 	zBytes := make([]byte, nLen)
+	defer secret.Wipe(zBytes)
 	if _, err := rand.Read(zBytes); err != nil {
 		return nil, err
 	}
@@ -31,6 +33,11 @@ func generateZ(pubKey *rsa.PublicKey) (*big.Int, error) {
 	return z, nil
 }
 
+// wipeInt zeroizes the words of x, x must not be used after.
+func wipeInt(x *big.Int) {
+	clear(x.Bits())
+}
+
 type KDFParams struct {
 	HashFunc func() hash.Hash
 	Salt     []byte
@@ -46,8 +53,11 @@ func Encapsulate(pubKey *rsa.PublicKey, k []byte, kdfParams KDFParams) ([]byte,
 		return nil, err
 	}
 
+	defer wipeInt(z)
+
 	// Z = IntegerToString (z, nLen)
 	Z := z.Bytes()
+	defer secret.Wipe(Z)
 
 	// c = z^e mod n
 	c := new(big.Int)
@@ -59,6 +69,7 @@ func Encapsulate(pubKey *rsa.PublicKey, k []byte, kdfParams KDFParams) ([]byte,
 
 	// KEK = KDF (Z, kekLen)
 	KEK := pbkdf2.Key(Z, kdfParams.Salt, kdfParams.Iter, kdfParams.KeyLen, kdfParams.HashFunc)
+	defer secret.Wipe(KEK)
 
 	// WK = Wrap (KEK, K)
 	WK, err := aes.Wrap(KEK, k)
@@ -75,36 +86,69 @@ func Encapsulate(pubKey *rsa.PublicKey, k []byte, kdfParams KDFParams) ([]byte,
 	return ek, err
 }
 
-func Decapsulate(privKey *rsa.PrivateKey, ek []byte, kdfParams KDFParams) ([]byte, error) {
-	nLen := util.BitLenToByteLen(privKey.N.BitLen())
+// RawDecrypter computes c^d mod n with an RSA private key which may not be
+// available as a value, e.g. stored in a token.
+type RawDecrypter interface {
+	// size of the modulus in bytes
+	Size() int
 
-	if len(ek) < nLen {
-		return nil, errors.New("decryption error: len(EK) < nLen")
-	}
+	DecryptRaw(c []byte) ([]byte, error)
+}
 
-	// C || WK = EK
-	C := ek[:nLen]
-	WK := ek[nLen:]
+type privateKey struct {
+	*rsa.PrivateKey
+}
 
+func (k privateKey) DecryptRaw(C []byte) ([]byte, error) {
 	// c = StringToInteger (C)
 	c := new(big.Int)
 	c.SetBytes(C)
 	if zero := big.NewInt(0); c.Cmp(zero) < 0 {
 		return nil, errors.New("decryption error: c < 0")
 	}
-	if c.Cmp(privKey.N) >= 0 {
+	if c.Cmp(k.N) >= 0 {
 		return nil, errors.New("decryption error: c >= n")
 	}
 
 	// z = c^d mod n
 	z := new(big.Int)
-	z.Exp(c, privKey.D, privKey.N)
+	z.Exp(c, k.D, k.N)
+	defer wipeInt(z)
 
-	// Z = IntegerToString (z, nLen)
-	Z := z.Bytes()
+	return z.Bytes(), nil
+}
+
+func Decapsulate(privKey *rsa.PrivateKey, ek []byte, kdfParams KDFParams) ([]byte, error) {
+	return DecapsulateRaw(privateKey{privKey}, ek, kdfParams)
+}
+
+// DecapsulateRaw is like Decapsulate, with the private key operation done by key.
+func DecapsulateRaw(key RawDecrypter, ek []byte, kdfParams KDFParams) ([]byte, error) {
+	nLen := key.Size()
+
+	if len(ek) < nLen {
+		return nil, errors.New("decryption error: len(EK) < nLen")
+	}
+
+	// C || WK = EK
+	C := ek[:nLen]
+	WK := ek[nLen:]
+
+	z, err := key.DecryptRaw(C)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(z)
+
+	// Z = IntegerToString (z, nLen), without the leading zeros as Encapsulate
+	zInt := new(big.Int).SetBytes(z)
+	defer wipeInt(zInt)
+	Z := zInt.Bytes()
+	defer secret.Wipe(Z)
 
 	// KEK = KDF (Z, kekLen)
 	KEK := pbkdf2.Key(Z, kdfParams.Salt, kdfParams.Iter, kdfParams.KeyLen, kdfParams.HashFunc)
+	defer secret.Wipe(KEK)
 
 	// K = Unwrap (KEK, WK)
 	K, err := aes.Unwrap(KEK, WK)
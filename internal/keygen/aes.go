@@ -6,6 +6,8 @@ import (
 	"strconv"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
@@ -25,7 +27,7 @@ If -out is not specified, the output will be printed to stdout.
 
 func runAes(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
-	fBin := cmd.Flags.Bool("bin", false, "Write output as binary not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -50,16 +52,22 @@ func runAes(cmd *cmd.Command) error {
 	}
 	numBits /= 8
 
-	sf, err := stdfile.New("", *fOutput)
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
 	output := make([]byte, numBits)
+	defer secret.Wipe(output)
 	if _, err := rand.Read(output); err != nil {
-		return err
+		return util.CryptoFailure(err)
+	}
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(output)})
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	return sf.Write(output, fOut)
 }
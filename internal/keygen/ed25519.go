@@ -4,6 +4,8 @@ import (
 	"crypto/ed25519"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
@@ -22,7 +24,7 @@ If -out is not specified, the output will be printed to stdout.
 
 func runEd25519(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
-	fBin := cmd.Flags.Bool("bin", false, "Write output as binary not hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -31,7 +33,8 @@ func runEd25519(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New("", *fOutput)
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
@@ -39,8 +42,13 @@ func runEd25519(cmd *cmd.Command) error {
 
 	_, key, err := ed25519.GenerateKey(nil)
 	if err != nil {
-		return err
+		return util.CryptoFailure(err)
+	}
+	defer secret.Wipe(key)
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(key)})
 	}
 
-	return sf.WriteHexOrBin(key, *fBin)
+	return sf.Write(key, fOut)
 }
@@ -24,7 +24,8 @@ If -out is not specified, the output will be printed to stdout.
 func runEd25519GetPub(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
-	fBin := cmd.Flags.Bool("bin", false, "Write output as binary not hex.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -33,13 +34,13 @@ func runEd25519GetPub(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -51,5 +52,9 @@ func runEd25519GetPub(cmd *cmd.Command) error {
 		panic("could not convert to ed25519.PublicKey")
 	}
 
-	return sf.WriteHexOrBin(pub, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"public_key": stdfile.Hex(pub)})
+	}
+
+	return sf.Write(pub, fOut)
 }
@@ -3,12 +3,18 @@ package keygen
 import (
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
+	"encoding/hex"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"strconv"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/drbg"
+	rsautil "bandr.me/p/pocryp/internal/encoding/rsa/util"
+	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
@@ -17,10 +23,17 @@ var RsaCmd = &cmd.Command{
 	Run:   runRsa,
 	Brief: "Generate RSA key",
 
-	Usage: `Usage: pocryp rsa-keygen [-out OUTPUT] NUM_BITS
+	Usage: `Usage: pocryp rsa-keygen [-out OUTPUT] [-e EXPONENT] [-primes N] [-format pkcs1|pkcs8] [-der] [-seed SEED] NUM_BITS
 
 Generate RSA key.
-Valid NUM_BITS: 2048, 3072, 4096.
+NUM_BITS must be at least 1024, common values are 2048, 3072 and 4096.
+
+The key is written as PKCS#1 PEM by default, use -format and -der to change it.
+If -bin or -out-format is specified, the DER is written in that format.
+
+If -seed is specified, the key is derived deterministically from SEED using
+HMAC_DRBG(SHA-256), so the same SEED always gives the same key.
+This is meant only for reproducible test fixtures, never use it for real keys!
 
 If -out is not specified, the output will be printed to stdout.
 `,
@@ -28,6 +41,12 @@ If -out is not specified, the output will be printed to stdout.
 
 func runRsa(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+	fPubExp := cmd.Flags.String("e", "65537", "Public exponent as decimal or 0x prefixed hex.")
+	fPrimes := cmd.Flags.Int("primes", 2, "Number of primes, more than 2 generates a multi-prime key.")
+	fFormat := cmd.Flags.String("format", "pkcs1", "Encoding of the key: pkcs1 or pkcs8.")
+	fDer := cmd.Flags.Bool("der", false, "Write output as DER not PEM.")
+	fSeed := cmd.Flags.String("seed", "", "Derive the key from SEED(hex), for testing only.")
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -46,26 +65,97 @@ func runRsa(cmd *cmd.Command) error {
 		return err
 	}
 
-	if !(numBits == 2048 || numBits == 3072 || numBits == 4096) {
+	if numBits < rsautil.MinKeyBits || numBits > rsautil.MaxKeyBits {
 		cmd.Flags.Usage()
 		return errors.New("invalid num bits requested")
 	}
 
-	sf, err := stdfile.New("", *fOutput)
+	pubExp, err := strconv.ParseInt(*fPubExp, 0, 32)
 	if err != nil {
+		return fmt.Errorf("invalid public exponent: %w", err)
+	}
+
+	if *fFormat != "pkcs1" && *fFormat != "pkcs8" {
+		cmd.Flags.Usage()
+		return fmt.Errorf("invalid format %q", *fFormat)
+	}
+
+	if err := rsautil.CheckKeyParams(numBits, *fPrimes, int(pubExp)); err != nil {
+		cmd.Flags.Usage()
 		return err
 	}
-	defer sf.Close()
 
-	key, err := rsa.GenerateKey(rand.Reader, numBits)
+	var key *rsa.PrivateKey
+	switch {
+	case *fSeed != "":
+		seed, err := hex.DecodeString(*fSeed)
+		if err != nil {
+			return fmt.Errorf("seed: %w", err)
+		}
+		random, err := drbg.NewHMAC(sha256.New, seed, nil, []byte("pocryp rsa-keygen"))
+		if err != nil {
+			return err
+		}
+		key, err = rsautil.GenerateKey(random, numBits, *fPrimes, int(pubExp))
+		if err != nil {
+			return err
+		}
+	case pubExp != 65537:
+		// crypto/rsa supports only 65537
+		key, err = rsautil.GenerateKey(rand.Reader, numBits, *fPrimes, int(pubExp))
+		if err != nil {
+			return err
+		}
+	case *fPrimes != 2:
+		key, err = rsa.GenerateMultiPrimeKey(rand.Reader, *fPrimes, numBits)
+		if err != nil {
+			return util.CryptoFailure(err)
+		}
+	default:
+		key, err = rsa.GenerateKey(rand.Reader, numBits)
+		if err != nil {
+			return util.CryptoFailure(err)
+		}
+	}
+
+	block := &pem.Block{}
+	switch *fFormat {
+	case "pkcs1":
+		block.Type = "RSA PRIVATE KEY"
+		block.Bytes = x509.MarshalPKCS1PrivateKey(key)
+	case "pkcs8":
+		block.Type = "PRIVATE KEY"
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return err
+		}
+	}
+
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
+	defer sf.Close()
 
-	block := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{
+			"bits":   numBits,
+			"format": *fFormat,
+			"key":    stdfile.Hex(block.Bytes),
+		})
+	}
+
+	if *fDer && !fOut.IsSet() {
+		fOut.Format = "bin"
+	}
+	if fOut.IsSet() {
+		return sf.Write(block.Bytes, fOut)
+	}
+
+	if err := pem.Encode(sf.Out, block); err != nil {
+		return err
 	}
 
-	return pem.Encode(sf.Out, block)
+	return sf.Commit()
 }
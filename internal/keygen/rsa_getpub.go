@@ -1,8 +1,10 @@
 package keygen
 
 import (
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
 	"bandr.me/p/pocryp/internal/encoding/rsa/util"
@@ -16,7 +18,10 @@ var RsaGetPubCmd = &cmd.Command{
 
 	Usage: `Usage: pocryp rsa-getpub [-in INPUT] [-out OUTPUT]
 
-Extract RSA public key from private key, specified as PEM.
+Extract RSA public key from private key, specified as PEM or DER(PKCS#1 or PKCS#8).
+
+The public key is written as PKCS#1 PEM, if -bin or -out-format is specified
+the DER is written in that format.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
@@ -25,7 +30,9 @@ If -out is not specified, the output will be printed to stdout.
 
 func runRsaGetPub(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -34,21 +41,25 @@ func runRsaGetPub(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
 
-	privKey, err := util.PrivateKeyFromPem(input)
+	key, err := util.ParseKey(input)
 	if err != nil {
 		return err
 	}
+	privKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("input is not a RSA private key")
+	}
 
 	pubKey := privKey.PublicKey
 
@@ -57,5 +68,17 @@ func runRsaGetPub(cmd *cmd.Command) error {
 		Bytes: x509.MarshalPKCS1PublicKey(&pubKey),
 	}
 
-	return pem.Encode(sf.Out, pubKeyBlock)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"public_key": stdfile.Hex(pubKeyBlock.Bytes)})
+	}
+
+	if fOut.IsSet() {
+		return sf.Write(pubKeyBlock.Bytes, fOut)
+	}
+
+	if err := pem.Encode(sf.Out, pubKeyBlock); err != nil {
+		return err
+	}
+
+	return sf.Commit()
 }
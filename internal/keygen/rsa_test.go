@@ -1,6 +1,8 @@
 package keygen
 
 import (
+	"bytes"
+	"crypto/rsa"
 	"os"
 	"path/filepath"
 	"testing"
@@ -35,9 +37,97 @@ func TestRsa(t *testing.T) {
 		}
 	})
 
+	t.Run("InvalidExponent", func(t *testing.T) {
+		if err := testutil.RunCmd(RsaCmd, "-e", "65536", "2048"); err == nil {
+			t.Fatal("expected error")
+		}
+		if err := testutil.RunCmd(RsaCmd, "-e", "foo", "2048"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("InvalidFormat", func(t *testing.T) {
+		if err := testutil.RunCmd(RsaCmd, "-format", "foo", "2048"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("TooManyPrimes", func(t *testing.T) {
+		if err := testutil.RunCmd(RsaCmd, "-primes", "5", "1024"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("InvalidSeed", func(t *testing.T) {
+		if err := testutil.RunCmd(RsaCmd, "-seed", "xyz", "1024"); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
 	tmp := t.TempDir()
 
-	tests := []string{"2048", "3072", "4096"}
+	t.Run("Options", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			args   []string
+			e      int
+			primes int
+		}{
+			{"Exponent", []string{"-e", "3", "1024"}, 3, 2},
+			{"HexExponent", []string{"-e", "0x11", "1024"}, 17, 2},
+			{"MultiPrime", []string{"-primes", "3", "1536"}, 65537, 3},
+			{"PKCS8", []string{"-format", "pkcs8", "1024"}, 65537, 2},
+			{"DER", []string{"-der", "1024"}, 65537, 2},
+			{"PKCS8DER", []string{"-format", "pkcs8", "-der", "1024"}, 65537, 2},
+			{"OutFormatBin", []string{"-out-format", "bin", "1024"}, 65537, 2},
+		}
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				outPath := filepath.Join(tmp, "out"+test.name)
+				if err := testutil.RunCmd(RsaCmd, append([]string{"-out", outPath}, test.args...)...); err != nil {
+					t.Fatal(err)
+				}
+				parsed, err := rsautil.ParseKey(testutil.ReadFile(t, outPath))
+				if err != nil {
+					t.Fatal(err)
+				}
+				key, ok := parsed.(*rsa.PrivateKey)
+				if !ok {
+					t.Fatal("expected private key")
+				}
+				if key.E != test.e {
+					t.Fatalf("e: want %d, have %d", test.e, key.E)
+				}
+				if len(key.Primes) != test.primes {
+					t.Fatalf("primes: want %d, have %d", test.primes, len(key.Primes))
+				}
+				if err := rsautil.ValidatePrivateKey(key); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+
+	t.Run("Seed", func(t *testing.T) {
+		gen := func(name, seed string) []byte {
+			outPath := filepath.Join(tmp, name)
+			if err := testutil.RunCmd(RsaCmd, "-seed", seed, "-out", outPath, "1024"); err != nil {
+				t.Fatal(err)
+			}
+			return testutil.ReadFile(t, outPath)
+		}
+		a := gen("seed-a", "000102030405060708090a0b0c0d0e0f")
+		b := gen("seed-b", "000102030405060708090a0b0c0d0e0f")
+		c := gen("seed-c", "0f0e0d0c0b0a09080706050403020100")
+		if !bytes.Equal(a, b) {
+			t.Fatal("same seed gave different keys")
+		}
+		if bytes.Equal(a, c) {
+			t.Fatal("different seeds gave the same key")
+		}
+	})
+
+	tests := []string{"1024", "2048", "3072", "4096"}
 
 	for _, numBits := range tests {
 		t.Run(numBits, func(t *testing.T) {
@@ -0,0 +1,471 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/keystore"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+const storeHelp = `
+The keystore is read from -keystore, $` + keystore.PathEnv + ` or pocryp/keystore.json
+in the user config directory. The passphrase is read from -pass, $` + keystore.PassEnv + `
+or from a prompt. Keys of the keystore can be used by the other commands as
+@NAME, e.g. pocryp aes-ecb -key @NAME.
+`
+
+var AddCmd = &cmd.Command{
+	Name:  "keystore-add",
+	Run:   runAdd,
+	Brief: "Add a key to the keystore",
+
+	Usage: `Usage: pocryp keystore-add [-keystore PATH] [-pass SOURCE] [-kdf KDF] -alg ALG [-usage USAGE] -key|-key-file NAME
+
+Add the key given with -key or -key-file to the keystore, as NAME.
+The keystore is created if it doesn't exist.
+
+Algorithms:
+  aes      AES key, 128, 192 or 256 bits
+  ed25519  ED25519 private key(64 bytes, as written by ed25519-keygen)
+  rsa      RSA private key, as PKCS#1 PEM or DER
+  raw      any other secret
+` + storeHelp,
+}
+
+func runAdd(cmd *cmd.Command) error {
+	store := addStoreFlags(cmd.Flags, true)
+	fAlg := cmd.Flags.String("alg", "", "Algorithm of the key: "+strings.Join(keystore.Algorithms, ", ")+".")
+	fUsage := cmd.Flags.String("usage", "", "Comma separated usages of the key, e.g. encrypt,mac.")
+	fKey := cmd.Flags.String("key", "", "Key as hex.")
+	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if cmd.Flags.NArg() != 1 {
+		cmd.Flags.Usage()
+		return errors.New("key name not specified")
+	}
+
+	if *fAlg == "" {
+		cmd.Flags.Usage()
+		return errors.New("algorithm(-alg) not specified")
+	}
+
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	defer key.Destroy()
+	value := key.Bytes()
+	if *fAlg == keystore.AlgRSA {
+		if value, err = rsaToPKCS1(value); err != nil {
+			return fmt.Errorf("key: %w", err)
+		}
+	}
+
+	s, passphrase, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	defer secret.Wipe(passphrase)
+
+	k := keystore.Key{
+		Name:      cmd.Flags.Arg(0),
+		Algorithm: *fAlg,
+		Usage:     parseUsage(*fUsage),
+		Created:   time.Now().UTC(),
+		Value:     value,
+	}
+	if err := s.Add(k); err != nil {
+		return util.InvalidInput(err)
+	}
+
+	if err := s.SaveFile(store.path, passphrase); err != nil {
+		return err
+	}
+	if cmd.JSON {
+		return stdfile.WriteJSON(os.Stdout, keyInfo(&k))
+	}
+	return nil
+}
+
+// keyInfo returns the metadata of k, for the JSON output.
+func keyInfo(k *keystore.Key) stdfile.Result {
+	return stdfile.Result{
+		"name":      k.Name,
+		"algorithm": k.Algorithm,
+		"bits":      k.Size(),
+		"created":   k.Created,
+		"usage":     k.Usage,
+	}
+}
+
+// rsaToPKCS1 returns the PKCS#1 DER of an RSA private key
+// given as PKCS#1 or PKCS#8, PEM or DER.
+func rsaToPKCS1(data []byte) ([]byte, error) {
+	if block, _ := pem.Decode(data); block != nil {
+		data = block.Bytes
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+		return data, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, errors.New("expected a PKCS#1 or PKCS#8 RSA private key")
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an RSA private key")
+	}
+	return x509.MarshalPKCS1PrivateKey(rsaKey), nil
+}
+
+var GenerateCmd = &cmd.Command{
+	Name:  "keystore-generate",
+	Run:   runGenerate,
+	Brief: "Generate a key in the keystore",
+
+	Usage: `Usage: pocryp keystore-generate [-keystore PATH] [-pass SOURCE] [-kdf KDF] -alg ALG [-bits N] [-usage USAGE] NAME
+
+Generate a random key and add it to the keystore, as NAME.
+The keystore is created if it doesn't exist.
+
+Algorithms:
+  aes      AES key, -bits 128(default), 192 or 256
+  ed25519  ED25519 private key
+  rsa      RSA private key, -bits 2048 or more
+  raw      random secret of -bits bits
+` + storeHelp,
+}
+
+func runGenerate(cmd *cmd.Command) error {
+	store := addStoreFlags(cmd.Flags, true)
+	fAlg := cmd.Flags.String("alg", "", "Algorithm of the key: "+strings.Join(keystore.Algorithms, ", ")+".")
+	fBits := cmd.Flags.Int("bits", 0, "Size of the key in bits, for aes, rsa and raw.")
+	fUsage := cmd.Flags.String("usage", "", "Comma separated usages of the key, e.g. encrypt,mac.")
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if cmd.Flags.NArg() != 1 {
+		cmd.Flags.Usage()
+		return errors.New("key name not specified")
+	}
+
+	bits := *fBits
+	if bits == 0 {
+		switch *fAlg {
+		case keystore.AlgAES, keystore.AlgRaw:
+			bits = 128
+		case keystore.AlgRSA:
+			bits = 2048
+		}
+	}
+	if *fAlg == keystore.AlgRSA && bits < 2048 {
+		return fmt.Errorf("invalid RSA key size: %d bits", bits)
+	}
+
+	k, err := keystore.Generate(cmd.Flags.Arg(0), *fAlg, bits, parseUsage(*fUsage))
+	if err != nil {
+		return err
+	}
+
+	s, passphrase, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	defer secret.Wipe(passphrase)
+	if err := s.Add(k); err != nil {
+		return util.InvalidInput(err)
+	}
+
+	if err := s.SaveFile(store.path, passphrase); err != nil {
+		return err
+	}
+	if cmd.JSON {
+		return stdfile.WriteJSON(os.Stdout, keyInfo(&k))
+	}
+	return nil
+}
+
+var ListCmd = &cmd.Command{
+	Name:  "keystore-list",
+	Run:   runList,
+	Brief: "List the keys of the keystore",
+
+	Usage: `Usage: pocryp keystore-list [-keystore PATH] [-pass SOURCE]
+
+Print the name, algorithm, size, creation time and usages of the keys.
+` + storeHelp,
+}
+
+func runList(cmd *cmd.Command) error {
+	store := addStoreFlags(cmd.Flags, false)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	s, passphrase, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	defer secret.Wipe(passphrase)
+
+	if cmd.JSON {
+		keys := []stdfile.Result{}
+		for i := range s.Keys {
+			keys = append(keys, keyInfo(&s.Keys[i]))
+		}
+		return stdfile.WriteJSON(os.Stdout, stdfile.Result{"keys": keys})
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tALGORITHM\tBITS\tCREATED\tUSAGE")
+	for _, k := range s.Keys {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n",
+			k.Name, k.Algorithm, k.Size(), k.Created.Format(time.RFC3339), strings.Join(k.Usage, ","))
+	}
+	return w.Flush()
+}
+
+var ExportCmd = &cmd.Command{
+	Name:  "keystore-export",
+	Run:   runExport,
+	Brief: "Export a key from the keystore",
+
+	Usage: `Usage: pocryp keystore-export [-keystore PATH] [-pass SOURCE] [-pem] [-out OUTPUT] NAME
+
+Write the value of the key NAME: the raw key for aes and raw, the 64 bytes
+private key for ed25519 and the PKCS#1 DER private key for rsa.
+With -pem, an rsa key is written as PKCS#1 PEM.
+
+If -out is not specified, the output will be printed to stdout.
+` + storeHelp,
+}
+
+func runExport(cmd *cmd.Command) error {
+	store := addStoreFlags(cmd.Flags, false)
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fPem := cmd.Flags.Bool("pem", false, "Write an rsa key as PEM.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if cmd.Flags.NArg() != 1 {
+		cmd.Flags.Usage()
+		return errors.New("key name not specified")
+	}
+
+	s, passphrase, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	defer secret.Wipe(passphrase)
+	k, err := s.Get(cmd.Flags.Arg(0))
+	if err != nil {
+		return util.KeystoreError(err)
+	}
+
+	if *fPem && k.Algorithm != keystore.AlgRSA {
+		return fmt.Errorf("-pem is valid only for %s keys", keystore.AlgRSA)
+	}
+
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	if cmd.JSON {
+		r := keyInfo(k)
+		if *fPem {
+			r["key"] = string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: k.Value}))
+		} else {
+			r["key"] = stdfile.Hex(k.Value)
+		}
+		return sf.WriteJSON(r)
+	}
+
+	if *fPem {
+		if err := pem.Encode(sf.Out, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: k.Value}); err != nil {
+			return err
+		}
+		return sf.Commit()
+	}
+
+	return sf.Write(k.Value, fOut)
+}
+
+var DeleteCmd = &cmd.Command{
+	Name:  "keystore-delete",
+	Run:   runDelete,
+	Brief: "Delete a key from the keystore",
+
+	Usage: `Usage: pocryp keystore-delete [-keystore PATH] [-pass SOURCE] NAME
+
+Delete the key NAME from the keystore.
+` + storeHelp,
+}
+
+func runDelete(cmd *cmd.Command) error {
+	store := addStoreFlags(cmd.Flags, false)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if cmd.Flags.NArg() != 1 {
+		cmd.Flags.Usage()
+		return errors.New("key name not specified")
+	}
+
+	s, passphrase, err := store.open()
+	if err != nil {
+		return err
+	}
+	defer s.Destroy()
+	defer secret.Wipe(passphrase)
+	if err := s.Delete(cmd.Flags.Arg(0)); err != nil {
+		return util.KeystoreError(err)
+	}
+
+	if err := s.SaveFile(store.path, passphrase); err != nil {
+		return err
+	}
+	if cmd.JSON {
+		return stdfile.WriteJSON(os.Stdout, stdfile.Result{"name": cmd.Flags.Arg(0), "deleted": true})
+	}
+	return nil
+}
+
+// storeFlags contains the flags common to the keystore commands.
+type storeFlags struct {
+	fPath *string
+	fPass *string
+	fKDF  *string
+
+	path string
+}
+
+// addStoreFlags defines the flags, -kdf is defined only if the command
+// can create the keystore.
+func addStoreFlags(fs *flag.FlagSet, create bool) *storeFlags {
+	f := &storeFlags{
+		fPath: fs.String("keystore", "", "Path of the keystore."),
+		fPass: fs.String("pass", "", "Read the passphrase from SOURCE(env:NAME, fd:N, prompt, - or a file path)."),
+	}
+	if create {
+		f.fKDF = fs.String("kdf", keystore.Argon2id.Name, "KDF of a new keystore: argon2id or pbkdf2.")
+	}
+	return f
+}
+
+// open loads the keystore, if the keystore doesn't exist and the command
+// can create it, a new empty one is returned.
+func (f *storeFlags) open() (*keystore.Store, []byte, error) {
+	create := f.fKDF != nil
+	f.path = *f.fPath
+	if f.path == "" {
+		var err error
+		if f.path, err = keystore.DefaultPath(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	_, err := os.Stat(f.path)
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, err
+	}
+	if !exists && !create {
+		return nil, nil, util.InvalidInput(fmt.Errorf("keystore %s does not exist", f.path))
+	}
+
+	passphrase, err := util.ReadPassphrase(*f.fPass)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if exists {
+		s, err := keystore.Open(f.path, passphrase)
+		if err != nil {
+			return nil, nil, util.KeystoreError(err)
+		}
+		return s, passphrase, nil
+	}
+
+	kdf, ok := keystore.KDFs[*f.fKDF]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown KDF %q", *f.fKDF)
+	}
+	if f.prompted() {
+		confirm, err := util.ReadPassphrase("prompt")
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(passphrase, confirm) {
+			return nil, nil, errors.New("passphrases do not match")
+		}
+	}
+	return keystore.New(kdf), passphrase, nil
+}
+
+// prompted returns true if the passphrase was read from a prompt.
+func (f *storeFlags) prompted() bool {
+	if *f.fPass != "" {
+		return *f.fPass == "prompt"
+	}
+	_, ok := os.LookupEnv(keystore.PassEnv)
+	return !ok
+}
+
+func parseUsage(s string) []string {
+	var usage []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			usage = append(usage, v)
+		}
+	}
+	return usage
+}
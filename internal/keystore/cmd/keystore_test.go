@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/keystore"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestKeystore(t *testing.T) {
+	tmp := t.TempDir()
+	path := filepath.Join(tmp, "keystore.json")
+	out := filepath.Join(tmp, "out")
+	rsaFile := filepath.Join(tmp, "rsa.pem")
+
+	t.Setenv(keystore.PathEnv, path)
+	t.Setenv(keystore.PassEnv, "secret")
+	t.Setenv("POCRYP_TEST_PASS", "other")
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.SetupIn(t, rsaFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	tests := []struct {
+		name  string
+		cmd   string
+		args  []string
+		valid bool
+	}{
+		{"ListMissing", "list", nil, false},
+		{"GenerateAES", "generate", []string{"-alg", "aes", "-bits", "256", "-usage", "encrypt,mac", "k1"}, true},
+		{"GenerateEd25519", "generate", []string{"-alg", "ed25519", "k2"}, true},
+		{"GenerateSmallRSA", "generate", []string{"-alg", "rsa", "-bits", "1024", "k3"}, false},
+		{"GenerateUnknownAlg", "generate", []string{"-alg", "des", "k3"}, false},
+		{"GenerateExisting", "generate", []string{"-alg", "aes", "k1"}, false},
+		{"AddRaw", "add", []string{"-alg", "raw", "-key", "00010203", "k3"}, true},
+		{"AddRSA", "add", []string{"-alg", "rsa", "-key-file", rsaFile, "k4"}, true},
+		{"AddInvalidAES", "add", []string{"-alg", "aes", "-key", "0001", "k5"}, false},
+		{"AddNoAlg", "add", []string{"-key", "0001", "k5"}, false},
+		{"AddNoName", "add", []string{"-alg", "raw", "-key", "0001"}, false},
+		{"List", "list", nil, true},
+		{"ListWrongPass", "list", []string{"-pass", "env:POCRYP_TEST_PASS"}, false},
+		{"ExportRaw", "export", []string{"-bin", "-out", out, "k3"}, true},
+		{"ExportRSA", "export", []string{"-pem", "k4"}, true},
+		{"ExportPemNotRSA", "export", []string{"-pem", "k1"}, false},
+		{"Delete", "delete", []string{"k1"}, true},
+		{"DeleteMissing", "delete", []string{"k1"}, false},
+		{"ExportMissing", "export", []string{"k1"}, false},
+	}
+	cmds := map[string]func(...string) error{
+		"add":      func(args ...string) error { return testutil.RunCmd(AddCmd, args...) },
+		"generate": func(args ...string) error { return testutil.RunCmd(GenerateCmd, args...) },
+		"list":     func(args ...string) error { return testutil.RunCmd(ListCmd, args...) },
+		"export":   func(args ...string) error { return testutil.RunCmd(ExportCmd, args...) },
+		"delete":   func(args ...string) error { return testutil.RunCmd(DeleteCmd, args...) },
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := cmds[tt.cmd](tt.args...)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	testutil.ExpectFileContentHex(t, out, "00010203")
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("keystore permissions: %o", perm)
+	}
+
+	s, err := keystore.Open(path, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k4, err := s.Get("k4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k4.Size() != 1024 {
+		t.Fatal("unexpected RSA key size", k4.Size())
+	}
+	if _, err := s.Get("k1"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,397 @@
+// Package keystore implements a passphrase protected file of named keys.
+//
+// The keys are stored as JSON encrypted with AES-256-GCM, the encryption key
+// is derived from the passphrase with Argon2id or PBKDF2(HMAC-SHA256). The
+// KDF parameters are stored in clear and authenticated as additional data.
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"bandr.me/p/pocryp/internal/secret"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// PathEnv is the environment variable with the path of the keystore.
+	PathEnv = "POCRYP_KEYSTORE"
+
+	// PassEnv is the environment variable with the passphrase of the keystore.
+	PassEnv = "POCRYP_KEYSTORE_PASS"
+)
+
+// Algorithms of the keys.
+const (
+	AlgAES     = "aes"
+	AlgEd25519 = "ed25519"
+	AlgRSA     = "rsa"
+	AlgRaw     = "raw"
+)
+
+// Algorithms contains the valid algorithms of a key.
+var Algorithms = []string{AlgAES, AlgEd25519, AlgRSA, AlgRaw}
+
+var (
+	ErrNotFound   = errors.New("key not found")
+	ErrExists     = errors.New("key already exists")
+	ErrPassphrase = errors.New("wrong passphrase or corrupted keystore")
+)
+
+// version of the file format written by Save.
+const version = 1
+
+// DefaultPath returns the path from PathEnv or, if not set,
+// pocryp/keystore.json in the user config directory.
+func DefaultPath() (string, error) {
+	if v := os.Getenv(PathEnv); v != "" {
+		return v, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("keystore path: %w", err)
+	}
+	return filepath.Join(dir, "pocryp", "keystore.json"), nil
+}
+
+// KDF contains the parameters used to derive the encryption key.
+type KDF struct {
+	Name string
+	Salt []byte
+
+	// time cost of Argon2id or iterations of PBKDF2
+	Iter uint32
+
+	// memory in KiB and parallelism of Argon2id
+	Memory  uint32 `json:",omitempty"`
+	Threads uint8  `json:",omitempty"`
+}
+
+var (
+	Argon2id = KDF{Name: "argon2id", Iter: 3, Memory: 64 * 1024, Threads: 4}
+	PBKDF2   = KDF{Name: "pbkdf2", Iter: 600000}
+)
+
+// KDFs contains the default parameters of each KDF, by name.
+var KDFs = map[string]KDF{
+	Argon2id.Name: Argon2id,
+	PBKDF2.Name:   PBKDF2,
+}
+
+func (k KDF) derive(passphrase []byte) ([]byte, error) {
+	if len(k.Salt) < 16 {
+		return nil, fmt.Errorf("KDF salt too short: %d", len(k.Salt))
+	}
+	if k.Iter == 0 {
+		return nil, errors.New("KDF iterations cannot be zero")
+	}
+	switch k.Name {
+	case Argon2id.Name:
+		if k.Memory == 0 || k.Threads == 0 {
+			return nil, errors.New("argon2id memory and threads cannot be zero")
+		}
+		return argon2.IDKey(passphrase, k.Salt, k.Iter, k.Memory, k.Threads, 32), nil
+	case PBKDF2.Name:
+		return pbkdf2.Key(passphrase, k.Salt, int(k.Iter), 32, sha256.New), nil
+	default:
+		return nil, fmt.Errorf("unknown KDF %q", k.Name)
+	}
+}
+
+// Key is a named key and its metadata.
+type Key struct {
+	Name      string
+	Algorithm string
+	Usage     []string `json:",omitempty"`
+	Created   time.Time
+
+	// raw key for aes and raw, private key for ed25519,
+	// PKCS#1 DER private key for rsa
+	Value []byte
+}
+
+// Size returns the size of the key in bits.
+func (k Key) Size() int {
+	if k.Algorithm == AlgRSA {
+		if key, err := x509.ParsePKCS1PrivateKey(k.Value); err == nil {
+			return key.N.BitLen()
+		}
+	}
+	if k.Algorithm == AlgEd25519 {
+		return 256
+	}
+	return len(k.Value) * 8
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Validate checks the name of the key and that the value is valid
+// for the algorithm.
+func (k Key) Validate() error {
+	if !validName.MatchString(k.Name) {
+		return fmt.Errorf("invalid key name %q, expected letters, digits, '.', '_' or '-'", k.Name)
+	}
+	switch k.Algorithm {
+	case AlgAES:
+		if n := len(k.Value); n != 16 && n != 24 && n != 32 {
+			return fmt.Errorf("invalid AES key size: %d", n)
+		}
+	case AlgEd25519:
+		if n := len(k.Value); n != ed25519.PrivateKeySize {
+			return fmt.Errorf("invalid ED25519 private key size: %d", n)
+		}
+	case AlgRSA:
+		if _, err := x509.ParsePKCS1PrivateKey(k.Value); err != nil {
+			return fmt.Errorf("invalid RSA private key: %w", err)
+		}
+	case AlgRaw:
+		if len(k.Value) == 0 {
+			return errors.New("empty key")
+		}
+	default:
+		return fmt.Errorf("unknown algorithm %q, valid: %s", k.Algorithm, strings.Join(Algorithms, ", "))
+	}
+	return nil
+}
+
+// Generate returns a new random key, bits is used only for aes and rsa.
+func Generate(name, alg string, bits int, usage []string) (Key, error) {
+	k := Key{
+		Name:      name,
+		Algorithm: alg,
+		Usage:     usage,
+		Created:   time.Now().UTC(),
+	}
+	switch alg {
+	case AlgAES, AlgRaw:
+		if bits <= 0 || bits%8 != 0 {
+			return k, fmt.Errorf("invalid key size: %d bits", bits)
+		}
+		k.Value = make([]byte, bits/8)
+		if _, err := rand.Read(k.Value); err != nil {
+			return k, err
+		}
+	case AlgEd25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return k, err
+		}
+		k.Value = priv
+	case AlgRSA:
+		priv, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return k, err
+		}
+		k.Value = x509.MarshalPKCS1PrivateKey(priv)
+	}
+	if err := k.Validate(); err != nil {
+		return k, err
+	}
+	return k, nil
+}
+
+// Store contains the keys of a keystore, sorted by name.
+type Store struct {
+	KDF  KDF
+	Keys []Key
+}
+
+// file is the format of a saved keystore.
+type file struct {
+	Version int
+	KDF     KDF
+	Nonce   []byte
+	Data    []byte
+}
+
+// New returns an empty store, protected with the given KDF.
+func New(kdf KDF) *Store {
+	return &Store{KDF: kdf}
+}
+
+// Load reads and decrypts a store saved with Save.
+func Load(r io.Reader, passphrase []byte) (*Store, error) {
+	var f file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	if f.Version != version {
+		return nil, fmt.Errorf("keystore: unsupported version %d", f.Version)
+	}
+
+	aead, ad, err := newAEAD(f.Version, f.KDF, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("keystore: invalid nonce size: %d", len(f.Nonce))
+	}
+	data, err := aead.Open(nil, f.Nonce, f.Data, ad)
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	defer secret.Wipe(data)
+
+	s := &Store{KDF: f.KDF}
+	if err := json.Unmarshal(data, &s.Keys); err != nil {
+		return nil, fmt.Errorf("keystore: %w", err)
+	}
+	return s, nil
+}
+
+// Save encrypts and writes the store, a new salt and nonce are used every time.
+func (s *Store) Save(w io.Writer, passphrase []byte) error {
+	f := file{
+		Version: version,
+		KDF:     s.KDF,
+		Nonce:   make([]byte, 12),
+	}
+	f.KDF.Salt = make([]byte, 16)
+	if _, err := rand.Read(f.KDF.Salt); err != nil {
+		return err
+	}
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return err
+	}
+
+	aead, ad, err := newAEAD(f.Version, f.KDF, passphrase)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(s.Keys)
+	if err != nil {
+		return err
+	}
+	defer secret.Wipe(data)
+	f.Data = aead.Seal(nil, f.Nonce, data, ad)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(f)
+}
+
+// newAEAD returns the cipher of the keys and the additional data,
+// which binds the version and the KDF parameters to the ciphertext.
+func newAEAD(version int, kdf KDF, passphrase []byte) (cipher.AEAD, []byte, error) {
+	if len(passphrase) == 0 {
+		return nil, nil, errors.New("keystore: empty passphrase")
+	}
+	key, err := kdf.derive(passphrase)
+	if err != nil {
+		return nil, nil, fmt.Errorf("keystore: %w", err)
+	}
+	defer secret.Wipe(key)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	ad, err := json.Marshal(struct {
+		Version int
+		KDF     KDF
+	}{version, kdf})
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, ad, nil
+}
+
+// Get returns the key with the given name.
+func (s *Store) Get(name string) (*Key, error) {
+	for i := range s.Keys {
+		if s.Keys[i].Name == name {
+			return &s.Keys[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Add validates and adds k, the name must not be used by another key.
+func (s *Store) Add(k Key) error {
+	if err := k.Validate(); err != nil {
+		return err
+	}
+	if _, err := s.Get(k.Name); err == nil {
+		return fmt.Errorf("%w: %s", ErrExists, k.Name)
+	}
+	if k.Created.IsZero() {
+		k.Created = time.Now().UTC()
+	}
+	s.Keys = append(s.Keys, k)
+	sort.Slice(s.Keys, func(i, j int) bool {
+		return s.Keys[i].Name < s.Keys[j].Name
+	})
+	return nil
+}
+
+// Delete removes the key with the given name.
+func (s *Store) Delete(name string) error {
+	for i := range s.Keys {
+		if s.Keys[i].Name == name {
+			secret.Wipe(s.Keys[i].Value)
+			s.Keys = append(s.Keys[:i], s.Keys[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrNotFound, name)
+}
+
+// Destroy zeroizes the values of the keys.
+func (s *Store) Destroy() {
+	for _, k := range s.Keys {
+		secret.Wipe(k.Value)
+	}
+}
+
+// Open loads the store from the file at path.
+func Open(path string, passphrase []byte) (*Store, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f, passphrase)
+}
+
+// SaveFile saves the store to the file at path, the file is replaced
+// atomically and it is readable only by its owner.
+func (s *Store) SaveFile(path string, passphrase []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if err := s.Save(f, passphrase); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
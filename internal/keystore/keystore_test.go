@@ -0,0 +1,154 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// cheap parameters, so the tests are fast
+var testKDFs = []KDF{
+	{Name: "argon2id", Iter: 1, Memory: 64, Threads: 1},
+	{Name: "pbkdf2", Iter: 1000},
+}
+
+func TestStore(t *testing.T) {
+	passphrase := []byte("correct horse battery staple")
+
+	for _, kdf := range testKDFs {
+		t.Run(kdf.Name, func(t *testing.T) {
+			s := New(kdf)
+			for _, alg := range Algorithms {
+				bits := 128
+				if alg == AlgRSA {
+					bits = 1024
+				}
+				k, err := Generate("key-"+alg, alg, bits, []string{"test"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := s.Add(k); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var buf bytes.Buffer
+			if err := s.Save(&buf, passphrase); err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Contains(buf.Bytes(), s.Keys[0].Value) {
+				t.Fatal("key value written in clear")
+			}
+			saved := buf.Bytes()
+
+			loaded, err := Load(bytes.NewReader(saved), passphrase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(loaded.Keys) != len(s.Keys) {
+				t.Fatalf("have %d keys, want %d", len(loaded.Keys), len(s.Keys))
+			}
+			for i, k := range s.Keys {
+				have := loaded.Keys[i]
+				if have.Name != k.Name || have.Algorithm != k.Algorithm ||
+					!bytes.Equal(have.Value, k.Value) || !have.Created.Equal(k.Created) {
+					t.Fatalf("have %+v, want %+v", have, k)
+				}
+			}
+
+			t.Run("WrongPassphrase", func(t *testing.T) {
+				if _, err := Load(bytes.NewReader(saved), []byte("wrong")); !errors.Is(err, ErrPassphrase) {
+					t.Fatal("expected ErrPassphrase, have", err)
+				}
+			})
+
+			t.Run("ModifiedKDF", func(t *testing.T) {
+				var f file
+				if err := json.Unmarshal(saved, &f); err != nil {
+					t.Fatal(err)
+				}
+				f.KDF.Iter++
+				modified, err := json.Marshal(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := Load(bytes.NewReader(modified), passphrase); !errors.Is(err, ErrPassphrase) {
+					t.Fatal("expected ErrPassphrase, have", err)
+				}
+			})
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	s := New(testKDFs[1])
+
+	k := Key{Name: "k1", Algorithm: AlgAES, Value: make([]byte, 16)}
+	if err := s.Add(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(k); !errors.Is(err, ErrExists) {
+		t.Fatal("expected ErrExists, have", err)
+	}
+	if have, err := s.Get("k1"); err != nil || have.Size() != 128 || have.Created.IsZero() {
+		t.Fatal("unexpected key", have, err)
+	}
+
+	if err := s.Delete("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get("k1"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, have", err)
+	}
+	if err := s.Delete("k1"); !errors.Is(err, ErrNotFound) {
+		t.Fatal("expected ErrNotFound, have", err)
+	}
+
+	for _, k := range []Key{
+		{Name: "", Algorithm: AlgAES, Value: make([]byte, 16)},
+		{Name: "@k", Algorithm: AlgAES, Value: make([]byte, 16)},
+		{Name: "a b", Algorithm: AlgAES, Value: make([]byte, 16)},
+		{Name: "k", Algorithm: AlgAES, Value: make([]byte, 15)},
+		{Name: "k", Algorithm: AlgEd25519, Value: make([]byte, 32)},
+		{Name: "k", Algorithm: AlgRSA, Value: make([]byte, 32)},
+		{Name: "k", Algorithm: AlgRaw},
+		{Name: "k", Algorithm: "des", Value: make([]byte, 8)},
+	} {
+		t.Run(k.Name+"-"+k.Algorithm, func(t *testing.T) {
+			if err := s.Add(k); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	if _, err := Generate("k", AlgAES, 100, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dir", "keystore.json")
+	passphrase := []byte("secret")
+
+	s := New(testKDFs[0])
+	if err := s.Add(Key{Name: "k", Algorithm: AlgRaw, Value: []byte{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFile(path, passphrase); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Open(path, passphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loaded.Get("k"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(PathEnv, path)
+	if have, err := DefaultPath(); err != nil || have != path {
+		t.Fatal("unexpected path", have, err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
 	"bandr.me/p/pocryp/internal/keywrap/aes"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/util"
 	"bandr.me/p/pocryp/internal/util/stdfile"
 )
@@ -28,9 +29,11 @@ func run(cmd *cmd.Command) error {
 	fUnwrap := cmd.Flags.Bool("u", false, "Unwrap the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
 	fKey := cmd.Flags.String("key", "", "Key as hex.")
 	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -39,34 +42,47 @@ func run(cmd *cmd.Command) error {
 		return err
 	}
 
-	key, err := util.FileOrHex(*fKeyFile, *fKey)
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
 	if err != nil {
 		return fmt.Errorf("key: %w", err)
 	}
+	defer key.Destroy()
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	fOut.Secret = *fUnwrap
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
+	// the key, when wrapping
+	defer secret.Wipe(input)
 
 	var output []byte
 	switch {
 	case *fWrap:
-		output, err = aes.Wrap(key, input)
+		output, err = aes.Wrap(key.Bytes(), input)
 	case *fUnwrap:
-		output, err = aes.Unwrap(key, input)
+		output, err = aes.Unwrap(key.Bytes(), input)
 	default:
-		output, err = aes.Wrap(key, input)
+		output, err = aes.Wrap(key.Bytes(), input)
 	}
 	if err != nil {
 		return err
 	}
+	// the key, when unwrapping
+	defer secret.Wipe(output)
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		if *fUnwrap {
+			return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(output)})
+		}
+		return sf.WriteJSON(stdfile.Result{"wrapped_key": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
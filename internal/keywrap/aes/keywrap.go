@@ -19,7 +19,7 @@ func Wrap(kek, plaintext []byte) ([]byte, error) {
 	P := plaintext
 
 	if len(P)%blkSize != 0 {
-		return nil, errors.New("plaintext not 8 byte aligned")
+		return nil, util.InvalidInput(errors.New("plaintext not 8 byte aligned"))
 	}
 
 	block, err := aes.NewCipher(kek)
@@ -134,7 +134,7 @@ func Unwrap(kek, ciphertext []byte) ([]byte, error) {
 	}
 
 	if subtle.ConstantTimeCompare(A, aesKeyWrapDefaultIV) != 1 {
-		return nil, errors.New("integrity check failed - unexpected IV")
+		return nil, util.VerificationFailed(errors.New("integrity check failed - unexpected IV"))
 	}
 
 	// 3) Output results.
@@ -19,11 +19,15 @@ Hex encode or decode(if -d is specified) input to output.
 
 If -in is not specified, stdin will be read.
 If -out is not specified, the output will be printed to stdout.
+
+If -bin or -out-format is specified, the input(or the decoded input) is
+written in that format, e.g. -d -out-format c turns hex into a C array.
 `,
 }
 
 func runHex(cmd *cmd.Command) error {
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
 	fDecode := cmd.Flags.Bool("d", false, "Decode data.")
 
@@ -34,7 +38,7 @@ func runHex(cmd *cmd.Command) error {
 		return err
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
@@ -45,18 +49,30 @@ func runHex(cmd *cmd.Command) error {
 		return err
 	}
 
-	var output string
+	data := input
 	if *fDecode {
-		b, err := hex.DecodeString(string(input))
+		data, err = hex.DecodeString(string(input))
 		if err != nil {
 			return fmt.Errorf("failed to decode input: %w", err)
 		}
-		output = string(b)
-	} else {
-		output = hex.EncodeToString(input)
 	}
 
-	fmt.Fprint(sf.Out, output)
+	if cmd.JSON {
+		if *fDecode {
+			return sf.WriteJSON(stdfile.Result{"data": stdfile.Hex(data)})
+		}
+		return sf.WriteJSON(stdfile.Result{"hex": hex.EncodeToString(data)})
+	}
+
+	if !fOut.IsSet() {
+		if !*fDecode {
+			if _, err := fmt.Fprint(sf.Out, hex.EncodeToString(data)); err != nil {
+				return err
+			}
+			return sf.Commit()
+		}
+		fOut.Format = "bin"
+	}
 
-	return nil
+	return sf.Write(data, fOut)
 }
@@ -27,7 +27,8 @@ func run(cmd *cmd.Command) error {
 	fUnpad := cmd.Flags.Bool("u", false, "Unpad the input to the output.")
 	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
 	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
-	fBin := cmd.Flags.Bool("bin", false, "Print output in binary form not hex.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 	fBlockSize := cmd.Flags.Uint("bs", 0, "Block size.")
 
 	if isHelp, err := cmd.Parse(); err != nil {
@@ -41,13 +42,13 @@ func run(cmd *cmd.Command) error {
 		return fmt.Errorf("block size must be the following range [1, 255]")
 	}
 
-	sf, err := stdfile.New(*fInput, *fOutput)
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
 	if err != nil {
 		return err
 	}
 	defer sf.Close()
 
-	input, err := sf.Read()
+	input, err := sf.ReadAs(fInFormat)
 	if err != nil {
 		return err
 	}
@@ -67,5 +68,9 @@ func run(cmd *cmd.Command) error {
 		return err
 	}
 
-	return sf.WriteHexOrBin(output, *fBin)
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"data": stdfile.Hex(output)})
+	}
+
+	return sf.Write(output, fOut)
 }
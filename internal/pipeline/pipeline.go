@@ -0,0 +1,308 @@
+// Package pipeline implements a YAML file of pocryp commands which are run
+// in order, the results of a command are given to the next ones as
+// variables, e.g.:
+//
+//	vars:
+//	  kek: 000102030405060708090a0b0c0d0e0f
+//	steps:
+//	  - name: key
+//	    run: aes-keygen 128
+//	  - name: wrap
+//	    run: aes keywrap wrap -key ${kek}
+//	    in: ${key.key}
+//	  - name: mac
+//	    run: [aes-cmac-generate, -key, "${key.key}"]
+//	    in-text: hello
+//	outputs: [wrap.wrapped_key, mac.mac]
+//
+// Every command is run with -json, the fields of its result are the
+// variables STEP.FIELD. ${NAME} in run, in, in-text and expect is replaced
+// by the value of the variable NAME, binary values are hex.
+package pipeline
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/secret"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrAssertion is returned when a step has not the expected result.
+	ErrAssertion = errors.New("assertion failed")
+
+	// ErrUnknownVariable is returned for a reference to a variable which
+	// is not defined(yet).
+	ErrUnknownVariable = errors.New("unknown variable")
+)
+
+type Pipeline struct {
+	// the variables defined before the first step
+	Vars map[string]string `yaml:"vars"`
+
+	Steps []Step `yaml:"steps"`
+
+	// the variables returned by Run
+	Outputs []string `yaml:"outputs"`
+}
+
+type Step struct {
+	// the prefix of the variables of the result, optional
+	Name string `yaml:"name"`
+
+	// the command line, without pocryp
+	Run Args `yaml:"run"`
+
+	// the stdin of the command, as hex or as text, empty if both are unset
+	In     string `yaml:"in"`
+	InText string `yaml:"in-text"`
+
+	// the expected values of the fields of the result
+	Expect map[string]string `yaml:"expect"`
+
+	// the category of the expected error, e.g. verification-failed
+	ExpectError string `yaml:"expect-error"`
+}
+
+// Args is a command line, given as a string split at spaces or as a list
+// of arguments.
+type Args []string
+
+func (a *Args) UnmarshalYAML(n *yaml.Node) error {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		*a = strings.Fields(n.Value)
+		return nil
+	case yaml.SequenceNode:
+		var v []string
+		if err := n.Decode(&v); err != nil {
+			return err
+		}
+		*a = v
+		return nil
+	}
+	return fmt.Errorf("line %d: run must be a string or a list of strings", n.Line)
+}
+
+var (
+	nameRe = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+	varRe  = regexp.MustCompile(`\$\{([A-Za-z0-9_.-]+)\}`)
+)
+
+// Parse returns the pipeline decoded from data, unknown fields are errors.
+func Parse(data []byte) (*Pipeline, error) {
+	var p Pipeline
+	d := yaml.NewDecoder(bytes.NewReader(data))
+	d.KnownFields(true)
+	if err := d.Decode(&p); err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("pipeline: %w", err)
+	}
+	return &p, nil
+}
+
+func (p Pipeline) validate() error {
+	for name := range p.Vars {
+		if !nameRe.MatchString(name) {
+			return fmt.Errorf("invalid variable name '%s'", name)
+		}
+	}
+	if len(p.Steps) == 0 {
+		return errors.New("no steps")
+	}
+	names := map[string]bool{}
+	for i, s := range p.Steps {
+		if s.Name != "" {
+			if !nameRe.MatchString(s.Name) {
+				return fmt.Errorf("step #%d: invalid name '%s'", i+1, s.Name)
+			}
+			if names[s.Name] {
+				return fmt.Errorf("step #%d: duplicate name '%s'", i+1, s.Name)
+			}
+			names[s.Name] = true
+		}
+		if len(s.Run) == 0 {
+			return fmt.Errorf("step %s: run is empty", s.label(i))
+		}
+		if s.In != "" && s.InText != "" {
+			return fmt.Errorf("step %s: in and in-text are both set", s.label(i))
+		}
+		if s.ExpectError != "" && len(s.Expect) != 0 {
+			return fmt.Errorf("step %s: expect and expect-error are both set", s.label(i))
+		}
+	}
+	return nil
+}
+
+// label returns the name of s, or its number if it has none.
+func (s Step) label(i int) string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return fmt.Sprintf("#%d", i+1)
+}
+
+// Output is a variable given in Outputs.
+type Output struct {
+	Name  string
+	Value string
+}
+
+// Runner runs the steps of a pipeline.
+type Runner struct {
+	// Exec runs the command line args with stdin, it returns what the
+	// command wrote to stdout, which is a JSON object.
+	Exec func(args []string, stdin []byte) ([]byte, error)
+
+	// Category returns the name of the category of an error returned by
+	// Exec, which is compared with ExpectError.
+	Category func(error) string
+
+	// Done is called after every step which passed, if not nil.
+	Done func(label string)
+}
+
+// Run runs the steps of p in order and stops at the first which fails.
+func (r Runner) Run(p *Pipeline) ([]Output, error) {
+	vars := map[string]string{}
+	for k, v := range p.Vars {
+		vars[k] = v
+	}
+
+	for i, s := range p.Steps {
+		if err := r.step(s, vars); err != nil {
+			return nil, fmt.Errorf("step %s: %w", s.label(i), err)
+		}
+		if r.Done != nil {
+			r.Done(s.label(i))
+		}
+	}
+
+	var outputs []Output
+	for _, name := range p.Outputs {
+		v, ok := vars[name]
+		if !ok {
+			return nil, fmt.Errorf("output: %w '%s'", ErrUnknownVariable, name)
+		}
+		outputs = append(outputs, Output{Name: name, Value: v})
+	}
+	return outputs, nil
+}
+
+func (r Runner) step(s Step, vars map[string]string) error {
+	var args []string
+	for _, arg := range s.Run {
+		v, err := expand(arg, vars)
+		if err != nil {
+			return err
+		}
+		args = append(args, v)
+	}
+
+	var stdin []byte
+	switch {
+	case s.In != "":
+		v, err := expand(s.In, vars)
+		if err != nil {
+			return err
+		}
+		stdin, err = hex.DecodeString(strings.Join(strings.Fields(v), ""))
+		if err != nil {
+			return fmt.Errorf("in: %w", err)
+		}
+	case s.InText != "":
+		v, err := expand(s.InText, vars)
+		if err != nil {
+			return err
+		}
+		stdin = []byte(v)
+	}
+	defer secret.Wipe(stdin)
+
+	out, err := r.Exec(args, stdin)
+	defer secret.Wipe(out)
+	if s.ExpectError != "" {
+		if err == nil {
+			return fmt.Errorf("%w: expected %s error, the command passed", ErrAssertion, s.ExpectError)
+		}
+		if have := r.Category(err); have != s.ExpectError {
+			return fmt.Errorf("%w: expected %s error, have %s error: %v", ErrAssertion, s.ExpectError, have, err)
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	result := map[string]any{}
+	if err := json.Unmarshal(out, &result); err != nil {
+		return fmt.Errorf("result is not a JSON object: %w", err)
+	}
+	fields := map[string]string{}
+	for k, v := range result {
+		if str, ok := v.(string); ok {
+			fields[k] = str
+			continue
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fields[k] = string(b)
+	}
+
+	for field, want := range s.Expect {
+		want, err := expand(want, vars)
+		if err != nil {
+			return err
+		}
+		have, ok := fields[field]
+		if !ok {
+			return fmt.Errorf("%w: the result has no field '%s'", ErrAssertion, field)
+		}
+		if !sameValue(have, want) {
+			return fmt.Errorf("%w: %s is %s, expected %s", ErrAssertion, field, have, want)
+		}
+	}
+
+	if s.Name != "" {
+		for k, v := range fields {
+			vars[s.Name+"."+k] = v
+		}
+	}
+	return nil
+}
+
+// expand replaces the variables of s with their values.
+func expand(s string, vars map[string]string) (string, error) {
+	var err error
+	r := varRe.ReplaceAllStringFunc(s, func(m string) string {
+		name := varRe.FindStringSubmatch(m)[1]
+		v, ok := vars[name]
+		if !ok && err == nil {
+			err = fmt.Errorf("%w '%s'", ErrUnknownVariable, name)
+		}
+		return v
+	})
+	return r, err
+}
+
+// sameValue returns true if have equals want, hex values are compared
+// regardless of case.
+func sameValue(have, want string) bool {
+	if have == want {
+		return true
+	}
+	a, errA := hex.DecodeString(have)
+	b, errB := hex.DecodeString(want)
+	return errA == nil && errB == nil && bytes.Equal(a, b)
+}
@@ -0,0 +1,186 @@
+package pipeline
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testPipeline = `
+vars:
+  key: 0001
+steps:
+  - name: a
+    run: xor -key ${key}
+    in: ff00
+  - name: b
+    run: [xor, -key, "${a.out}"]
+    in-text: "\x0f\x0f"
+    expect:
+      out: F00E
+      n: "2"
+  - run: fail
+    expect-error: verification-failed
+outputs: [a.out, b.out]
+`
+
+// testExec runs xor, which xors stdin with the hex key given after -key,
+// and fail, which fails.
+func testExec(t *testing.T) func([]string, []byte) ([]byte, error) {
+	return func(args []string, stdin []byte) ([]byte, error) {
+		switch args[0] {
+		case "xor":
+			if len(args) != 3 || args[1] != "-key" {
+				t.Fatalf("unexpected args %v", args)
+			}
+			key, err := hex.DecodeString(args[2])
+			if err != nil {
+				return nil, err
+			}
+			out := make([]byte, len(stdin))
+			for i := range stdin {
+				out[i] = stdin[i] ^ key[i%len(key)]
+			}
+			return []byte(fmt.Sprintf(`{"out": "%x", "n": %d}`, out, len(out))), nil
+		case "fail":
+			return nil, errors.New("not valid")
+		}
+		t.Fatalf("unexpected command %s", args[0])
+		return nil, nil
+	}
+}
+
+func testRunner(t *testing.T, done *[]string) Runner {
+	return Runner{
+		Exec: testExec(t),
+		Category: func(err error) string {
+			if err.Error() == "not valid" {
+				return "verification-failed"
+			}
+			return "error"
+		},
+		Done: func(label string) { *done = append(*done, label) },
+	}
+}
+
+func TestRun(t *testing.T) {
+	p, err := Parse([]byte(testPipeline))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var done []string
+	outputs, err := testRunner(t, &done).Run(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(done, " ") != "a b #3" {
+		t.Fatalf("unexpected steps %v", done)
+	}
+	want := []Output{{"a.out", "ff01"}, {"b.out", "f00e"}}
+	if len(outputs) != len(want) {
+		t.Fatalf("unexpected outputs %v", outputs)
+	}
+	for i := range want {
+		if outputs[i] != want[i] {
+			t.Fatalf("output %d: want %v, have %v", i, want[i], outputs[i])
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+		err      error
+	}{
+		{
+			name: "Mismatch",
+			pipeline: `steps:
+  - run: xor -key 00
+    in: 01
+    expect:
+      out: "02"
+`,
+			err: ErrAssertion,
+		},
+		{
+			name: "NoField",
+			pipeline: `steps:
+  - run: xor -key 00
+    expect:
+      foo: bar
+`,
+			err: ErrAssertion,
+		},
+		{
+			name: "NoError",
+			pipeline: `steps:
+  - run: xor -key 00
+    expect-error: verification-failed
+`,
+			err: ErrAssertion,
+		},
+		{
+			name: "OtherError",
+			pipeline: `steps:
+  - run: fail
+    expect-error: crypto-failure
+`,
+			err: ErrAssertion,
+		},
+		{
+			name: "UnknownVariable",
+			pipeline: `steps:
+  - run: xor -key ${nope}
+`,
+			err: ErrUnknownVariable,
+		},
+		{
+			name: "UnknownOutput",
+			pipeline: `steps:
+  - run: xor -key 00
+outputs: [nope]
+`,
+			err: ErrUnknownVariable,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := Parse([]byte(test.pipeline))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var done []string
+			if _, err := testRunner(t, &done).Run(p); !errors.Is(err, test.err) {
+				t.Fatalf("expected %v, have %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		pipeline string
+	}{
+		{name: "NoSteps", pipeline: "vars: {a: b}"},
+		{name: "UnknownField", pipeline: "steps: [{run: a, foo: b}]"},
+		{name: "EmptyRun", pipeline: "steps: [{name: a}]"},
+		{name: "InvalidRun", pipeline: "steps: [{run: {a: b}}]"},
+		{name: "InvalidName", pipeline: "steps: [{name: a.b, run: a}]"},
+		{name: "DuplicateName", pipeline: "steps: [{name: a, run: a}, {name: a, run: b}]"},
+		{name: "InvalidVar", pipeline: "vars: {a.b: c}\nsteps: [{run: a}]"},
+		{name: "BothIn", pipeline: "steps: [{run: a, in: 00, in-text: a}]"},
+		{name: "BothExpect", pipeline: "steps: [{run: a, expect: {a: b}, expect-error: usage}]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := Parse([]byte(test.pipeline)); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package pkcs11
+
+import "errors"
+
+// ErrNotSupported is returned if pocryp was built without PKCS#11 support.
+var ErrNotSupported = errors.New("PKCS#11 is not supported by this build, rebuild with cgo and -tags pkcs11")
+
+// CMAC returns the AES-CMAC of msg, computed in the token with the key at uri.
+func CMAC(uri string, msg []byte) ([]byte, error) {
+	k, err := OpenKey(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.CMAC(msg)
+}
+
+// SignEd25519 returns the Ed25519 signature of msg, computed in the token
+// with the key at uri.
+func SignEd25519(uri string, msg []byte) ([]byte, error) {
+	k, err := OpenKey(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.SignEd25519(msg)
+}
+
+// GCM encrypts(or decrypts if encrypt is false) data with AES-GCM in the
+// token, with the key at uri.
+func GCM(uri string, iv, data, aad []byte, encrypt bool) ([]byte, error) {
+	k, err := OpenKey(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer k.Close()
+	return k.GCM(iv, data, aad, encrypt)
+}
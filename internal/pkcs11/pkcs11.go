@@ -0,0 +1,265 @@
+//go:build pkcs11 && cgo
+
+package pkcs11
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	p11 "github.com/miekg/pkcs11"
+)
+
+// not defined by github.com/miekg/pkcs11
+const (
+	ckkECEdwards = 0x00000040
+	ckmEdDSA     = 0x00001057
+)
+
+// Key is a key stored in a PKCS#11 token.
+type Key struct {
+	ctx     *p11.Ctx
+	session p11.SessionHandle
+	object  p11.ObjectHandle
+	class   uint
+	keyType uint
+}
+
+// OpenKey returns the key at uri, from a new session with the token.
+func OpenKey(uri string) (*Key, error) {
+	u, err := ParseURI(uri)
+	if err != nil {
+		return nil, err
+	}
+	module, err := u.Module()
+	if err != nil {
+		return nil, err
+	}
+	pin, err := u.PIN()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := p11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("failed to load PKCS#11 module %q", module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+
+	k := &Key{ctx: ctx}
+	if err := k.open(u, pin); err != nil {
+		k.Close()
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (k *Key) open(u *URI, pin string) error {
+	slot, err := findSlot(k.ctx, u)
+	if err != nil {
+		return err
+	}
+
+	k.session, err = k.ctx.OpenSession(slot, p11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return fmt.Errorf("open session: %w", err)
+	}
+
+	if pin != "" {
+		if err := k.ctx.Login(k.session, p11.CKU_USER, pin); err != nil {
+			return fmt.Errorf("login: %w", err)
+		}
+	}
+
+	var template []*p11.Attribute
+	if u.Object != "" {
+		template = append(template, p11.NewAttribute(p11.CKA_LABEL, u.Object))
+	}
+	if u.ID != nil {
+		template = append(template, p11.NewAttribute(p11.CKA_ID, u.ID))
+	}
+	switch u.Type {
+	case "private":
+		template = append(template, p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY))
+	case "secret-key":
+		template = append(template, p11.NewAttribute(p11.CKA_CLASS, p11.CKO_SECRET_KEY))
+	case "":
+	default:
+		return fmt.Errorf("object type %q cannot be used as key", u.Type)
+	}
+
+	if err := k.ctx.FindObjectsInit(k.session, template); err != nil {
+		return fmt.Errorf("find objects: %w", err)
+	}
+	objects, _, err := k.ctx.FindObjects(k.session, 16)
+	k.ctx.FindObjectsFinal(k.session)
+	if err != nil {
+		return fmt.Errorf("find objects: %w", err)
+	}
+
+	// the public key of a key pair has the same label and id
+	found := false
+	for _, o := range objects {
+		attrs, err := k.ctx.GetAttributeValue(k.session, o, []*p11.Attribute{
+			p11.NewAttribute(p11.CKA_CLASS, nil),
+			p11.NewAttribute(p11.CKA_KEY_TYPE, nil),
+		})
+		if err != nil {
+			continue
+		}
+		class := decodeUint(attrs[0].Value)
+		if class != p11.CKO_PRIVATE_KEY && class != p11.CKO_SECRET_KEY {
+			continue
+		}
+		if found {
+			return errors.New("the URI matches more than one key")
+		}
+		found = true
+		k.object = o
+		k.class = class
+		k.keyType = decodeUint(attrs[1].Value)
+	}
+	if !found {
+		return errors.New("key not found")
+	}
+
+	return nil
+}
+
+func findSlot(ctx *p11.Ctx, u *URI) (uint, error) {
+	slots, err := ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("get slot list: %w", err)
+	}
+
+	var found []uint
+	for _, slot := range slots {
+		if u.SlotID != "" && u.SlotID != strconv.FormatUint(uint64(slot), 10) {
+			continue
+		}
+		info, err := ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if !matches(u.Token, info.Label) || !matches(u.Manufacturer, info.ManufacturerID) ||
+			!matches(u.Serial, info.SerialNumber) || !matches(u.Model, info.Model) {
+			continue
+		}
+		found = append(found, slot)
+	}
+
+	switch len(found) {
+	case 0:
+		return 0, errors.New("token not found")
+	case 1:
+		return found[0], nil
+	default:
+		return 0, errors.New("the URI matches more than one token")
+	}
+}
+
+// matches compares a URI attribute with a blank padded token attribute.
+func matches(attr, value string) bool {
+	return attr == "" || attr == strings.TrimRight(value, " \x00")
+}
+
+// decodeUint decodes a CK_ULONG attribute, in native byte order.
+func decodeUint(b []byte) uint {
+	switch len(b) {
+	case 4:
+		return uint(binary.NativeEndian.Uint32(b))
+	case 8:
+		return uint(binary.NativeEndian.Uint64(b))
+	default:
+		return ^uint(0)
+	}
+}
+
+// Close ends the session with the token.
+func (k *Key) Close() error {
+	if k.session != 0 {
+		k.ctx.Logout(k.session)
+		k.ctx.CloseSession(k.session)
+	}
+	err := k.ctx.Finalize()
+	k.ctx.Destroy()
+	return err
+}
+
+func (k *Key) expect(class, keyType uint, alg string) error {
+	if k.class != class || k.keyType != keyType {
+		return fmt.Errorf("the key cannot be used for %s", alg)
+	}
+	return nil
+}
+
+// Size returns the size in bytes of the modulus of an RSA key.
+func (k *Key) Size() int {
+	attrs, err := k.ctx.GetAttributeValue(k.session, k.object, []*p11.Attribute{
+		p11.NewAttribute(p11.CKA_MODULUS, nil),
+	})
+	if err != nil {
+		return 0
+	}
+	return len(attrs[0].Value)
+}
+
+// CMAC returns the AES-CMAC of msg.
+func (k *Key) CMAC(msg []byte) ([]byte, error) {
+	if err := k.expect(p11.CKO_SECRET_KEY, p11.CKK_AES, "AES-CMAC"); err != nil {
+		return nil, err
+	}
+	if err := k.ctx.SignInit(k.session, []*p11.Mechanism{p11.NewMechanism(p11.CKM_AES_CMAC, nil)}, k.object); err != nil {
+		return nil, err
+	}
+	return k.ctx.Sign(k.session, msg)
+}
+
+// SignEd25519 returns the Ed25519 signature of msg.
+func (k *Key) SignEd25519(msg []byte) ([]byte, error) {
+	if err := k.expect(p11.CKO_PRIVATE_KEY, ckkECEdwards, "Ed25519"); err != nil {
+		return nil, err
+	}
+	if err := k.ctx.SignInit(k.session, []*p11.Mechanism{p11.NewMechanism(ckmEdDSA, nil)}, k.object); err != nil {
+		return nil, err
+	}
+	return k.ctx.Sign(k.session, msg)
+}
+
+// DecryptRaw returns c^d mod n for an RSA key, as Size bytes.
+func (k *Key) DecryptRaw(c []byte) ([]byte, error) {
+	if err := k.expect(p11.CKO_PRIVATE_KEY, p11.CKK_RSA, "RSA"); err != nil {
+		return nil, err
+	}
+	if err := k.ctx.DecryptInit(k.session, []*p11.Mechanism{p11.NewMechanism(p11.CKM_RSA_X_509, nil)}, k.object); err != nil {
+		return nil, err
+	}
+	return k.ctx.Decrypt(k.session, c)
+}
+
+// GCM encrypts(or decrypts if encrypt is false) data with AES-GCM,
+// the tag is 16 bytes.
+func (k *Key) GCM(iv, data, aad []byte, encrypt bool) ([]byte, error) {
+	if err := k.expect(p11.CKO_SECRET_KEY, p11.CKK_AES, "AES-GCM"); err != nil {
+		return nil, err
+	}
+	params := p11.NewGCMParams(iv, aad, 128)
+	defer params.Free()
+	mech := []*p11.Mechanism{p11.NewMechanism(p11.CKM_AES_GCM, params)}
+	if encrypt {
+		if err := k.ctx.EncryptInit(k.session, mech, k.object); err != nil {
+			return nil, err
+		}
+		return k.ctx.Encrypt(k.session, data)
+	}
+	if err := k.ctx.DecryptInit(k.session, mech, k.object); err != nil {
+		return nil, err
+	}
+	return k.ctx.Decrypt(k.session, data)
+}
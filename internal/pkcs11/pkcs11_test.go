@@ -0,0 +1,246 @@
+//go:build pkcs11 && cgo
+
+package pkcs11
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	p11 "github.com/miekg/pkcs11"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+)
+
+const testPIN = "1234"
+
+// setupSoftHSM creates a SoftHSMv2 token with the keys used by the tests,
+// the test is skipped if SoftHSMv2 is not installed.
+func setupSoftHSM(t *testing.T, aesKey []byte, rsaKey *rsa.PrivateKey, edKey ed25519.PrivateKey) {
+	module := os.Getenv(ModuleEnv)
+	if module == "" {
+		for _, v := range []string{
+			"/usr/lib/softhsm/libsofthsm2.so",
+			"/usr/lib64/softhsm/libsofthsm2.so",
+			"/usr/local/lib/softhsm/libsofthsm2.so",
+			"/usr/lib/x86_64-linux-gnu/softhsm/libsofthsm2.so",
+		} {
+			if _, err := os.Stat(v); err == nil {
+				module = v
+				break
+			}
+		}
+	}
+	if module == "" {
+		t.Skip("SoftHSMv2 not found, set " + ModuleEnv)
+	}
+	t.Setenv(ModuleEnv, module)
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "softhsm2.conf")
+	tokens := filepath.Join(dir, "tokens")
+	if err := os.Mkdir(tokens, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(conf, []byte("directories.tokendir = "+tokens+"\nobjectstore.backend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SOFTHSM2_CONF", conf)
+
+	ctx := p11.New(module)
+	if ctx == nil {
+		t.Fatal("failed to load module")
+	}
+	if err := ctx.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx.Finalize()
+		ctx.Destroy()
+	}()
+
+	slots, err := ctx.GetSlotList(false)
+	if err != nil || len(slots) == 0 {
+		t.Fatal("no slots", err)
+	}
+	if err := ctx.InitToken(slots[0], testPIN, "pocryp"); err != nil {
+		t.Fatal(err)
+	}
+	// the token is moved to a new slot after init
+	slots, err = ctx.GetSlotList(true)
+	if err != nil || len(slots) == 0 {
+		t.Fatal("no token", err)
+	}
+	session, err := ctx.OpenSession(slots[0], p11.CKF_SERIAL_SESSION|p11.CKF_RW_SESSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.CloseSession(session)
+	if err := ctx.Login(session, p11.CKU_SO, testPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.InitPIN(session, testPIN); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Logout(session); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Login(session, p11.CKU_USER, testPIN); err != nil {
+		t.Fatal(err)
+	}
+
+	objects := [][]*p11.Attribute{
+		{
+			p11.NewAttribute(p11.CKA_CLASS, p11.CKO_SECRET_KEY),
+			p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_AES),
+			p11.NewAttribute(p11.CKA_LABEL, "aes"),
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_SIGN, true),
+			p11.NewAttribute(p11.CKA_ENCRYPT, true),
+			p11.NewAttribute(p11.CKA_DECRYPT, true),
+			p11.NewAttribute(p11.CKA_VALUE, aesKey),
+		},
+		{
+			p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY),
+			p11.NewAttribute(p11.CKA_KEY_TYPE, p11.CKK_RSA),
+			p11.NewAttribute(p11.CKA_LABEL, "rsa"),
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_DECRYPT, true),
+			p11.NewAttribute(p11.CKA_MODULUS, rsaKey.N.Bytes()),
+			p11.NewAttribute(p11.CKA_PUBLIC_EXPONENT, big.NewInt(int64(rsaKey.E)).Bytes()),
+			p11.NewAttribute(p11.CKA_PRIVATE_EXPONENT, rsaKey.D.Bytes()),
+			p11.NewAttribute(p11.CKA_PRIME_1, rsaKey.Primes[0].Bytes()),
+			p11.NewAttribute(p11.CKA_PRIME_2, rsaKey.Primes[1].Bytes()),
+			p11.NewAttribute(p11.CKA_EXPONENT_1, rsaKey.Precomputed.Dp.Bytes()),
+			p11.NewAttribute(p11.CKA_EXPONENT_2, rsaKey.Precomputed.Dq.Bytes()),
+			p11.NewAttribute(p11.CKA_COEFFICIENT, rsaKey.Precomputed.Qinv.Bytes()),
+		},
+		{
+			p11.NewAttribute(p11.CKA_CLASS, p11.CKO_PRIVATE_KEY),
+			p11.NewAttribute(p11.CKA_KEY_TYPE, ckkECEdwards),
+			p11.NewAttribute(p11.CKA_LABEL, "ed25519"),
+			p11.NewAttribute(p11.CKA_TOKEN, true),
+			p11.NewAttribute(p11.CKA_SIGN, true),
+			// PrintableString "edwards25519"
+			p11.NewAttribute(p11.CKA_EC_PARAMS, append([]byte{0x13, 0x0c}, "edwards25519"...)),
+			p11.NewAttribute(p11.CKA_VALUE, edKey.Seed()),
+		},
+	}
+	for _, v := range objects {
+		if _, err := ctx.CreateObject(session, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSoftHSM(t *testing.T) {
+	aesKey := make([]byte, 16)
+	if _, err := rand.Read(aesKey); err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setupSoftHSM(t, aesKey, rsaKey, edKey)
+
+	uri := func(label string) string {
+		return "pkcs11:token=pocryp;object=" + label + "?pin-value=" + testPIN
+	}
+	msg := []byte("pocryp pkcs11 test message")
+
+	t.Run("CMAC", func(t *testing.T) {
+		have, err := CMAC(uri("aes"), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := cmac.Generate(aesKey, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("have %x, want %x", have, want)
+		}
+	})
+
+	t.Run("GCM", func(t *testing.T) {
+		iv := make([]byte, 12)
+		aad := []byte("aad")
+		c, err := GCM(uri("aes"), iv, msg, aad, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := aes.NewCipher(aesKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := aead.Seal(nil, iv, msg, aad); !bytes.Equal(c, want) {
+			t.Fatalf("have %x, want %x", c, want)
+		}
+		p, err := GCM(uri("aes"), iv, c, aad, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(p, msg) {
+			t.Fatalf("have %x, want %x", p, msg)
+		}
+	})
+
+	t.Run("DecryptRaw", func(t *testing.T) {
+		k, err := OpenKey(uri("rsa") + "&x-unused=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer k.Close()
+		if k.Size() != rsaKey.Size() {
+			t.Fatalf("have size %d, want %d", k.Size(), rsaKey.Size())
+		}
+		z := big.NewInt(0x1234567890)
+		c := new(big.Int).Exp(z, big.NewInt(int64(rsaKey.E)), rsaKey.N)
+		have, err := k.DecryptRaw(c.FillBytes(make([]byte, rsaKey.Size())))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if new(big.Int).SetBytes(have).Cmp(z) != 0 {
+			t.Fatalf("have %x, want %x", have, z)
+		}
+	})
+
+	t.Run("SignEd25519", func(t *testing.T) {
+		sig, err := SignEd25519(uri("ed25519"), msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ed25519.Verify(edKey.Public().(ed25519.PublicKey), msg, sig) {
+			t.Fatal("not valid")
+		}
+	})
+
+	t.Run("WrongKeyType", func(t *testing.T) {
+		if _, err := CMAC(uri("rsa"), msg); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		if _, err := CMAC(uri("missing"), msg); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -0,0 +1,35 @@
+//go:build !pkcs11 || !cgo
+
+package pkcs11
+
+// Key is a key stored in a PKCS#11 token.
+type Key struct{}
+
+// OpenKey returns the key at uri, from a new session with the token.
+func OpenKey(uri string) (*Key, error) {
+	if _, err := ParseURI(uri); err != nil {
+		return nil, err
+	}
+	return nil, ErrNotSupported
+}
+
+// Close ends the session with the token.
+func (k *Key) Close() error { return ErrNotSupported }
+
+// Size returns the size in bytes of the modulus of an RSA key.
+func (k *Key) Size() int { return 0 }
+
+// CMAC returns the AES-CMAC of msg.
+func (k *Key) CMAC(msg []byte) ([]byte, error) { return nil, ErrNotSupported }
+
+// SignEd25519 returns the Ed25519 signature of msg.
+func (k *Key) SignEd25519(msg []byte) ([]byte, error) { return nil, ErrNotSupported }
+
+// DecryptRaw returns c^d mod n for an RSA key, as Size bytes.
+func (k *Key) DecryptRaw(c []byte) ([]byte, error) { return nil, ErrNotSupported }
+
+// GCM encrypts(or decrypts if encrypt is false) data with AES-GCM,
+// the tag is 16 bytes.
+func (k *Key) GCM(iv, data, aad []byte, encrypt bool) ([]byte, error) {
+	return nil, ErrNotSupported
+}
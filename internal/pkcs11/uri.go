@@ -0,0 +1,177 @@
+// Package pkcs11 runs cryptographic operations with keys stored in PKCS#11
+// tokens(e.g. HSMs), the keys are referenced by PKCS#11 URIs(RFC 7512).
+//
+// The token support needs cgo and the pkcs11 build tag, without it the
+// operations return ErrNotSupported.
+package pkcs11
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/util"
+)
+
+// ModuleEnv is the environment variable with the path of the PKCS#11 module,
+// used if the URI doesn't contain module-path.
+const ModuleEnv = "POCRYP_PKCS11_MODULE"
+
+// URIHelp describes the PKCS#11 URIs, for command usages.
+const URIHelp = `The key can be a PKCS#11 URI(RFC 7512), the operation runs in the token:
+  pkcs11:token=TOKEN;object=LABEL?module-path=MODULE&pin-source=SOURCE
+the PIN is read from pin-value or pin-source(a file or a source like env:PIN),
+if module-path is not given, the module is read from $` + ModuleEnv + `.
+`
+
+// URI is a parsed PKCS#11 URI.
+type URI struct {
+	// token attributes
+	Token        string
+	Manufacturer string
+	Serial       string
+	Model        string
+	SlotID       string
+
+	// object attributes
+	Object string
+	ID     []byte
+	Type   string
+
+	// query attributes
+	PINValue   string
+	PINSource  string
+	ModulePath string
+}
+
+// IsURI returns true if s is a PKCS#11 URI.
+func IsURI(s string) bool {
+	return strings.HasPrefix(s, "pkcs11:")
+}
+
+// ParseURI parses a PKCS#11 URI.
+func ParseURI(s string) (*URI, error) {
+	if !IsURI(s) {
+		return nil, fmt.Errorf("not a PKCS#11 URI: %q", s)
+	}
+	s = strings.TrimPrefix(s, "pkcs11:")
+
+	path, query, _ := strings.Cut(s, "?")
+
+	var u URI
+	seen := make(map[string]bool)
+
+	attribute := func(attr, sep string) (string, string, error) {
+		name, value, ok := strings.Cut(attr, "=")
+		if !ok {
+			return "", "", fmt.Errorf("invalid attribute %q", attr)
+		}
+		if seen[sep+name] {
+			return "", "", fmt.Errorf("duplicate attribute %q", name)
+		}
+		seen[sep+name] = true
+		v, err := url.PathUnescape(value)
+		if err != nil {
+			return "", "", fmt.Errorf("attribute %q: %w", name, err)
+		}
+		return name, v, nil
+	}
+
+	for _, attr := range strings.Split(path, ";") {
+		if attr == "" {
+			continue
+		}
+		name, v, err := attribute(attr, ";")
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "token":
+			u.Token = v
+		case "manufacturer":
+			u.Manufacturer = v
+		case "serial":
+			u.Serial = v
+		case "model":
+			u.Model = v
+		case "slot-id":
+			u.SlotID = v
+		case "object":
+			u.Object = v
+		case "id":
+			u.ID = []byte(v)
+		case "type":
+			switch v {
+			case "private", "public", "secret-key", "cert", "data":
+			default:
+				return nil, fmt.Errorf("invalid object type %q", v)
+			}
+			u.Type = v
+		case "library-manufacturer", "library-description", "library-version", "slot-manufacturer", "slot-description":
+			// not needed to find the key
+		default:
+			if !strings.HasPrefix(name, "x-") {
+				return nil, fmt.Errorf("unknown attribute %q", name)
+			}
+		}
+	}
+
+	for _, attr := range strings.Split(query, "&") {
+		if attr == "" {
+			continue
+		}
+		name, v, err := attribute(attr, "&")
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "pin-value":
+			u.PINValue = v
+		case "pin-source":
+			u.PINSource = v
+		case "module-path":
+			u.ModulePath = v
+		case "module-name":
+			return nil, errors.New("module-name is not supported, use module-path")
+		default:
+			if !strings.HasPrefix(name, "x-") {
+				return nil, fmt.Errorf("unknown attribute %q", name)
+			}
+		}
+	}
+
+	if u.Object == "" && u.ID == nil {
+		return nil, errors.New("the URI must contain object or id")
+	}
+	if u.PINValue != "" && u.PINSource != "" {
+		return nil, errors.New("cannot specify pin-value and pin-source at the same time")
+	}
+
+	return &u, nil
+}
+
+// Module returns the path of the PKCS#11 module.
+func (u *URI) Module() (string, error) {
+	if u.ModulePath != "" {
+		return u.ModulePath, nil
+	}
+	if v := os.Getenv(ModuleEnv); v != "" {
+		return v, nil
+	}
+	return "", fmt.Errorf("PKCS#11 module not specified, use module-path or $%s", ModuleEnv)
+}
+
+// PIN returns the user PIN, empty if the URI doesn't specify it.
+func (u *URI) PIN() (string, error) {
+	if u.PINSource == "" {
+		return u.PINValue, nil
+	}
+	source := strings.TrimPrefix(u.PINSource, "file:")
+	pin, err := util.ReadSource(source)
+	if err != nil {
+		return "", fmt.Errorf("pin-source: %w", err)
+	}
+	return strings.TrimRight(string(pin), "\r\n"), nil
+}
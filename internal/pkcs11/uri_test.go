@@ -0,0 +1,67 @@
+package pkcs11
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseURI(t *testing.T) {
+	t.Setenv("POCRYP_TEST_PIN", "1234\n")
+
+	u, err := ParseURI("pkcs11:token=My%20Token;manufacturer=SoftHSM;object=key;id=%01%02;type=secret-key" +
+		"?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=env:POCRYP_TEST_PIN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Token != "My Token" || u.Manufacturer != "SoftHSM" || u.Object != "key" ||
+		!bytes.Equal(u.ID, []byte{1, 2}) || u.Type != "secret-key" {
+		t.Fatalf("unexpected URI %+v", u)
+	}
+	if module, err := u.Module(); err != nil || module != "/usr/lib/softhsm/libsofthsm2.so" {
+		t.Fatal("unexpected module", module, err)
+	}
+	if pin, err := u.PIN(); err != nil || pin != "1234" {
+		t.Fatal("unexpected PIN", pin, err)
+	}
+
+	t.Run("ModuleEnv", func(t *testing.T) {
+		u, err := ParseURI("pkcs11:object=key?pin-value=1234")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(ModuleEnv, "")
+		if _, err := u.Module(); err == nil {
+			t.Fatal("expected error")
+		}
+		t.Setenv(ModuleEnv, "module.so")
+		if module, err := u.Module(); err != nil || module != "module.so" {
+			t.Fatal("unexpected module", module, err)
+		}
+		if pin, err := u.PIN(); err != nil || pin != "1234" {
+			t.Fatal("unexpected PIN", pin, err)
+		}
+	})
+
+	for _, s := range []string{
+		"token=foo;object=key",
+		"pkcs11:token=foo",
+		"pkcs11:object=key;object=key2",
+		"pkcs11:object=key;foo=bar",
+		"pkcs11:object=key;type=foo",
+		"pkcs11:object=%zz",
+		"pkcs11:object",
+		"pkcs11:object=key?foo=bar",
+		"pkcs11:object=key?module-name=softhsm2",
+		"pkcs11:object=key?pin-value=1&pin-source=pin.txt",
+	} {
+		t.Run(s, func(t *testing.T) {
+			if _, err := ParseURI(s); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	if _, err := ParseURI("pkcs11:object=key;x-foo=bar?x-baz=1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package secret
+
+import "errors"
+
+func lockedAlloc(n int) ([]byte, error) {
+	return nil, errors.New("not supported on this platform")
+}
+
+func lockedFree(b []byte) error {
+	return nil
+}
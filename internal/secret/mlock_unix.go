@@ -0,0 +1,26 @@
+//go:build unix
+
+package secret
+
+import "golang.org/x/sys/unix"
+
+// lockedAlloc returns n bytes on their own pages, locked in memory.
+func lockedAlloc(n int) ([]byte, error) {
+	b, err := unix.Mmap(-1, 0, n, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Mlock(b); err != nil {
+		unix.Munmap(b)
+		return nil, err
+	}
+	return b, nil
+}
+
+func lockedFree(b []byte) error {
+	if err := unix.Munlock(b); err != nil {
+		unix.Munmap(b)
+		return err
+	}
+	return unix.Munmap(b)
+}
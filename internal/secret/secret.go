@@ -0,0 +1,91 @@
+// Package secret provides buffers for key material, which are zeroized when
+// no longer needed and can be locked in memory, so they are not swapped.
+//
+// Go may copy a value before it is placed in a buffer(e.g. while decoding
+// it), the copies made by this module are wiped with Wipe, others are left
+// for the garbage collector.
+package secret
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Mlock enables locking the buffers returned by New and Protect in memory.
+var Mlock bool
+
+// Buffer contains a secret, use Destroy when it is no longer needed.
+type Buffer struct {
+	b      []byte
+	locked bool
+}
+
+// New returns a buffer of n zero bytes, locked in memory if Mlock is set.
+func New(n int) (*Buffer, error) {
+	if !Mlock || n == 0 {
+		return &Buffer{b: make([]byte, n)}, nil
+	}
+	b, err := lockedAlloc(n)
+	if err != nil {
+		return nil, fmt.Errorf("mlock: %w", err)
+	}
+	return &Buffer{b: b, locked: true}, nil
+}
+
+// From returns a buffer which owns b, b is zeroized by Destroy.
+func From(b []byte) *Buffer {
+	return &Buffer{b: b}
+}
+
+// Protect is like From, if Mlock is set b is copied to a locked buffer
+// and wiped.
+func Protect(b []byte) (*Buffer, error) {
+	if !Mlock {
+		return From(b), nil
+	}
+	s, err := New(len(b))
+	if err != nil {
+		Wipe(b)
+		return nil, err
+	}
+	copy(s.b, b)
+	Wipe(b)
+	return s, nil
+}
+
+// Bytes returns the secret, it must not be used after Destroy.
+func (s *Buffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.b
+}
+
+// Len returns the length of the secret.
+func (s *Buffer) Len() int {
+	return len(s.Bytes())
+}
+
+// Destroy zeroizes the secret and unlocks its memory,
+// it can be called multiple times and on a nil buffer.
+func (s *Buffer) Destroy() {
+	if s == nil || s.b == nil {
+		return
+	}
+	Wipe(s.b)
+	if s.locked {
+		// the memory is wiped, nothing can be done about an error
+		_ = lockedFree(s.b)
+	}
+	s.b = nil
+	s.locked = false
+}
+
+// Wipe zeroizes all the given slices.
+func Wipe(bs ...[]byte) {
+	for _, b := range bs {
+		clear(b)
+		// the stores must not be removed even if b is not used after
+		runtime.KeepAlive(b)
+	}
+}
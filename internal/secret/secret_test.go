@@ -0,0 +1,73 @@
+package secret
+
+import (
+	"bytes"
+	"testing"
+)
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWipe(t *testing.T) {
+	a := []byte{1, 2, 3}
+	b := []byte{4, 5}
+	Wipe(a, b, nil)
+	if !isZero(a) || !isZero(b) {
+		t.Fatalf("not wiped: %x %x", a, b)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	b := []byte{1, 2, 3, 4}
+	s := From(b)
+	if !bytes.Equal(s.Bytes(), []byte{1, 2, 3, 4}) {
+		t.Fatalf("expected %x, have %x", b, s.Bytes())
+	}
+	s.Destroy()
+	if !isZero(b) {
+		t.Fatalf("not wiped: %x", b)
+	}
+	if s.Bytes() != nil || s.Len() != 0 {
+		t.Fatal("expected empty buffer after Destroy")
+	}
+	s.Destroy()
+
+	var n *Buffer
+	n.Destroy()
+	if n.Len() != 0 {
+		t.Fatal("expected empty nil buffer")
+	}
+}
+
+func TestMlock(t *testing.T) {
+	Mlock = true
+	defer func() { Mlock = false }()
+
+	s, err := New(32)
+	if err != nil {
+		t.Skip(err)
+	}
+	if !s.locked || s.Len() != 32 || !isZero(s.Bytes()) {
+		t.Fatal("expected 32 locked zero bytes")
+	}
+	s.Destroy()
+
+	b := []byte{1, 2, 3, 4}
+	s, err = Protect(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+	if !isZero(b) {
+		t.Fatalf("source not wiped: %x", b)
+	}
+	if !bytes.Equal(s.Bytes(), []byte{1, 2, 3, 4}) {
+		t.Fatalf("expected 01020304, have %x", s.Bytes())
+	}
+}
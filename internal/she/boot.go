@@ -0,0 +1,22 @@
+package she
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+)
+
+// BootMAC computes the MAC used by the secure boot:
+// CMAC(key, 0...0(96 bits) || SIZE(32 bits) || image),
+// where SIZE is the size of the image in bits.
+func BootMAC(key, image []byte) ([]byte, error) {
+	size := uint64(len(image)) * 8
+	if size > 0xffffffff {
+		return nil, fmt.Errorf("image is too big: %d bytes", len(image))
+	}
+	msg := make([]byte, 16, 16+len(image))
+	binary.BigEndian.PutUint32(msg[12:], uint32(size))
+	msg = append(msg, image...)
+	return cmac.Generate(key, msg)
+}
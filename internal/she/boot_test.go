@@ -0,0 +1,27 @@
+package she
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestBootMAC(t *testing.T) {
+	key := testutil.BytesFromHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	image := testutil.BytesFromHex(t, "6bc1bee22e409f96e93d7e117393172a")
+	msg := testutil.BytesFromHex(t, "00000000000000000000000000000080"+"6bc1bee22e409f96e93d7e117393172a")
+	expected, err := cmac.Generate(key, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, err := BootMAC(key, image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mac, expected) {
+		t.Fatal("have", hex.EncodeToString(mac))
+	}
+}
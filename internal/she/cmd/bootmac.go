@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/encoding/hexfile"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var BootMACCmd = &cmd.Command{
+	Name:  "she-boot-mac",
+	Run:   runBootMAC,
+	Brief: "Compute the BOOT_MAC of a bootloader image",
+
+	Usage: `Usage: pocryp she-boot-mac [-bin] [-in-format FORMAT] [-fill BYTE] -key/-key-file [-in INPUT] [-out OUTPUT]
+       pocryp she-boot-mac -mup -uid UID [-auth-id ID] -auth-key KEY -counter N [flags] -key/-key-file [-in INPUT] [-out OUTPUT]
+
+Compute the BOOT_MAC used by the SHE secure boot, with BOOT_MAC_KEY as key:
+  CMAC(BOOT_MAC_KEY, 0...0(96 bits) || SIZE(32 bits) || BOOTLOADER)
+where SIZE is the size of the bootloader in bits.
+
+The bootloader is read from INPUT as binary, hex, base64, Intel HEX(ihex) or
+S-record(srec), by default binary, Intel HEX and S-record are detected from
+the content.
+For Intel HEX and S-record, the image starts at the lowest address and the gaps
+are filled with BYTE.
+
+If -mup is specified, a JSON input for she-encode is written instead, which
+loads the computed BOOT_MAC in the BOOT_MAC slot.
+
+If -in is not specified, stdin will be read.
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func runBootMAC(cmd *cmd.Command) error {
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fInput := cmd.Flags.String("in", "", "Read the bootloader from the file at path INPUT.")
+	fInFormat := cmd.Flags.String("in-format", "auto", "Format of the input: bin, hex, base64, ihex, srec or auto.")
+	fFill := cmd.Flags.String("fill", "ff", "Byte(hex) used to fill the gaps of Intel HEX and S-record images.")
+	fKey := cmd.Flags.String("key", "", "BOOT_MAC_KEY as hex.")
+	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the BOOT_MAC_KEY as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fOut := stdfile.OutputFlags(cmd.Flags)
+	fMup := cmd.Flags.Bool("mup", false, "Write a JSON input for she-encode.")
+	fUID := cmd.Flags.String("uid", "", "UID as hex, for -mup.")
+	fAuthID := cmd.Flags.String("auth-id", she.BOOT_MAC.String(), "ID of the key used to authorize the update, for -mup.")
+	fAuthKey := cmd.Flags.String("auth-key", "", "Key used to authorize the update as hex, for -mup.")
+	fCounter := cmd.Flags.String("counter", "", "Counter, for -mup.")
+	var flags mup.ProtectionFlags
+	cmd.Flags.BoolVar(&flags.Write, "write-protection", false, "Set the write protection flag, for -mup.")
+	cmd.Flags.BoolVar(&flags.Boot, "boot-protection", false, "Set the boot protection flag, for -mup.")
+	cmd.Flags.BoolVar(&flags.Debugger, "debugger-protection", false, "Set the debugger protection flag, for -mup.")
+	cmd.Flags.BoolVar(&flags.Wildcard, "wildcard-protection", false, "Set the wildcard protection flag, for -mup.")
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	defer key.Destroy()
+
+	fill, err := strconv.ParseUint(*fFill, 16, 8)
+	if err != nil {
+		return fmt.Errorf("fill: %w", err)
+	}
+
+	var input mup.Input
+	if *fMup {
+		if *fUID == "" {
+			cmd.Flags.Usage()
+			return errors.New("UID(-uid) not specified")
+		}
+		if *fAuthKey == "" {
+			cmd.Flags.Usage()
+			return errors.New("auth key(-auth-key) not specified")
+		}
+		authKey, err := util.HexOrSource(*fAuthKey)
+		if err != nil {
+			return fmt.Errorf("auth key: %w", err)
+		}
+		defer secret.Wipe(authKey)
+		if *fCounter == "" {
+			cmd.Flags.Usage()
+			return errors.New("counter(-counter) not specified")
+		}
+		authID, err := she.ParseKeyID(*fAuthID)
+		if err != nil {
+			return err
+		}
+		if err := she.BOOT_MAC.IsCompatible(authID); err != nil {
+			return err
+		}
+		counter, err := strconv.ParseUint(*fCounter, 0, 32)
+		if err != nil {
+			return fmt.Errorf("counter: %w", err)
+		}
+		input = mup.Input{
+			UID:     *fUID,
+			AuthID:  authID,
+			AuthKey: hex.EncodeToString(authKey),
+			ID:      she.BOOT_MAC,
+			Counter: uint32(counter),
+			Flags:   flags,
+		}
+	}
+
+	// the mup input contains the authorization key
+	fOut.Secret = *fMup
+	sf, err := stdfile.New(*fInput, *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	data, err := sf.Read()
+	if err != nil {
+		return err
+	}
+
+	format := *fInFormat
+	if format == "hex" || format == "base64" {
+		if data, err = stdfile.Decode(data, format); err != nil {
+			return err
+		}
+		format = "bin"
+	}
+
+	_, image, err := hexfile.Decode(data, format, byte(fill))
+	if err != nil {
+		return err
+	}
+
+	mac, err := she.BootMAC(key.Bytes(), image)
+	if err != nil {
+		return err
+	}
+
+	if !*fMup {
+		if cmd.JSON {
+			return sf.WriteJSON(stdfile.Result{"mac": stdfile.Hex(mac)})
+		}
+		return sf.Write(mac, fOut)
+	}
+
+	input.NewKey = hex.EncodeToString(mac)
+
+	// check that the input can be encoded
+	if _, err := input.Encode(); err != nil {
+		return err
+	}
+
+	return sf.WriteJSON(input)
+}
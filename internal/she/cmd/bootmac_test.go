@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestBootMAC(t *testing.T) {
+	const (
+		key = "2b7e151628aed2a6abf7158809cf4f3c"
+		mac = "c667a9eb2e794c7c8010466227873c1b"
+	)
+
+	tmp := t.TempDir()
+	in := filepath.Join(tmp, "in")
+	out := filepath.Join(tmp, "out")
+
+	inputs := []struct {
+		name string
+		data []byte
+	}{
+		{"Bin", testutil.BytesFromHex(t, "214601360121470136007efe09d21901")},
+		{"IntelHex", []byte(":10010000214601360121470136007EFE09D2190140\n:00000001FF\n")},
+		{"SRecord", []byte("S00600004844521B\nS1130100214601360121470136007EFE09D219013C\nS9030000FC\n")},
+	}
+	for _, tt := range inputs {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupIn(t, in, tt.data)
+			if err := testutil.RunCmd(BootMACCmd, "-key", key, "-in", in, "-out", out, "-force", "-bin"); err != nil {
+				t.Fatal(err)
+			}
+			testutil.ExpectFileContentHex(t, out, mac)
+		})
+	}
+
+	t.Run("Mup", func(t *testing.T) {
+		testutil.SetupIn(t, in, inputs[1].data)
+		if err := testutil.RunCmd(
+			BootMACCmd,
+			"-key", key, "-in", in, "-out", out, "-force",
+			"-mup",
+			"-uid", "000000000000000000000000000001",
+			"-auth-key", "000102030405060708090a0b0c0d0e0f",
+			"-counter", "1",
+			"-write-protection",
+		); err != nil {
+			t.Fatal(err)
+		}
+		var input mup.Input
+		if err := json.Unmarshal(testutil.ReadFile(t, out), &input); err != nil {
+			t.Fatal(err)
+		}
+		if input.ID != she.BOOT_MAC || input.AuthID != she.BOOT_MAC || input.NewKey != mac || !input.Flags.Write {
+			t.Fatal("unexpected input", input)
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		testutil.SetupIn(t, in, inputs[1].data)
+		tests := [][]string{
+			{"-in", in},
+			{"-key", key, "-in", in, "-in-format", "elf"},
+			{"-key", key, "-in", in, "-in-format", "srec"},
+			{"-key", key, "-in", in, "-fill", "100"},
+			{"-key", key, "-in", in, "-mup"},
+			{"-key", key, "-in", in, "-mup", "-uid", "000000000000000000000000000001", "-counter", "1"},
+			{"-key", key, "-in", in, "-mup", "-uid", "000000000000000000000000000001", "-auth-key", "000102030405060708090a0b0c0d0e0f"},
+			{"-key", key, "-in", in, "-mup", "-uid", "000000000000000000000000000001", "-auth-key", "000102030405060708090a0b0c0d0e0f", "-counter", "1", "-auth-id", "KEY_1"},
+			{"-key", key, "-in", in, "-mup", "-uid", "00", "-auth-key", "000102030405060708090a0b0c0d0e0f", "-counter", "1"},
+			{"-key", key, "-in", filepath.Join(tmp, "missing")},
+		}
+		for _, args := range tests {
+			if err := testutil.RunCmd(BootMACCmd, args...); err == nil {
+				t.Fatal(args, "expected error")
+			}
+		}
+	})
+}
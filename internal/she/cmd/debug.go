@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var DebugAuthCmd = &cmd.Command{
+	Name:  "she-debug-auth",
+	Run:   runDebugAuth,
+	Brief: "Compute the CMD_DEBUG authorization",
+
+	Usage: `Usage: pocryp she-debug-auth [-bin] -key/-key-file -uid UID [-out OUTPUT] CHALLENGE
+
+Compute the authorization for the challenge returned by CMD_DEBUG:
+  CMAC(KDF(MASTER_ECU_KEY, DEBUG_KEY_C), CHALLENGE || UID)
+
+-key is the MASTER_ECU_KEY(16 bytes), CHALLENGE and UID are given as hex.
+On success, the SHE module erases all the keys, except SECRET_KEY.
+
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func runDebugAuth(cmd *cmd.Command) error {
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fKey := cmd.Flags.String("key", "", "MASTER_ECU_KEY as hex.")
+	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the MASTER_ECU_KEY as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fUID := cmd.Flags.String("uid", "", "UID as hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	defer key.Destroy()
+	if key.Len() != 16 {
+		return util.InvalidInput(fmt.Errorf("key: MASTER_ECU_KEY expected length is 16 bytes, have %d bytes", key.Len()))
+	}
+
+	if *fUID == "" {
+		cmd.Flags.Usage()
+		return errors.New("UID(-uid) not specified")
+	}
+	uid, err := hex.DecodeString(*fUID)
+	if err != nil {
+		return fmt.Errorf("failed to decode UID: %w", err)
+	}
+
+	if cmd.Flags.NArg() == 0 {
+		cmd.Flags.Usage()
+		return errors.New("challenge not specified")
+	}
+	challenge, err := hex.DecodeString(cmd.Flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to decode challenge: %w", err)
+	}
+
+	result, err := she.DebugAuthorization(key.Bytes(), challenge, uid)
+	if err != nil {
+		return util.InvalidInput(err)
+	}
+
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"authorization": stdfile.Hex(result)})
+	}
+
+	return sf.Write(result, fOut)
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestDebugAuth(t *testing.T) {
+	const (
+		uid       = "000000000000000000000000000001"
+		masterKey = "000102030405060708090a0b0c0d0e0f"
+	)
+
+	tmp := t.TempDir()
+	state := filepath.Join(tmp, "state.json")
+	out := filepath.Join(tmp, "out")
+
+	emu := func(args ...string) error {
+		return testutil.RunCmd(EmuCmd, append([]string{"-state", state, "-force"}, args...)...)
+	}
+
+	if err := emu("-uid", uid, "-master-key", masterKey, "init"); err != nil {
+		t.Fatal(err)
+	}
+	if err := emu("init-rng"); err != nil {
+		t.Fatal(err)
+	}
+	if err := emu("-out", out, "debug"); err != nil {
+		t.Fatal(err)
+	}
+	challenge := strings.TrimSpace(string(testutil.ReadFile(t, out)))
+
+	if err := testutil.RunCmd(DebugAuthCmd, "-key", masterKey, "-uid", uid, "-out", out, "-force", challenge); err != nil {
+		t.Fatal(err)
+	}
+	auth := strings.TrimSpace(string(testutil.ReadFile(t, out)))
+
+	if err := emu("debug-auth", auth); err != nil {
+		t.Fatal(err)
+	}
+	// the challenge was consumed
+	if err := emu("debug-auth", auth); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, args := range [][]string{
+		{"-uid", uid, challenge},
+		{"-key", masterKey, challenge},
+		{"-key", masterKey, "-uid", uid},
+		{"-key", masterKey, "-uid", "zz", challenge},
+		{"-key", masterKey, "-uid", uid, "zz"},
+		{"-key", masterKey, "-uid", uid, "0011"},
+	} {
+		if err := testutil.RunCmd(DebugAuthCmd, args...); err == nil {
+			t.Fatal(args, "expected error")
+		}
+	}
+
+	for _, key := range []string{masterKey + masterKey, masterKey + masterKey + masterKey} {
+		err := testutil.RunCmd(DebugAuthCmd, "-key", key, "-uid", uid, challenge)
+		if c := cmd.CategoryOf(err); c != cmd.CategoryInvalidInput {
+			t.Fatal(len(key)/2, "bytes: expected invalid-input error, have", c, err)
+		}
+	}
+}
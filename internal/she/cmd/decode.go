@@ -1,15 +1,14 @@
 package cmd
 
 import (
-	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"strings"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/she"
 	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
 var DecodeCmd = &cmd.Command{
@@ -17,15 +16,20 @@ var DecodeCmd = &cmd.Command{
 	Run:   runDecode,
 	Brief: "Decode M1,M2,M3,M4,M5 to JSON input",
 
-	Usage: `Usage: pocryp she-decode [hex_string]
+	Usage: `Usage: pocryp she-decode -key KEY [-profile she|csec|she+ [-bank1]] [hex_string]
 
 Decode the M1,M2,M3,M4,M5 given as a hex string to its JSON form.
 If no argument given, stdin will be read.
+
+M1 contains only the lower 4 bits of the IDs, for the extended keys of a
+device profile(see she-encode) the key bank must be given with -bank1.
 `,
 }
 
 func runDecode(cmd *cmd.Command) error {
 	keyHex := cmd.Flags.String("key", "", "Secret key as hex")
+	profileName := cmd.Flags.String("profile", "", "Device profile: she, csec or she+.")
+	bank1 := cmd.Flags.Bool("bank1", false, "The update is for the key bank 1(extended keys).")
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -38,36 +42,38 @@ func runDecode(cmd *cmd.Command) error {
 		return fmt.Errorf("secret key(-key) not specified")
 	}
 
+	profile, err := she.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+
 	input := cmd.Flags.Arg(0)
 	if cmd.Flags.NArg() == 0 {
-		data, err := io.ReadAll(os.Stdin)
+		data, err := stdfile.ReadStdin("the input")
 		if err != nil {
 			return fmt.Errorf("failed to read stdin: %w", err)
 		}
 		input = string(data)
 	}
-	input = strings.NewReplacer(" ", "", "\t", "", "\r", "", "\n", "").Replace(input)
 
-	key, err := hex.DecodeString(*keyHex)
+	key, err := util.ReadSecret(*keyHex)
 	if err != nil {
 		return fmt.Errorf("failed to decode key: %w", err)
 	}
-	if len(key) != 16 {
-		return fmt.Errorf("invalid key size: %d", len(key))
+	defer key.Destroy()
+	if key.Len() != 16 {
+		return fmt.Errorf("invalid key size: %d", key.Len())
 	}
 
-	m1m2m3, err := hex.DecodeString(input)
+	m1m2m3, err := stdfile.Decode([]byte(input), "hex")
 	if err != nil {
 		return fmt.Errorf("failed to decode input: %w", err)
 	}
 
-	result, err := mup.Decode(m1m2m3, key)
+	result, err := mup.DecodeProfile(m1m2m3, key.Bytes(), profile, *bank1)
 	if err != nil {
 		return err
 	}
 
-	enc := json.NewEncoder(os.Stdout)
-	enc.SetIndent("", "  ")
-
-	return enc.Encode(result)
+	return stdfile.WriteJSON(os.Stdout, result)
 }
@@ -0,0 +1,483 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/emu"
+	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var EmuCmd = &cmd.Command{
+	Name:  "she-emu",
+	Run:   runEmu,
+	Brief: "Emulate a SHE module",
+
+	Usage: `Usage: pocryp she-emu -state STATE [options] COMMAND [hex_string]
+
+Emulate a SHE module, the state of the module(UID, key slots, counters, flags,
+secure boot status and PRNG) is kept as JSON in the file at path STATE.
+The options must be given before COMMAND.
+
+Commands:
+  init                    Create a new module, needs -uid, the SECRET_KEY is
+                          random if -secret-key is not specified, the
+                          MASTER_ECU_KEY and BOOT_MAC_KEY are set to
+                          -master-key and -boot-mac-key if specified, the
+                          device profile(see she-encode) is set by -profile,
+                          an existing STATE is replaced only with -force
+  status                  Print the status register and the key slots as JSON
+  reset                   Power cycle: clear RAM_KEY, secure boot and PRNG state
+  debugger attach|detach  Attach or detach the external debugger
+  load-key [M1M2M3]       CMD_LOAD_KEY, print M4,M5, -bank1 selects the
+                          key bank 1(the extended keys of the profile)
+  load-plain-key          CMD_LOAD_PLAIN_KEY, load -key as RAM_KEY
+  enc-ecb, dec-ecb        CMD_ENC_ECB, CMD_DEC_ECB with -key-id
+  enc-cbc, dec-cbc        CMD_ENC_CBC, CMD_DEC_CBC with -key-id and -iv
+  generate-mac            CMD_GENERATE_MAC with -key-id
+  verify-mac              CMD_VERIFY_MAC with -key-id and -mac
+  init-rng                CMD_INIT_RNG
+  rnd                     CMD_RND
+  secure-boot             Perform the secure boot with the bootloader from INPUT
+  debug                   CMD_DEBUG, print the challenge
+  debug-auth AUTH         CMD_DEBUG, send the authorization(see she-debug-auth),
+                          all keys except SECRET_KEY are erased on success
+
+The protection flags of the keys and the key update rules are enforced as the
+SHE specification defines them, a failed command returns its SHE error code.
+
+For load-key, if no argument given, stdin will be read.
+For the other commands, if -in is not specified, stdin will be read.
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func runEmu(cmd *cmd.Command) error {
+	fState := cmd.Flags.String("state", "", "Path of the STATE file.")
+	fUID := cmd.Flags.String("uid", "", "UID as hex, for init.")
+	fSecretKey := cmd.Flags.String("secret-key", "", "SECRET_KEY as hex, for init.")
+	fMasterKey := cmd.Flags.String("master-key", "", "MASTER_ECU_KEY as hex, for init.")
+	fBootMACKey := cmd.Flags.String("boot-mac-key", "", "BOOT_MAC_KEY as hex, for init.")
+	fProfile := cmd.Flags.String("profile", "", "Device profile: she, csec or she+, for init.")
+	fBank1 := cmd.Flags.Bool("bank1", false, "Select the key bank 1(extended keys), for load-key.")
+	fKey := cmd.Flags.String("key", "", "Key as hex, for load-plain-key.")
+	fKeyID := cmd.Flags.String("key-id", "", "Key ID as name(e.g. KEY_1) or number.")
+	fIV := cmd.Flags.String("iv", "", "IV as hex.")
+	fMAC := cmd.Flags.String("mac", "", "MAC as hex, for verify-mac.")
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fInput := cmd.Flags.String("in", "", "Read data from the file at path INPUT.")
+	fInFormat := stdfile.InputFlags(cmd.Flags, "bin")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	if *fState == "" {
+		cmd.Flags.Usage()
+		return errors.New("state file(-state) not specified")
+	}
+
+	if cmd.Flags.NArg() == 0 {
+		cmd.Flags.Usage()
+		return errors.New("no command specified")
+	}
+
+	command := cmd.Flags.Arg(0)
+
+	if command == "init" {
+		err := emuInit(*fState, *fUID, *fSecretKey, *fMasterKey, *fBootMACKey, *fProfile, fOut.Force)
+		if err != nil || !cmd.JSON {
+			return err
+		}
+		s, err := loadEmuState(*fState)
+		if err != nil {
+			return err
+		}
+		return printEmuStatus(s)
+	}
+
+	s, err := loadEmuState(*fState)
+	if err != nil {
+		return err
+	}
+
+	keyID := func() (she.KeyID, error) {
+		if *fKeyID == "" {
+			return 0, errors.New("key ID(-key-id) not specified")
+		}
+		return she.ParseKeyID(*fKeyID)
+	}
+
+	readInput := func() ([]byte, error) {
+		sf, err := stdfile.New(*fInput, "", stdfile.Options{})
+		if err != nil {
+			return nil, err
+		}
+		defer sf.Close()
+		return sf.ReadAs(fInFormat)
+	}
+
+	var result []byte
+	valid := true
+	switch command {
+	case "status":
+		return printEmuStatus(s)
+
+	case "reset":
+		s.Reset()
+
+	case "debugger":
+		switch cmd.Flags.Arg(1) {
+		case "attach":
+			s.SetDebugger(true)
+		case "detach":
+			s.SetDebugger(false)
+		default:
+			return fmt.Errorf("expected attach or detach, have %q", cmd.Flags.Arg(1))
+		}
+
+	case "load-key":
+		input := cmd.Flags.Arg(1)
+		if cmd.Flags.NArg() < 2 {
+			data, err := stdfile.ReadStdin("the input")
+			if err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
+			input = string(data)
+		}
+		m1m2m3, err := stdfile.Decode([]byte(input), "hex")
+		if err != nil {
+			return fmt.Errorf("failed to decode input: %w", err)
+		}
+		if len(m1m2m3) != 64 {
+			return fmt.Errorf("invalid input length: %d, expected M1,M2,M3", len(m1m2m3))
+		}
+		m4, m5, err := s.LoadKeyBank(m1m2m3[:16], m1m2m3[16:48], m1m2m3[48:], *fBank1)
+		if err != nil {
+			return emuError(err)
+		}
+		result = append(m4, m5...)
+
+	case "load-plain-key":
+		key, err := util.ReadSecret(*fKey)
+		if err != nil {
+			return fmt.Errorf("failed to decode key: %w", err)
+		}
+		defer key.Destroy()
+		if err := s.LoadPlainKey(key.Bytes()); err != nil {
+			return emuError(err)
+		}
+
+	case "enc-ecb", "dec-ecb", "enc-cbc", "dec-cbc", "generate-mac", "verify-mac":
+		id, err := keyID()
+		if err != nil {
+			return err
+		}
+		input, err := readInput()
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "enc-ecb":
+			result, err = s.EncryptECB(id, input)
+		case "dec-ecb":
+			result, err = s.DecryptECB(id, input)
+		case "enc-cbc", "dec-cbc":
+			iv, ivErr := util.HexOrSource(*fIV)
+			if ivErr != nil {
+				return fmt.Errorf("failed to decode IV: %w", ivErr)
+			}
+			if command == "enc-cbc" {
+				result, err = s.EncryptCBC(id, iv, input)
+			} else {
+				result, err = s.DecryptCBC(id, iv, input)
+			}
+		case "generate-mac":
+			result, err = s.GenerateMAC(id, input)
+		case "verify-mac":
+			mac, macErr := hex.DecodeString(*fMAC)
+			if macErr != nil {
+				return fmt.Errorf("failed to decode MAC: %w", macErr)
+			}
+			valid, err = s.VerifyMAC(id, input, mac)
+		}
+		if err != nil {
+			return emuError(err)
+		}
+
+	case "init-rng":
+		if err := s.InitRNG(); err != nil {
+			return emuError(err)
+		}
+
+	case "rnd":
+		result, err = s.Rnd()
+		if err != nil {
+			return emuError(err)
+		}
+
+	case "debug":
+		result, err = s.Debug()
+		if err != nil {
+			return emuError(err)
+		}
+
+	case "debug-auth":
+		auth, err := hex.DecodeString(cmd.Flags.Arg(1))
+		if err != nil {
+			return fmt.Errorf("failed to decode authorization: %w", err)
+		}
+		// the challenge is consumed even if the authorization fails
+		authErr := s.DebugAuthorize(auth)
+		if err := saveEmuState(*fState, s); err != nil {
+			return err
+		}
+		if cmd.JSON {
+			if err := stdfile.WriteJSON(os.Stdout, emuResult(command, nil, s)); err != nil {
+				return err
+			}
+		}
+		return emuError(authErr)
+
+	case "secure-boot":
+		image, err := readInput()
+		if err != nil {
+			return err
+		}
+		// the status is changed even if the secure boot fails
+		bootErr := s.SecureBoot(image)
+		if err := saveEmuState(*fState, s); err != nil {
+			return err
+		}
+		if cmd.JSON {
+			if err := stdfile.WriteJSON(os.Stdout, emuResult(command, nil, s)); err != nil {
+				return err
+			}
+		}
+		return emuError(bootErr)
+
+	default:
+		cmd.Flags.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	if err := saveEmuState(*fState, s); err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		r := emuResult(command, result, s)
+		if command == "verify-mac" {
+			r["valid"] = valid
+		}
+		sf, err := stdfile.New("", *fOutput, fOut.Options)
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		if err := sf.WriteJSON(r); err != nil {
+			return err
+		}
+	}
+
+	if !valid {
+		return util.ErrNotValid
+	}
+
+	if result == nil || cmd.JSON {
+		return nil
+	}
+
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	return sf.Write(result, fOut)
+}
+
+// emuResult returns the JSON output of command: the status of the module
+// and the result of the command, if any.
+func emuResult(command string, result []byte, s *emu.State) stdfile.Result {
+	r := stdfile.Result{"status": s.Status}
+	switch command {
+	case "load-key":
+		r["m4"] = stdfile.Hex(result[:32])
+		r["m5"] = stdfile.Hex(result[32:])
+	case "enc-ecb", "enc-cbc":
+		r["ciphertext"] = stdfile.Hex(result)
+	case "dec-ecb", "dec-cbc":
+		r["plaintext"] = stdfile.Hex(result)
+	case "generate-mac":
+		r["mac"] = stdfile.Hex(result)
+	case "rnd":
+		r["random"] = stdfile.Hex(result)
+	case "debug":
+		r["challenge"] = stdfile.Hex(result)
+	}
+	return r
+}
+
+// emuError returns the SHE error codes as crypto failures.
+func emuError(err error) error {
+	var code emu.ErrorCode
+	if errors.As(err, &code) {
+		return util.CryptoFailure(err)
+	}
+	return err
+}
+
+func emuInit(path, uidHex, secretKeyHex, masterKeyHex, bootMACKeyHex, profile string, force bool) error {
+	if uidHex == "" {
+		return errors.New("UID(-uid) not specified")
+	}
+	if _, err := os.Stat(path); !force && !errors.Is(err, fs.ErrNotExist) {
+		if err != nil {
+			return err
+		}
+		return cmd.WithCategory(cmd.CategoryUsage, fmt.Errorf("%s already exists, use -force to overwrite it", path))
+	}
+	p, err := she.LookupProfile(profile)
+	if err != nil {
+		return err
+	}
+	uid, err := hex.DecodeString(uidHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode UID: %w", err)
+	}
+
+	var secretKey *secret.Buffer
+	if secretKeyHex == "" {
+		if secretKey, err = secret.New(16); err != nil {
+			return err
+		}
+		if _, err := rand.Read(secretKey.Bytes()); err != nil {
+			secretKey.Destroy()
+			return err
+		}
+	} else {
+		secretKey, err = util.ReadSecret(secretKeyHex)
+		if err != nil {
+			return fmt.Errorf("failed to decode secret key: %w", err)
+		}
+	}
+	defer secretKey.Destroy()
+
+	s, err := emu.New(uid, secretKey.Bytes(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	if p.Name != she.ProfileSHE.Name {
+		s.Profile = p.Name
+	}
+
+	// keys that cannot be loaded with CMD_LOAD_KEY on an empty module
+	initialKeys := []struct {
+		id    she.KeyID
+		value string
+	}{
+		{she.MASTER_ECU_KEY, masterKeyHex},
+		{she.BOOT_MAC_KEY, bootMACKeyHex},
+	}
+	for _, v := range initialKeys {
+		if v.value == "" {
+			continue
+		}
+		key, err := util.ReadSecret(v.value)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", v.id, err)
+		}
+		if n := key.Len(); n != 16 {
+			key.Destroy()
+			return fmt.Errorf("%s: invalid key size: %d", v.id, n)
+		}
+		s.Slots[v.id].Key = hex.EncodeToString(key.Bytes())
+		key.Destroy()
+	}
+
+	return saveEmuState(path, s)
+}
+
+func loadEmuState(path string) (*emu.State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return emu.Load(f)
+}
+
+// saveEmuState replaces the file at path with s, the temporary file is
+// created with mode 0600 since it contains the keys.
+func saveEmuState(path string, s *emu.State) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if err := s.Save(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func printEmuStatus(s *emu.State) error {
+	type slot struct {
+		ID      she.KeyID
+		Name    string
+		Empty   bool
+		Counter uint32
+		Flags   mup.ProtectionFlags
+	}
+	p, err := she.LookupProfile(s.Profile)
+	if err != nil {
+		return err
+	}
+	status := struct {
+		UID      string
+		Profile  string
+		Register string
+		Status   emu.Status
+		Slots    []slot
+	}{
+		UID:      s.UID,
+		Profile:  p.Name,
+		Register: fmt.Sprintf("%08b", s.Status.Encode()),
+		Status:   s.Status,
+	}
+	for i, v := range s.Slots {
+		id := she.KeyID(i)
+		if !p.IsValid(id) {
+			continue
+		}
+		status.Slots = append(status.Slots, slot{
+			ID:      id,
+			Name:    id.String(),
+			Empty:   v.IsEmpty(),
+			Counter: v.Counter,
+			Flags:   v.Flags,
+		})
+	}
+
+	return stdfile.WriteJSON(os.Stdout, status)
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestEmuInitExisting(t *testing.T) {
+	state := filepath.Join(t.TempDir(), "state.json")
+	const uid = "000000000000000000000000000001"
+
+	if err := testutil.RunCmd(EmuCmd, "-state", state, "-uid", uid, "init"); err != nil {
+		t.Fatal(err)
+	}
+	before := testutil.ReadFile(t, state)
+
+	err := testutil.RunCmd(EmuCmd, "-state", state, "-uid", "000000000000000000000000000002", "init")
+	if c := cmd.CategoryOf(err); c != cmd.CategoryUsage {
+		t.Fatal("expected usage error, have", c, err)
+	}
+	testutil.ExpectFileContent(t, state, before)
+
+	if err := testutil.RunCmd(EmuCmd, "-state", state, "-force", "-uid", uid, "init"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEmu(t *testing.T) {
+	tmp := t.TempDir()
+	state := filepath.Join(tmp, "state.json")
+	out := filepath.Join(tmp, "out")
+	in := filepath.Join(tmp, "in")
+
+	run := func(args ...string) error {
+		return testutil.RunCmd(EmuCmd, append([]string{"-state", state, "-force"}, args...)...)
+	}
+
+	if err := run(
+		"-uid", "000000000000000000000000000001",
+		"-master-key", "000102030405060708090a0b0c0d0e0f",
+		"init",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if perm := info.Mode().Perm(); perm != 0600 {
+			t.Fatalf("state permissions: %o", perm)
+		}
+	}
+
+	if err := run(
+		"-out", out,
+		"load-key",
+		"00000000000000000000000000000141"+
+			"2b111e2d93f486566bcbba1d7f7a9797c94643b050fc5d4d7de14cff682203c3"+
+			"b9d745e5ace7d41860bc63c2b9f5bb46",
+	); err != nil {
+		t.Fatal(err)
+	}
+	testutil.ExpectFileContent(t, out, []byte(
+		"00000000000000000000000000000141b472e8d8727d70d57295e74849a27917"+
+			"820d8d95dc11b4668878160cb2a4e23e\n",
+	))
+
+	// same counter
+	if err := run(
+		"load-key",
+		"00000000000000000000000000000141"+
+			"2b111e2d93f486566bcbba1d7f7a9797c94643b050fc5d4d7de14cff682203c3"+
+			"b9d745e5ace7d41860bc63c2b9f5bb46",
+	); err == nil {
+		t.Fatal("expected error")
+	}
+
+	testutil.SetupIn(t, in, testutil.BytesFromHex(t, "00000000000000000000000000000000"))
+	if err := run("-key-id", "KEY_1", "-in", in, "-out", out, "-bin", "enc-ecb"); err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := testutil.ReadFile(t, out)
+	testutil.SetupIn(t, in, ciphertext)
+	if err := run("-key-id", "KEY_1", "-in", in, "-out", out, "-bin", "dec-ecb"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.ExpectFileContent(t, out, make([]byte, 16))
+
+	// KEY_1 is for encryption only
+	if err := run("-key-id", "KEY_1", "-in", in, "generate-mac"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := run("-key", "2b7e151628aed2a6abf7158809cf4f3c", "load-plain-key"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.SetupIn(t, in, testutil.BytesFromHex(t, "6bc1bee22e409f96e93d7e117393172a"))
+	if err := run("-key-id", "RAM_KEY", "-in", in, "-out", out, "generate-mac"); err != nil {
+		t.Fatal(err)
+	}
+	testutil.ExpectFileContent(t, out, []byte("070a16b46b4d4144f79bdd9dd04a287c\n"))
+	if err := run("-key-id", "RAM_KEY", "-in", in, "-mac", "070a16b46b4d4144", "verify-mac"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("-key-id", "RAM_KEY", "-in", in, "-mac", "070a16b46b4d4145", "verify-mac"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err := run("rnd"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := run("init-rng"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("rnd"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run("-in", in, "secure-boot"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, args := range [][]string{
+		{"status"},
+		{"debugger", "attach"},
+		{"debugger", "detach"},
+		{"reset"},
+	} {
+		if err := run(args...); err != nil {
+			t.Fatal(args, err)
+		}
+	}
+
+	for _, args := range [][]string{
+		{},
+		{"foo"},
+		{"debugger"},
+		{"enc-ecb"},
+		{"-key-id", "KEY_11", "enc-ecb"},
+	} {
+		if err := run(args...); err == nil {
+			t.Fatal(args, "expected error")
+		}
+	}
+
+	if err := testutil.RunCmd(EmuCmd, "status"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -1,13 +1,20 @@
 package cmd
 
 import (
-	"encoding/hex"
+	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/ledger"
 	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
 var EncodeCmd = &cmd.Command{
@@ -15,15 +22,62 @@ var EncodeCmd = &cmd.Command{
 	Run:   runEncode,
 	Brief: "Encode JSON input to M1,M2,M3,M4,M5",
 
-	Usage: `Usage: pocryp she-encode [input.json]
+	Usage: `Usage: pocryp she-encode [-l] [-profile she|csec|she+] [-batch-in json|csv] [-records jsonl|csv]
+                        [-ledger LEDGER] [-allow-wildcard] [-out OUTPUT] [input]
 
 Encode the given JSON input file to M1,M2,M3,M4,M5.
 If no argument given, stdin will be read.
+If -out is not specified, the output will be printed to stdout.
+
+M1,M2,M3,M4,M5 are printed as hex lines by default, -out-format c, go and
+rust give the variables NAME_m1..NAME_m5(see -var-name), bin, ihex and srec
+give the 112 bytes of M1..M5 as one block, like -l.
+
+Device profiles:
+  she   Standard SHE key slots(default)
+  csec  NXP CSEc, adds the extended keys KEY_11..KEY_17
+  she+  SHE+ and HSM firmwares with 20 keys, adds KEY_11..KEY_20
+The extended keys are in the key bank 1, M1 contains only the lower 4 bits
+of their IDs: they can be updated only with themselves or MASTER_ECU_KEY.
+-profile applies to the inputs that don't specify a Profile.
+
+Batch mode:
+The input can also be a JSON array of inputs or a CSV file(-batch-in csv)
+with a header line and the columns:
+  UID,AuthID,AuthKey,ID,NewKey,Counter[,Write,Boot,Debugger,KeyUsage,Wildcard,Profile]
+The IDs can be given as names(e.g. KEY_1) or numbers, empty flags are false.
+
+For every input a record with the UID, ID, AuthID, Counter and M1,M2,M3,M4,M5
+is printed as JSON Lines(default) or CSV(-records csv).
+If the same UID and ID appear multiple times, the counter must increase.
+
+If any input is not valid, nothing is printed and the errors give the
+offending row(the CSV line or the index of the JSON array element).
+
+Safeguards:
+The wildcard UID(all zeros) updates every module whose key slot is not
+wildcard protected, it is refused unless -allow-wildcard is specified.
+
+If -ledger is specified, the issued updates are recorded in the file at path
+LEDGER(created if it doesn't exist) and every input is checked against it:
+the counter must be greater than the one issued for the same UID and key slot,
+write protected slots cannot be updated and, for the wildcard UID, no module
+in the ledger can have the key slot wildcard protected.
+The ledger can be shared by runs at the same time: a run holds an exclusive
+lock on the file LEDGER.lock(left in place) from reading the ledger to
+writing it, the other runs wait for it.
 `,
 }
 
 func runEncode(cmd *cmd.Command) error {
 	oneLine := cmd.Flags.Bool("l", false, "Print everything on one line")
+	inFormat := cmd.Flags.String("batch-in", "json", "Format of the input: json or csv.")
+	outFormat := cmd.Flags.String("records", "", "Format of the batch records: jsonl or csv.")
+	profile := cmd.Flags.String("profile", "", "Device profile: she, csec or she+.")
+	ledgerPath := cmd.Flags.String("ledger", "", "Check and record the updates in the file at path LEDGER.")
+	allowWildcard := cmd.Flags.Bool("allow-wildcard", false, "Allow the wildcard UID.")
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
 
 	if isHelp, err := cmd.Parse(); err != nil {
 		if isHelp {
@@ -32,8 +86,44 @@ func runEncode(cmd *cmd.Command) error {
 		return err
 	}
 
+	switch *outFormat {
+	case "", "jsonl", "csv":
+	default:
+		cmd.Flags.Usage()
+		return fmt.Errorf("unknown output format %q", *outFormat)
+	}
+
+	if _, err := she.LookupProfile(*profile); err != nil {
+		cmd.Flags.Usage()
+		return err
+	}
+
+	l := &ledger.Ledger{}
+	if *ledgerPath != "" {
+		// held until the ledger is saved, so two runs cannot issue the
+		// same counter
+		unlock, err := stdfile.Lock(*ledgerPath + ".lock")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		if l, err = loadLedger(*ledgerPath); err != nil {
+			return err
+		}
+	}
+
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
 	inFile := os.Stdin
-	if cmd.Flags.NArg() > 0 {
+	if cmd.Flags.NArg() == 0 {
+		if err := stdfile.ClaimStdin("the input"); err != nil {
+			return err
+		}
+	} else {
 		f, err := os.Open(cmd.Flags.Arg(0))
 		if err != nil {
 			return err
@@ -42,26 +132,168 @@ func runEncode(cmd *cmd.Command) error {
 		inFile = f
 	}
 
-	var input mup.Input
-	if err := json.NewDecoder(inFile).Decode(&input); err != nil {
+	data, err := io.ReadAll(inFile)
+	if err != nil {
 		return err
 	}
 
-	result, err := input.Encode()
+	var inputs []mup.BatchInput
+	switch *inFormat {
+	case "csv":
+		inputs, err = mup.ReadCSV(bytes.NewReader(data))
+	case "json":
+		if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+			inputs, err = mup.ReadJSON(bytes.NewReader(data))
+			break
+		}
+
+		var input mup.Input
+		if err := json.Unmarshal(data, &input); err != nil {
+			return err
+		}
+		if input.Profile == "" {
+			input.Profile = *profile
+		}
+		if *outFormat != "" {
+			inputs = []mup.BatchInput{{Row: 1, Input: input}}
+			break
+		}
+		result, err := input.Encode()
+		if err != nil {
+			return err
+		}
+		if err := l.Check(input, *allowWildcard); err != nil {
+			return err
+		}
+		l.Add(input, input.Record(result))
+		if err := saveLedger(*ledgerPath, l); err != nil {
+			return err
+		}
+		if cmd.JSON {
+			return sf.WriteJSON(input.Record(result))
+		}
+		return writeMs(sf, result, *oneLine, fOut)
+	default:
+		cmd.Flags.Usage()
+		return fmt.Errorf("unknown input format %q", *inFormat)
+	}
 	if err != nil {
 		return err
 	}
 
-	if *oneLine {
-		fmt.Println(hex.EncodeToString(result[:]))
-	} else {
-		m1, m2, m3, m4, m5 := mup.SliceMs(result)
-		fmt.Println(hex.EncodeToString(m1))
-		fmt.Println(hex.EncodeToString(m2))
-		fmt.Println(hex.EncodeToString(m3))
-		fmt.Println(hex.EncodeToString(m4))
-		fmt.Println(hex.EncodeToString(m5))
+	for i := range inputs {
+		if inputs[i].Profile == "" {
+			inputs[i].Profile = *profile
+		}
 	}
 
-	return nil
+	records, err := mup.EncodeBatch(inputs)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i, in := range inputs {
+		if err := l.Check(in.Input, *allowWildcard); err != nil {
+			errs = append(errs, &mup.RowError{Row: in.Row, Err: err})
+			continue
+		}
+		l.Add(in.Input, records[i])
+	}
+	if len(errs) != 0 {
+		return errors.Join(errs...)
+	}
+	if err := saveLedger(*ledgerPath, l); err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"records": records})
+	}
+
+	if *outFormat == "csv" {
+		w := csv.NewWriter(sf.Out)
+		if err := w.Write(mup.RecordCSVHeader); err != nil {
+			return err
+		}
+		for _, r := range records {
+			if err := w.Write(r.CSV()); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		return sf.Commit()
+	}
+
+	enc := json.NewEncoder(sf.Out)
+	for _, r := range records {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	return sf.Commit()
+}
+
+// writeMs writes M1,M2,M3,M4,M5 to sf in the format o, one after the other
+// unless oneLine is set or o is a binary format.
+func writeMs(sf *stdfile.StdFile, result [112]byte, oneLine bool, o *stdfile.Output) error {
+	if oneLine || !o.IsText() {
+		return sf.Write(result[:], o)
+	}
+	m1, m2, m3, m4, m5 := mup.SliceMs(result)
+	for i, m := range [][]byte{m1, m2, m3, m4, m5} {
+		mo := *o
+		mo.Name = fmt.Sprintf("%s_m%d", o.Name, i+1)
+		data, err := mo.Encode(m)
+		if err != nil {
+			return err
+		}
+		if _, err := sf.Out.Write(data); err != nil {
+			return err
+		}
+	}
+	return sf.Commit()
+}
+
+// loadLedger reads the ledger at path, a missing file is an empty ledger.
+func loadLedger(path string) (*ledger.Ledger, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &ledger.Ledger{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	l, err := ledger.Load(f)
+	if err != nil {
+		return nil, fmt.Errorf("ledger: %w", err)
+	}
+	return l, nil
+}
+
+// saveLedger writes the ledger to a temporary file renamed to path, so the
+// ledger is not lost if the write fails. An empty path is a no-op.
+func saveLedger(path string, l *ledger.Ledger) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if err := l.Save(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
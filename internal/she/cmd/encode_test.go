@@ -1,7 +1,12 @@
 package cmd
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
 )
 
 func TestEncode(t *testing.T) {
@@ -11,3 +16,114 @@ func TestEncode(t *testing.T) {
 		t.Fatal("expected error")
 	}
 }
+
+func TestEncodeBatch(t *testing.T) {
+	tmp := t.TempDir()
+	csvFile := filepath.Join(tmp, "in.csv")
+	jsonFile := filepath.Join(tmp, "in.json")
+
+	testutil.SetupIn(t, csvFile, []byte(
+		"UID,AuthID,AuthKey,ID,NewKey,Counter\n"+
+			"000000000000000000000000000001,MASTER_ECU_KEY,000102030405060708090a0b0c0d0e0f,KEY_1,0f0e0d0c0b0a09080706050403020100,1\n",
+	))
+	input, err := os.ReadFile("example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testutil.SetupIn(t, jsonFile, append(append([]byte("["), input...), ']'))
+
+	tests := []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"CSVToJSONL", []string{"-batch-in", "csv", csvFile}, true},
+		{"CSVToCSV", []string{"-batch-in", "csv", "-records", "csv", csvFile}, true},
+		{"JSONArray", []string{jsonFile}, true},
+		{"SingleObjectAsRecord", []string{"-records", "csv", "example.json"}, true},
+		{"SingleObject", []string{"example.json"}, true},
+		{"CSVAsJSON", []string{csvFile}, false},
+		{"UnknownInFormat", []string{"-batch-in", "xml", csvFile}, false},
+		{"UnknownOutFormat", []string{"-records", "xml", csvFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testutil.RunCmd(EncodeCmd, tt.args...)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestEncodeOutFormat(t *testing.T) {
+	tmp := t.TempDir()
+	out := filepath.Join(tmp, "out")
+
+	if err := testutil.RunCmd(EncodeCmd, "-bin", "-out", out, "example.json"); err != nil {
+		t.Fatal(err)
+	}
+	if b := testutil.ReadFile(t, out); len(b) != 112 {
+		t.Fatalf("expected M1..M5(112 bytes), have %d bytes", len(b))
+	}
+
+	if err := testutil.RunCmd(EncodeCmd, "-out-format", "c", "-force", "-out", out, "example.json"); err != nil {
+		t.Fatal(err)
+	}
+	c := string(testutil.ReadFile(t, out))
+	for _, name := range []string{"data_m1[16]", "data_m2[32]", "data_m3[16]", "data_m4[32]", "data_m5[16]"} {
+		if !strings.Contains(c, name) {
+			t.Fatalf("%s not found in:\n%s", name, c)
+		}
+	}
+}
+
+func TestEncodeLedger(t *testing.T) {
+	tmp := t.TempDir()
+	ledgerFile := filepath.Join(tmp, "ledger.json")
+	csvFile := filepath.Join(tmp, "in.csv")
+	wildcardFile := filepath.Join(tmp, "wildcard.json")
+
+	testutil.SetupIn(t, csvFile, []byte(
+		"UID,AuthID,AuthKey,ID,NewKey,Counter\n"+
+			"000000000000000000000000000001,MASTER_ECU_KEY,000102030405060708090a0b0c0d0e0f,KEY_2,0f0e0d0c0b0a09080706050403020100,1\n"+
+			"000000000000000000000000000002,MASTER_ECU_KEY,000102030405060708090a0b0c0d0e0f,KEY_2,0f0e0d0c0b0a09080706050403020100,1\n",
+	))
+	testutil.SetupIn(t, wildcardFile, []byte(`{
+  "UID": "000000000000000000000000000000",
+  "AuthID": 1,
+  "AuthKey": "000102030405060708090a0b0c0d0e0f",
+  "ID": 4,
+  "NewKey": "0f0e0d0c0b0a09080706050403020100",
+  "Counter": 1
+}`))
+
+	tests := []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"First", []string{"-ledger", ledgerFile, "example.json"}, true},
+		{"Reused", []string{"-ledger", ledgerFile, "example.json"}, false},
+		{"Batch", []string{"-ledger", ledgerFile, "-batch-in", "csv", csvFile}, true},
+		{"BatchReused", []string{"-ledger", ledgerFile, "-batch-in", "csv", csvFile}, false},
+		{"NoLedger", []string{"example.json"}, true},
+		{"Wildcard", []string{wildcardFile}, false},
+		{"WildcardAllowed", []string{"-allow-wildcard", wildcardFile}, true},
+		{"WildcardCounter", []string{"-ledger", ledgerFile, "-allow-wildcard", wildcardFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testutil.RunCmd(EncodeCmd, tt.args...)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var KDFCmd = &cmd.Command{
+	Name:  "she-kdf",
+	Run:   runKDF,
+	Brief: "Derive a key with the SHE key derivation function",
+
+	Usage: `Usage: pocryp she-kdf [-bin] -key/-key-file -const CONSTANT [-out OUTPUT]
+
+Derive a key from the given key(16 bytes) and constant, using the SHE key
+derivation function: KDF(K, C) = AES-MP(K || C).
+
+CONSTANT is one of the constants of the SHE specification or any constant given
+as hex(16 bytes):
+` + kdfConstantNames() + `
+E.g. K1 of the memory update protocol is KDF(AuthKey, KEY_UPDATE_ENC_C).
+
+If -out is not specified, the output will be printed to stdout.
+`,
+}
+
+func kdfConstantNames() string {
+	var names []string
+	for name := range she.KDFConstants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %-17s %x\n", name, she.KDFConstants[name])
+	}
+	return b.String()
+}
+
+func runKDF(cmd *cmd.Command) error {
+	fOutput := cmd.Flags.String("out", "", "Write the result to the file at path OUTPUT.")
+	fKey := cmd.Flags.String("key", "", "Key as hex.")
+	fKeyFile := cmd.Flags.String("key-file", "", "File which contains the key as binary/text.")
+	fKeyFormat := util.KeyFormatFlag(cmd.Flags)
+	fConst := cmd.Flags.String("const", "", "Constant name or hex.")
+	fOut := stdfile.OutputFlags(cmd.Flags)
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	key, err := util.ReadKey(*fKeyFile, *fKey, *fKeyFormat)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	defer key.Destroy()
+
+	if *fConst == "" {
+		cmd.Flags.Usage()
+		return errors.New("no constant specified, use -const to specify it")
+	}
+
+	constant, err := she.ParseKDFConstant(*fConst)
+	if err != nil {
+		return util.InvalidInput(err)
+	}
+
+	result, err := she.KDF(key.Bytes(), constant)
+	if err != nil {
+		return util.InvalidInput(err)
+	}
+	defer secret.Wipe(result)
+
+	fOut.Secret = true
+	sf, err := stdfile.New("", *fOutput, fOut.Options)
+	if err != nil {
+		return err
+	}
+	defer sf.Close()
+
+	if cmd.JSON {
+		return sf.WriteJSON(stdfile.Result{"key": stdfile.Hex(result)})
+	}
+
+	return sf.Write(result, fOut)
+}
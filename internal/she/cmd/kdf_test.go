@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestKDF(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	const key = "000102030405060708090a0b0c0d0e0f"
+
+	tests := []struct {
+		constant string
+		expected string
+	}{
+		{"KEY_UPDATE_ENC_C", "118a46447a770d87828a69c222e2d17e"},
+		{"010253484500800000000000000000b0", "2ebb2a3da62dbd64b18ba6493e9fbe22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constant, func(t *testing.T) {
+			if err := testutil.RunCmd(KDFCmd, "-key", key, "-const", tt.constant, "-out", out, "-force", "-bin"); err != nil {
+				t.Fatal(err)
+			}
+			testutil.ExpectFileContentHex(t, out, tt.expected)
+		})
+	}
+
+	for _, args := range [][]string{
+		{"-const", "DEBUG_KEY_C"},
+		{"-key", key},
+		{"-key", key, "-const", "FOO_C"},
+		{"-key", "0001", "-const", "DEBUG_KEY_C"},
+	} {
+		if err := testutil.RunCmd(KDFCmd, args...); err == nil {
+			t.Fatal(args, "expected error")
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-key", key, "-const", "010353484500800000000000000000b0010353484500800000000000000000b0"},
+		{"-key", key + key + key, "-const", "DEBUG_KEY_C"},
+	} {
+		err := testutil.RunCmd(KDFCmd, args...)
+		if c := cmd.CategoryOf(err); c != cmd.CategoryInvalidInput {
+			t.Fatal(args, "expected invalid-input error, have", c, err)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/util"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+var VerifyCmd = &cmd.Command{
+	Name:  "she-verify",
+	Run:   runVerify,
+	Brief: "Verify M4,M5 returned by the SHE module",
+
+	Usage: `Usage: pocryp she-verify [-key NEW_KEY] [-auth-key AUTH_KEY] [-profile she|csec|she+ [-bank1]] [hex_string]
+
+Verify the M4,M5 returned by the SHE module after CMD_LOAD_KEY and print
+the confirmed UID, key IDs and counter as JSON.
+
+The input is M4,M5 or M1,M2,M3,M4,M5 given as a hex string.
+M5 is checked using the new key and the counter encrypted in M4 is decrypted.
+
+If M1,M2,M3 are given, M4 must contain the same M1.
+If -auth-key is also specified, M1,M2,M3 are decoded and the counter confirmed
+in M4 must match the requested one, in this case -key is optional as the new
+key is taken from M2.
+
+M1 and M4 contain only the lower 4 bits of the IDs, for the extended keys of a
+device profile(see she-encode) the key bank must be given with -bank1.
+
+If no argument given, stdin will be read.
+`,
+}
+
+func runVerify(cmd *cmd.Command) error {
+	keyHex := cmd.Flags.String("key", "", "New key as hex")
+	authKeyHex := cmd.Flags.String("auth-key", "", "Secret key used to decode M1,M2,M3 as hex")
+	profileName := cmd.Flags.String("profile", "", "Device profile: she, csec or she+.")
+	bank1 := cmd.Flags.Bool("bank1", false, "The update is for the key bank 1(extended keys).")
+
+	if isHelp, err := cmd.Parse(); err != nil {
+		if isHelp {
+			return nil
+		}
+		return err
+	}
+
+	profile, err := she.LookupProfile(*profileName)
+	if err != nil {
+		return err
+	}
+
+	input := cmd.Flags.Arg(0)
+	if cmd.Flags.NArg() == 0 {
+		data, err := stdfile.ReadStdin("the input")
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		input = string(data)
+	}
+
+	data, err := stdfile.Decode([]byte(input), "hex")
+	if err != nil {
+		return fmt.Errorf("failed to decode input: %w", err)
+	}
+
+	var request *mup.Input
+	var m4m5 []byte
+	switch len(data) {
+	case 48:
+		m4m5 = data
+	case 112:
+		m1, _, _, m4, _ := mup.SliceMs([112]byte(data))
+		if !bytes.Equal(m1, m4[:16]) {
+			return fmt.Errorf("M1 does not match M4")
+		}
+		m4m5 = data[64:]
+		if *authKeyHex != "" {
+			authKey, err := decodeKey(*authKeyHex)
+			if err != nil {
+				return fmt.Errorf("failed to decode auth key: %w", err)
+			}
+			defer authKey.Destroy()
+			request, err = mup.DecodeProfile(data[:64], authKey.Bytes(), profile, *bank1)
+			if err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("invalid input length: %d, expected M4,M5 or M1,M2,M3,M4,M5", len(data))
+	}
+
+	if *authKeyHex != "" && request == nil {
+		return fmt.Errorf("-auth-key needs M1,M2,M3 in the input")
+	}
+
+	if *keyHex == "" {
+		if request == nil {
+			return fmt.Errorf("new key(-key) not specified")
+		}
+		*keyHex = request.NewKey
+	}
+
+	key, err := decodeKey(*keyHex)
+	if err != nil {
+		return fmt.Errorf("failed to decode key: %w", err)
+	}
+	defer key.Destroy()
+
+	if request != nil && request.NewKey != hex.EncodeToString(key.Bytes()) {
+		return fmt.Errorf("%w: new key does not match the key from M2", util.ErrNotValid)
+	}
+
+	result, err := mup.VerifyResponseProfile(m4m5, key.Bytes(), profile, *bank1)
+	if errors.Is(err, mup.ErrM5) {
+		return fmt.Errorf("%w: %w", util.ErrNotValid, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	if request != nil && request.Counter != result.Counter {
+		return fmt.Errorf("%w: counter in M4(%d) does not match the counter in M2(%d)", util.ErrNotValid, result.Counter, request.Counter)
+	}
+
+	return stdfile.WriteJSON(os.Stdout, result)
+}
+
+func decodeKey(s string) (*secret.Buffer, error) {
+	key, err := util.ReadSecret(s)
+	if err != nil {
+		return nil, err
+	}
+	if key.Len() != 16 {
+		key.Destroy()
+		return nil, fmt.Errorf("invalid key size: %d", key.Len())
+	}
+	return key, nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"testing"
+
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestVerify(t *testing.T) {
+	const (
+		authKey = "000102030405060708090a0b0c0d0e0f"
+		newKey  = "0f0e0d0c0b0a09080706050403020100"
+		m1m2m3  = "00000000000000000000000000000141" +
+			"2b111e2d93f486566bcbba1d7f7a9797c94643b050fc5d4d7de14cff682203c3" +
+			"b9d745e5ace7d41860bc63c2b9f5bb46"
+		m4m5 = "00000000000000000000000000000141b472e8d8727d70d57295e74849a27917" +
+			"820d8d95dc11b4668878160cb2a4e23e"
+	)
+
+	tests := []struct {
+		name  string
+		args  []string
+		valid bool
+	}{
+		{"M4M5", []string{"-key", newKey, m4m5}, true},
+		{"M1M2M3M4M5", []string{"-key", newKey, m1m2m3 + m4m5}, true},
+		{"AuthKey", []string{"-auth-key", authKey, m1m2m3 + m4m5}, true},
+		{"AuthKeyAndKey", []string{"-auth-key", authKey, "-key", newKey, m1m2m3 + m4m5}, true},
+		{"WrongKey", []string{"-key", authKey, m4m5}, false},
+		{"KeyDoesNotMatchM2", []string{"-auth-key", authKey, "-key", authKey, m1m2m3 + m4m5}, false},
+		{"M1DoesNotMatchM4", []string{"-key", newKey, "00000000000000000000000000000241" + m1m2m3[32:] + m4m5}, false},
+		{"AuthKeyWithoutM1M2M3", []string{"-auth-key", authKey, m4m5}, false},
+		{"NoKey", []string{m4m5}, false},
+		{"InvalidLength", []string{"-key", newKey, m4m5[:94]}, false},
+		{"InvalidFlag", []string{"-foo"}, false},
+		// the ID 4 of M4 is KEY_11 in the key bank 1
+		{"Bank1", []string{"-profile", "csec", "-bank1", "-key", newKey, m4m5}, true},
+		{"Bank1NotInProfile", []string{"-bank1", "-key", newKey, m4m5}, false},
+		{"UnknownProfile", []string{"-profile", "foo", "-key", newKey, m4m5}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := testutil.RunCmd(VerifyCmd, tt.args...)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,611 @@
+package emu
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+)
+
+// Slot is the content of one key slot.
+type Slot struct {
+	// key as hex string, empty if the key was never loaded
+	Key string
+
+	// counter of the last update
+	Counter uint32
+
+	// protection flags of the key
+	Flags mup.ProtectionFlags
+}
+
+func (s Slot) IsEmpty() bool {
+	return s.Key == ""
+}
+
+// Status contains the bits of the SHE status register.
+type Status struct {
+	// secure boot was performed
+	SecureBoot bool
+	// BOOT_MAC was computed by the autonomous bootstrap
+	BootInit bool
+	// secure boot finished
+	BootFinished bool
+	// secure boot was successful
+	BootOK bool
+	// CMD_INIT_RNG was performed
+	RndInit bool
+	// an external debugger is attached
+	ExtDebugger bool
+}
+
+// Encode returns the value of the status register.
+func (s Status) Encode() uint8 {
+	var v uint8
+	bits := []bool{false, s.SecureBoot, s.BootInit, s.BootFinished, s.BootOK, s.RndInit, s.ExtDebugger, false}
+	for i, b := range bits {
+		if b {
+			v |= 1 << i
+		}
+	}
+	return v
+}
+
+// State is the complete state of an emulated SHE module, the volatile parts
+// (RAM_KEY, secure boot status, PRNG state) are kept until Reset is called.
+type State struct {
+	// SHE module Unique ID as hex string
+	UID string
+
+	// device profile(see she.LookupProfile), empty for standard SHE
+	Profile string `json:",omitempty"`
+
+	// key slots indexed by she.KeyID, the extended keys are used only if
+	// the profile has them
+	Slots [she.KEY_20 + 1]Slot
+
+	// RAM_KEY was loaded with CMD_LOAD_PLAIN_KEY
+	PlainRAMKey bool
+
+	Status Status
+
+	// non-volatile PRNG seed as hex string
+	PRNGSeed string
+
+	// current PRNG state as hex string
+	PRNGState string
+
+	// challenge of the last CMD_DEBUG as hex string
+	Challenge string
+}
+
+// New returns a new SHE module with the given UID and SECRET_KEY, all the
+// other slots are empty. The initial PRNG seed is read from random.
+func New(uid, secretKey []byte, random io.Reader) (*State, error) {
+	if len(uid) != 15 {
+		return nil, fmt.Errorf("UID expected length is 15 bytes, have %d bytes", len(uid))
+	}
+	if isWildcard(uid) {
+		return nil, fmt.Errorf("UID cannot be the wildcard UID")
+	}
+	if len(secretKey) != 16 {
+		return nil, fmt.Errorf("invalid key size: %d", len(secretKey))
+	}
+
+	seed := make([]byte, 16)
+	if _, err := io.ReadFull(random, seed); err != nil {
+		return nil, err
+	}
+
+	s := &State{
+		UID:      hex.EncodeToString(uid),
+		PRNGSeed: hex.EncodeToString(seed),
+	}
+	s.Slots[she.SECRET_KEY].Key = hex.EncodeToString(secretKey)
+
+	return s, nil
+}
+
+// Load reads a state previously written with Save.
+func Load(r io.Reader) (*State, error) {
+	var s State
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	uid, err := hex.DecodeString(s.UID)
+	if err != nil || len(uid) != 15 {
+		return nil, fmt.Errorf("invalid UID %q", s.UID)
+	}
+	p, err := she.LookupProfile(s.Profile)
+	if err != nil {
+		return nil, err
+	}
+	for i, slot := range s.Slots {
+		if slot.IsEmpty() {
+			continue
+		}
+		if !p.IsValid(she.KeyID(i)) {
+			return nil, fmt.Errorf("%s is not valid for profile %s", she.KeyID(i), p.Name)
+		}
+		if _, err := decodeKey(slot.Key); err != nil {
+			return nil, fmt.Errorf("%s: %w", she.KeyID(i), err)
+		}
+	}
+	return &s, nil
+}
+
+// Save writes the state as JSON to w.
+func (s *State) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Reset emulates a power cycle: the volatile state is cleared.
+func (s *State) Reset() {
+	s.Slots[she.RAM_KEY] = Slot{}
+	s.PlainRAMKey = false
+	s.PRNGState = ""
+	s.Challenge = ""
+	debugger := s.Status.ExtDebugger
+	s.Status = Status{ExtDebugger: debugger}
+}
+
+// SetDebugger attaches or detaches the external debugger.
+func (s *State) SetDebugger(attached bool) {
+	s.Status.ExtDebugger = attached
+}
+
+// LoadKey implements CMD_LOAD_KEY: the key is updated with the values
+// from M1, M2, M3 and the M4, M5 confirming the update are returned.
+func (s *State) LoadKey(m1, m2, m3 []byte) (m4, m5 []byte, err error) {
+	return s.LoadKeyBank(m1, m2, m3, false)
+}
+
+// LoadKeyBank is like LoadKey, bank1 is true if the command selected the key
+// bank 1(the extended keys of the profile).
+func (s *State) LoadKeyBank(m1, m2, m3 []byte, bank1 bool) (m4, m5 []byte, err error) {
+	if len(m1) != 16 || len(m2) != 32 || len(m3) != 16 {
+		return nil, nil, ERC_GENERAL_ERROR
+	}
+
+	p, err := she.LookupProfile(s.Profile)
+	if err != nil {
+		return nil, nil, ERC_GENERAL_ERROR
+	}
+	id, authID, err := p.DecodeIDs(m1[15], bank1)
+	if err != nil {
+		return nil, nil, ERC_KEY_INVALID
+	}
+	if err := p.IsCompatible(id, authID); err != nil {
+		return nil, nil, ERC_KEY_INVALID
+	}
+
+	target := &s.Slots[id]
+	auth := s.Slots[authID]
+
+	uid := m1[:15]
+	wildcard := isWildcard(uid)
+	if !wildcard && hex.EncodeToString(uid) != s.UID {
+		return nil, nil, ERC_KEY_UPDATE_ERROR
+	}
+
+	if auth.IsEmpty() {
+		return nil, nil, ERC_KEY_EMPTY
+	}
+	if !s.isAvailable(auth) || !s.isAvailable(*target) {
+		return nil, nil, ERC_KEY_NOT_AVAILABLE
+	}
+	if !target.IsEmpty() && target.Flags.Write {
+		return nil, nil, ERC_KEY_WRITE_PROTECTED
+	}
+	if wildcard && target.Flags.Wildcard {
+		return nil, nil, ERC_KEY_UPDATE_ERROR
+	}
+
+	authKey, err := decodeKey(auth.Key)
+	if err != nil {
+		return nil, nil, ERC_MEMORY_FAILURE
+	}
+
+	in, err := mup.DecodeProfile(bytes.Join([][]byte{m1, m2, m3}, nil), authKey, p, bank1)
+	if err != nil {
+		return nil, nil, ERC_KEY_UPDATE_ERROR
+	}
+
+	if id == she.RAM_KEY {
+		// the RAM_KEY has no counter and no flags
+		in.Counter = 0
+		in.Flags = mup.ProtectionFlags{}
+		s.PlainRAMKey = false
+	} else if in.Counter <= target.Counter {
+		return nil, nil, ERC_KEY_UPDATE_ERROR
+	}
+
+	*target = Slot{
+		Key:     in.NewKey,
+		Counter: in.Counter,
+		Flags:   in.Flags,
+	}
+
+	// M4, M5 always contain the real UID
+	in.UID = s.UID
+	ms, err := in.Encode()
+	if err != nil {
+		return nil, nil, ERC_GENERAL_ERROR
+	}
+	_, _, _, m4, m5 = mup.SliceMs(ms)
+
+	return m4, m5, nil
+}
+
+// LoadPlainKey implements CMD_LOAD_PLAIN_KEY: the RAM_KEY is set to key.
+func (s *State) LoadPlainKey(key []byte) error {
+	if len(key) != 16 {
+		return ERC_GENERAL_ERROR
+	}
+	s.Slots[she.RAM_KEY] = Slot{Key: hex.EncodeToString(key)}
+	s.PlainRAMKey = true
+	return nil
+}
+
+// EncryptECB implements CMD_ENC_ECB.
+func (s *State) EncryptECB(id she.KeyID, plaintext []byte) ([]byte, error) {
+	return s.ecb(id, plaintext, true)
+}
+
+// DecryptECB implements CMD_DEC_ECB.
+func (s *State) DecryptECB(id she.KeyID, ciphertext []byte) ([]byte, error) {
+	return s.ecb(id, ciphertext, false)
+}
+
+// EncryptCBC implements CMD_ENC_CBC.
+func (s *State) EncryptCBC(id she.KeyID, iv, plaintext []byte) ([]byte, error) {
+	return s.cbc(id, iv, plaintext, true)
+}
+
+// DecryptCBC implements CMD_DEC_CBC.
+func (s *State) DecryptCBC(id she.KeyID, iv, ciphertext []byte) ([]byte, error) {
+	return s.cbc(id, iv, ciphertext, false)
+}
+
+func (s *State) ecb(id she.KeyID, in []byte, encrypt bool) ([]byte, error) {
+	block, err := s.cipher(id, in)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	for i := 0; i < len(in); i += aes.BlockSize {
+		if encrypt {
+			block.Encrypt(out[i:], in[i:])
+		} else {
+			block.Decrypt(out[i:], in[i:])
+		}
+	}
+	return out, nil
+}
+
+func (s *State) cbc(id she.KeyID, iv, in []byte, encrypt bool) ([]byte, error) {
+	if len(iv) != aes.BlockSize {
+		return nil, ERC_GENERAL_ERROR
+	}
+	block, err := s.cipher(id, in)
+	if err != nil {
+		return nil, err
+	}
+	var c cipher.BlockMode
+	if encrypt {
+		c = cipher.NewCBCEncrypter(block, iv)
+	} else {
+		c = cipher.NewCBCDecrypter(block, iv)
+	}
+	out := make([]byte, len(in))
+	c.CryptBlocks(out, in)
+	return out, nil
+}
+
+func (s *State) cipher(id she.KeyID, in []byte) (cipher.Block, error) {
+	if len(in) == 0 || len(in)%aes.BlockSize != 0 {
+		return nil, ERC_GENERAL_ERROR
+	}
+	key, err := s.useKey(id, false)
+	if err != nil {
+		return nil, err
+	}
+	return aes.NewCipher(key)
+}
+
+// GenerateMAC implements CMD_GENERATE_MAC.
+func (s *State) GenerateMAC(id she.KeyID, msg []byte) ([]byte, error) {
+	key, err := s.useKey(id, true)
+	if err != nil {
+		return nil, err
+	}
+	return cmac.Generate(key, msg)
+}
+
+// VerifyMAC implements CMD_VERIFY_MAC, mac can be truncated,
+// only its first len(mac) bytes are compared.
+func (s *State) VerifyMAC(id she.KeyID, msg, mac []byte) (bool, error) {
+	if len(mac) == 0 || len(mac) > aes.BlockSize {
+		return false, ERC_GENERAL_ERROR
+	}
+	expected, err := s.GenerateMAC(id, msg)
+	if err != nil {
+		return false, err
+	}
+	return subtle.ConstantTimeCompare(expected[:len(mac)], mac) == 1, nil
+}
+
+// useKey returns the key with the given id, if it can be used for
+// encryption/decryption(mac=false) or MAC generation/verification(mac=true).
+func (s *State) useKey(id she.KeyID, mac bool) ([]byte, error) {
+	p, err := she.LookupProfile(s.Profile)
+	if err != nil {
+		return nil, ERC_GENERAL_ERROR
+	}
+	if !p.IsValid(id) {
+		return nil, ERC_KEY_INVALID
+	}
+	slot := s.Slots[id]
+	switch id {
+	case she.BOOT_MAC_KEY:
+		if !mac {
+			return nil, ERC_KEY_INVALID
+		}
+	case
+		she.KEY_1,
+		she.KEY_2,
+		she.KEY_3,
+		she.KEY_4,
+		she.KEY_5,
+		she.KEY_6,
+		she.KEY_7,
+		she.KEY_8,
+		she.KEY_9,
+		she.KEY_10,
+		she.KEY_11,
+		she.KEY_12,
+		she.KEY_13,
+		she.KEY_14,
+		she.KEY_15,
+		she.KEY_16,
+		she.KEY_17,
+		she.KEY_18,
+		she.KEY_19,
+		she.KEY_20:
+
+		if !slot.IsEmpty() && slot.Flags.KeyUsage != mac {
+			return nil, ERC_KEY_INVALID
+		}
+	case she.RAM_KEY:
+	default:
+		return nil, ERC_KEY_INVALID
+	}
+
+	if slot.IsEmpty() {
+		return nil, ERC_KEY_EMPTY
+	}
+	if !s.isAvailable(slot) {
+		return nil, ERC_KEY_NOT_AVAILABLE
+	}
+
+	key, err := decodeKey(slot.Key)
+	if err != nil {
+		return nil, ERC_MEMORY_FAILURE
+	}
+	return key, nil
+}
+
+// isAvailable checks that the key is not locked by the boot or debugger protection.
+func (s *State) isAvailable(slot Slot) bool {
+	if slot.Flags.Boot && !s.Status.BootOK {
+		return false
+	}
+	if slot.Flags.Debugger && s.Status.ExtDebugger {
+		return false
+	}
+	return true
+}
+
+// InitRNG implements CMD_INIT_RNG: the non-volatile seed is updated and the
+// PRNG state is initialized from it.
+func (s *State) InitRNG() error {
+	secretKey, err := s.secretKey()
+	if err != nil {
+		return err
+	}
+	seedKey, err := she.KDF(secretKey, she.PRNG_SEED_KEY_C[:])
+	if err != nil {
+		return ERC_GENERAL_ERROR
+	}
+	seed, err := hex.DecodeString(s.PRNGSeed)
+	if err != nil || len(seed) != aes.BlockSize {
+		return ERC_MEMORY_FAILURE
+	}
+	block, err := aes.NewCipher(seedKey)
+	if err != nil {
+		return ERC_GENERAL_ERROR
+	}
+	block.Encrypt(seed, seed)
+
+	s.PRNGSeed = hex.EncodeToString(seed)
+	s.PRNGState = s.PRNGSeed
+	s.Status.RndInit = true
+
+	return nil
+}
+
+// Rnd implements CMD_RND: 16 random bytes are returned.
+func (s *State) Rnd() ([]byte, error) {
+	if !s.Status.RndInit {
+		return nil, ERC_RNG_SEED
+	}
+	secretKey, err := s.secretKey()
+	if err != nil {
+		return nil, err
+	}
+	prngKey, err := she.KDF(secretKey, she.PRNG_KEY_C[:])
+	if err != nil {
+		return nil, ERC_GENERAL_ERROR
+	}
+	state, err := hex.DecodeString(s.PRNGState)
+	if err != nil || len(state) != aes.BlockSize {
+		return nil, ERC_MEMORY_FAILURE
+	}
+	block, err := aes.NewCipher(prngKey)
+	if err != nil {
+		return nil, ERC_GENERAL_ERROR
+	}
+	block.Encrypt(state, state)
+
+	s.PRNGState = hex.EncodeToString(state)
+
+	return state, nil
+}
+
+func (s *State) secretKey() ([]byte, error) {
+	slot := s.Slots[she.SECRET_KEY]
+	if slot.IsEmpty() {
+		return nil, ERC_KEY_EMPTY
+	}
+	key, err := decodeKey(slot.Key)
+	if err != nil {
+		return nil, ERC_MEMORY_FAILURE
+	}
+	return key, nil
+}
+
+// SecureBoot performs the secure boot over the given bootloader image.
+// If BOOT_MAC_KEY is empty, the secure boot is not performed.
+// If BOOT_MAC is empty, the autonomous bootstrap stores the computed BOOT_MAC.
+// Otherwise, the BOOT_OK status is set if the computed MAC matches BOOT_MAC.
+func (s *State) SecureBoot(image []byte) error {
+	if s.Status.BootFinished {
+		return ERC_SEQUENCE_ERROR
+	}
+
+	s.Status.BootFinished = true
+	s.Status.BootOK = false
+
+	macKeySlot := s.Slots[she.BOOT_MAC_KEY]
+	if macKeySlot.IsEmpty() {
+		return ERC_NO_SECURE_BOOT
+	}
+	key, err := decodeKey(macKeySlot.Key)
+	if err != nil {
+		return ERC_MEMORY_FAILURE
+	}
+
+	mac, err := she.BootMAC(key, image)
+	if err != nil {
+		return ERC_GENERAL_ERROR
+	}
+
+	s.Status.SecureBoot = true
+
+	macSlot := &s.Slots[she.BOOT_MAC]
+	if macSlot.IsEmpty() {
+		macSlot.Key = hex.EncodeToString(mac)
+		s.Status.BootInit = true
+		return nil
+	}
+
+	expected, err := decodeKey(macSlot.Key)
+	if err != nil {
+		return ERC_MEMORY_FAILURE
+	}
+	s.Status.BootOK = subtle.ConstantTimeCompare(expected, mac) == 1
+
+	return nil
+}
+
+// Debug implements the first step of CMD_DEBUG: a random challenge
+// is returned, it must be answered with DebugAuthorize.
+func (s *State) Debug() ([]byte, error) {
+	challenge, err := s.Rnd()
+	if err != nil {
+		return nil, err
+	}
+	s.Challenge = hex.EncodeToString(challenge)
+	return challenge, nil
+}
+
+// DebugAuthorize implements the second step of CMD_DEBUG: if auth is the
+// expected response to the challenge, all the keys except SECRET_KEY are erased.
+// The erase is refused if any key is write-protected.
+func (s *State) DebugAuthorize(auth []byte) error {
+	if s.Challenge == "" {
+		return ERC_SEQUENCE_ERROR
+	}
+	challenge, err := hex.DecodeString(s.Challenge)
+	if err != nil {
+		return ERC_MEMORY_FAILURE
+	}
+	// the challenge can be used only once
+	s.Challenge = ""
+
+	for _, slot := range s.Slots {
+		if !slot.IsEmpty() && slot.Flags.Write {
+			return ERC_KEY_WRITE_PROTECTED
+		}
+	}
+
+	masterSlot := s.Slots[she.MASTER_ECU_KEY]
+	if masterSlot.IsEmpty() {
+		return ERC_KEY_EMPTY
+	}
+	masterKey, err := decodeKey(masterSlot.Key)
+	if err != nil {
+		return ERC_MEMORY_FAILURE
+	}
+	uid, err := hex.DecodeString(s.UID)
+	if err != nil {
+		return ERC_MEMORY_FAILURE
+	}
+
+	expected, err := she.DebugAuthorization(masterKey, challenge, uid)
+	if err != nil {
+		return ERC_GENERAL_ERROR
+	}
+	if subtle.ConstantTimeCompare(expected, auth) != 1 {
+		return ERC_NO_DEBUGGING
+	}
+
+	for id := range s.Slots {
+		if she.KeyID(id) != she.SECRET_KEY {
+			s.Slots[id] = Slot{}
+		}
+	}
+	s.PlainRAMKey = false
+
+	return nil
+}
+
+func isWildcard(uid []byte) bool {
+	for _, v := range uid {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeKey(s string) ([]byte, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 16 {
+		return nil, fmt.Errorf("invalid key size: %d", len(key))
+	}
+	return key, nil
+}
@@ -0,0 +1,640 @@
+package emu
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+const (
+	testUID       = "000000000000000000000000000001"
+	testMasterKey = "000102030405060708090a0b0c0d0e0f"
+	testNewKey    = "0f0e0d0c0b0a09080706050403020100"
+)
+
+func newTestState(t *testing.T) *State {
+	s, err := New(
+		testutil.BytesFromHex(t, testUID),
+		testutil.BytesFromHex(t, "101112131415161718191a1b1c1d1e1f"),
+		bytes.NewReader(make([]byte, 16)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Slots[she.MASTER_ECU_KEY].Key = testMasterKey
+	return s
+}
+
+func loadKey(t *testing.T, s *State, in mup.Input) ([]byte, error) {
+	t.Helper()
+	ms, err := in.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2, m3, _, _ := mup.SliceMs(ms)
+	m4, m5, err := s.LoadKey(m1, m2, m3)
+	if err != nil {
+		return nil, err
+	}
+	return append(m4, m5...), nil
+}
+
+func expectErrorCode(t *testing.T, err error, want ErrorCode) {
+	t.Helper()
+	var have ErrorCode
+	if !errors.As(err, &have) {
+		t.Fatalf("want %s, have %v", want, err)
+	}
+	if have != want {
+		t.Fatalf("want %s, have %s", want, have)
+	}
+}
+
+func key1Input() mup.Input {
+	return mup.Input{
+		UID:     testUID,
+		AuthID:  she.MASTER_ECU_KEY,
+		ID:      she.KEY_1,
+		AuthKey: testMasterKey,
+		NewKey:  testNewKey,
+		Counter: 1,
+	}
+}
+
+func TestNew(t *testing.T) {
+	secretKey := make([]byte, 16)
+	random := bytes.NewReader(make([]byte, 16))
+	if _, err := New(make([]byte, 14), secretKey, random); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := New(make([]byte, 15), secretKey, random); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := New(testutil.BytesFromHex(t, testUID), secretKey[:15], random); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := New(testutil.BytesFromHex(t, testUID), secretKey, bytes.NewReader(nil)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestLoadKey(t *testing.T) {
+	t.Run("Ok", func(t *testing.T) {
+		s := newTestState(t)
+		m4m5, err := loadKey(t, s, key1Input())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := testutil.BytesFromHex(t,
+			"00000000000000000000000000000141b472e8d8727d70d57295e74849a27917"+
+				"820d8d95dc11b4668878160cb2a4e23e",
+		)
+		if !bytes.Equal(m4m5, expected) {
+			t.Log("want", hex.EncodeToString(expected))
+			t.Log("have", hex.EncodeToString(m4m5))
+			t.Fatal("m4m5")
+		}
+		slot := s.Slots[she.KEY_1]
+		if slot.Key != testNewKey || slot.Counter != 1 {
+			t.Fatal("key not updated:", slot)
+		}
+	})
+
+	t.Run("CounterNotIncreased", func(t *testing.T) {
+		s := newTestState(t)
+		if _, err := loadKey(t, s, key1Input()); err != nil {
+			t.Fatal(err)
+		}
+		_, err := loadKey(t, s, key1Input())
+		expectErrorCode(t, err, ERC_KEY_UPDATE_ERROR)
+
+		in := key1Input()
+		in.Counter = 2
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("UpdateWithItself", func(t *testing.T) {
+		s := newTestState(t)
+		if _, err := loadKey(t, s, key1Input()); err != nil {
+			t.Fatal(err)
+		}
+		in := key1Input()
+		in.AuthID = she.KEY_1
+		in.AuthKey = testNewKey
+		in.NewKey = testMasterKey
+		in.Counter = 2
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("WrongUID", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.UID = "000000000000000000000000000002"
+		_, err := loadKey(t, s, in)
+		expectErrorCode(t, err, ERC_KEY_UPDATE_ERROR)
+	})
+
+	t.Run("WrongAuthKey", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.AuthKey = testNewKey
+		_, err := loadKey(t, s, in)
+		expectErrorCode(t, err, ERC_KEY_UPDATE_ERROR)
+	})
+
+	t.Run("EmptyAuthKey", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.AuthID = she.KEY_1
+		_, err := loadKey(t, s, in)
+		expectErrorCode(t, err, ERC_KEY_EMPTY)
+	})
+
+	t.Run("NotCompatible", func(t *testing.T) {
+		s := newTestState(t)
+		ms, err := key1Input().Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, m2, m3, _, _ := mup.SliceMs(ms)
+		m1[15] = uint8(she.BOOT_MAC_KEY)<<4 | uint8(she.MASTER_ECU_KEY)
+		_, _, err = s.LoadKey(m1, m2, m3)
+		expectErrorCode(t, err, ERC_KEY_INVALID)
+	})
+
+	t.Run("Wildcard", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.UID = "000000000000000000000000000000"
+		in.Flags.Wildcard = true
+		m4m5, err := loadKey(t, s, in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// M4 contains the real UID
+		r, err := mup.VerifyResponse(m4m5, testutil.BytesFromHex(t, testNewKey))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.UID != testUID {
+			t.Fatal("unexpected UID", r.UID)
+		}
+
+		// the key is now protected against wildcard updates
+		in.Counter = 2
+		_, err = loadKey(t, s, in)
+		expectErrorCode(t, err, ERC_KEY_UPDATE_ERROR)
+
+		in.UID = testUID
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("WriteProtected", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.Flags.Write = true
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+		in.Counter = 2
+		_, err := loadKey(t, s, in)
+		expectErrorCode(t, err, ERC_KEY_WRITE_PROTECTED)
+	})
+
+	t.Run("DebuggerProtectedAuthKey", func(t *testing.T) {
+		s := newTestState(t)
+		s.Slots[she.MASTER_ECU_KEY].Flags.Debugger = true
+		s.SetDebugger(true)
+		_, err := loadKey(t, s, key1Input())
+		expectErrorCode(t, err, ERC_KEY_NOT_AVAILABLE)
+		s.SetDebugger(false)
+		if _, err := loadKey(t, s, key1Input()); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("RAM_KEY", func(t *testing.T) {
+		s := newTestState(t)
+		if _, err := loadKey(t, s, key1Input()); err != nil {
+			t.Fatal(err)
+		}
+		in := mup.Input{
+			UID:     testUID,
+			AuthID:  she.KEY_1,
+			ID:      she.RAM_KEY,
+			AuthKey: testNewKey,
+			NewKey:  testMasterKey,
+		}
+		// the counter of the RAM_KEY is not checked
+		for i := 0; i < 2; i++ {
+			if _, err := loadKey(t, s, in); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if s.PlainRAMKey {
+			t.Fatal("RAM_KEY is not plain")
+		}
+		s.Reset()
+		if !s.Slots[she.RAM_KEY].IsEmpty() {
+			t.Fatal("RAM_KEY not cleared")
+		}
+	})
+
+	t.Run("InvalidLength", func(t *testing.T) {
+		s := newTestState(t)
+		_, _, err := s.LoadKey(make([]byte, 15), make([]byte, 32), make([]byte, 16))
+		expectErrorCode(t, err, ERC_GENERAL_ERROR)
+	})
+}
+
+func TestLoadKeyProfile(t *testing.T) {
+	in := key1Input()
+	in.ID = she.KEY_11
+	in.Profile = "csec"
+	ms, err := in.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m1, m2, m3, _, _ := mup.SliceMs(ms)
+
+	t.Run("Ok", func(t *testing.T) {
+		s := newTestState(t)
+		s.Profile = "csec"
+		m4, m5, err := s.LoadKeyBank(m1, m2, m3, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if slot := s.Slots[she.KEY_11]; slot.Key != testNewKey {
+			t.Fatal("key not updated:", slot)
+		}
+		if !s.Slots[she.KEY_1].IsEmpty() {
+			t.Fatal("KEY_1 updated")
+		}
+		r, err := mup.VerifyResponseProfile(append(m4, m5...), testutil.BytesFromHex(t, testNewKey), she.ProfileCSEc, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != she.KEY_11 {
+			t.Fatal("M4 ID:", r.ID)
+		}
+		if _, err := s.useKey(she.KEY_11, false); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("NoExtendedKeys", func(t *testing.T) {
+		s := newTestState(t)
+		_, _, err := s.LoadKeyBank(m1, m2, m3, true)
+		expectErrorCode(t, err, ERC_KEY_INVALID)
+		_, err = s.useKey(she.KEY_11, false)
+		expectErrorCode(t, err, ERC_KEY_INVALID)
+	})
+}
+
+func TestCipher(t *testing.T) {
+	key := testutil.BytesFromHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+	iv := testutil.BytesFromHex(t, "000102030405060708090a0b0c0d0e0f")
+	plaintext := testutil.BytesFromHex(t, "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51")
+
+	t.Run("ECB", func(t *testing.T) {
+		s := newTestState(t)
+		if err := s.LoadPlainKey(key); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := s.EncryptECB(she.RAM_KEY, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := testutil.BytesFromHex(t, "3ad77bb40d7a3660a89ecaf32466ef97f5d3d58503b9699de785895a96fdbaaf")
+		if !bytes.Equal(ciphertext, expected) {
+			t.Fatal("have", hex.EncodeToString(ciphertext))
+		}
+		decrypted, err := s.DecryptECB(she.RAM_KEY, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatal("have", hex.EncodeToString(decrypted))
+		}
+	})
+
+	t.Run("CBC", func(t *testing.T) {
+		s := newTestState(t)
+		if err := s.LoadPlainKey(key); err != nil {
+			t.Fatal(err)
+		}
+		ciphertext, err := s.EncryptCBC(she.RAM_KEY, iv, plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := testutil.BytesFromHex(t, "7649abac8119b246cee98e9b12e9197d5086cb9b507219ee95db113a917678b2")
+		if !bytes.Equal(ciphertext, expected) {
+			t.Fatal("have", hex.EncodeToString(ciphertext))
+		}
+		decrypted, err := s.DecryptCBC(she.RAM_KEY, iv, ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decrypted, plaintext) {
+			t.Fatal("have", hex.EncodeToString(decrypted))
+		}
+		_, err = s.EncryptCBC(she.RAM_KEY, iv[:15], plaintext)
+		expectErrorCode(t, err, ERC_GENERAL_ERROR)
+	})
+
+	t.Run("NotAligned", func(t *testing.T) {
+		s := newTestState(t)
+		if err := s.LoadPlainKey(key); err != nil {
+			t.Fatal(err)
+		}
+		_, err := s.EncryptECB(she.RAM_KEY, plaintext[:17])
+		expectErrorCode(t, err, ERC_GENERAL_ERROR)
+	})
+
+	t.Run("KeyUsage", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.Flags.KeyUsage = true
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+		_, err := s.EncryptECB(she.KEY_1, plaintext)
+		expectErrorCode(t, err, ERC_KEY_INVALID)
+		if _, err := s.GenerateMAC(she.KEY_1, plaintext); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("InvalidKeys", func(t *testing.T) {
+		s := newTestState(t)
+		for _, id := range []she.KeyID{she.SECRET_KEY, she.MASTER_ECU_KEY, she.BOOT_MAC_KEY, she.BOOT_MAC, she.KeyID(15)} {
+			_, err := s.EncryptECB(id, plaintext)
+			expectErrorCode(t, err, ERC_KEY_INVALID)
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		s := newTestState(t)
+		_, err := s.EncryptECB(she.KEY_2, plaintext)
+		expectErrorCode(t, err, ERC_KEY_EMPTY)
+		_, err = s.EncryptECB(she.RAM_KEY, plaintext)
+		expectErrorCode(t, err, ERC_KEY_EMPTY)
+	})
+}
+
+func TestMAC(t *testing.T) {
+	s := newTestState(t)
+	in := key1Input()
+	in.Flags.KeyUsage = true
+	if _, err := loadKey(t, s, in); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := []byte("message")
+	mac, err := s.GenerateMAC(she.KEY_1, msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := cmac.Generate(testutil.BytesFromHex(t, testNewKey), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(mac, expected) {
+		t.Fatal("have", hex.EncodeToString(mac))
+	}
+
+	for _, n := range []int{16, 8, 4} {
+		ok, err := s.VerifyMAC(she.KEY_1, msg, mac[:n])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatalf("%d bytes: expected valid MAC", n)
+		}
+	}
+
+	mac[0] ^= 1
+	ok, err := s.VerifyMAC(she.KEY_1, msg, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Fatal("expected invalid MAC")
+	}
+
+	_, err = s.VerifyMAC(she.KEY_1, msg, nil)
+	expectErrorCode(t, err, ERC_GENERAL_ERROR)
+}
+
+func TestRnd(t *testing.T) {
+	s := newTestState(t)
+	_, err := s.Rnd()
+	expectErrorCode(t, err, ERC_RNG_SEED)
+
+	if err := s.InitRNG(); err != nil {
+		t.Fatal(err)
+	}
+	r1, err := s.Rnd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := s.Rnd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r1) != aes.BlockSize || bytes.Equal(r1, r2) {
+		t.Fatal("unexpected random values", r1, r2)
+	}
+
+	// the seed is updated by every CMD_INIT_RNG
+	s.Reset()
+	_, err = s.Rnd()
+	expectErrorCode(t, err, ERC_RNG_SEED)
+	if err := s.InitRNG(); err != nil {
+		t.Fatal(err)
+	}
+	r3, err := s.Rnd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(r1, r3) {
+		t.Fatal("expected different values after a new seed")
+	}
+}
+
+func TestSecureBoot(t *testing.T) {
+	image := []byte("bootloader")
+	bootMACKey := testutil.BytesFromHex(t, "2b7e151628aed2a6abf7158809cf4f3c")
+
+	t.Run("NoBootMACKey", func(t *testing.T) {
+		s := newTestState(t)
+		expectErrorCode(t, s.SecureBoot(image), ERC_NO_SECURE_BOOT)
+		if !s.Status.BootFinished || s.Status.BootOK || s.Status.SecureBoot {
+			t.Fatal("unexpected status", s.Status)
+		}
+		expectErrorCode(t, s.SecureBoot(image), ERC_SEQUENCE_ERROR)
+	})
+
+	t.Run("Ok", func(t *testing.T) {
+		s := newTestState(t)
+		s.Slots[she.BOOT_MAC_KEY].Key = hex.EncodeToString(bootMACKey)
+
+		in := key1Input()
+		in.Flags.Boot = true
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+
+		// autonomous bootstrap
+		if err := s.SecureBoot(image); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Status.BootInit || s.Status.BootOK {
+			t.Fatal("unexpected status", s.Status)
+		}
+		mac, err := she.BootMAC(bootMACKey, image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Slots[she.BOOT_MAC].Key != hex.EncodeToString(mac) {
+			t.Fatal("BOOT_MAC not stored")
+		}
+		_, err = s.EncryptECB(she.KEY_1, make([]byte, 16))
+		expectErrorCode(t, err, ERC_KEY_NOT_AVAILABLE)
+
+		s.Reset()
+		if err := s.SecureBoot(image); err != nil {
+			t.Fatal(err)
+		}
+		if !s.Status.BootOK || s.Status.Encode() != 0b00011010 {
+			t.Fatalf("unexpected status %08b", s.Status.Encode())
+		}
+		if _, err := s.EncryptECB(she.KEY_1, make([]byte, 16)); err != nil {
+			t.Fatal(err)
+		}
+
+		s.Reset()
+		if err := s.SecureBoot([]byte("modified")); err != nil {
+			t.Fatal(err)
+		}
+		if s.Status.BootOK {
+			t.Fatal("unexpected BOOT_OK")
+		}
+		_, err = s.EncryptECB(she.KEY_1, make([]byte, 16))
+		expectErrorCode(t, err, ERC_KEY_NOT_AVAILABLE)
+	})
+}
+
+func TestSaveLoad(t *testing.T) {
+	s := newTestState(t)
+	if _, err := loadKey(t, s, key1Input()); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := s.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *loaded != *s {
+		t.Fatal("state changed after Save/Load")
+	}
+
+	for _, data := range []string{"", "{}", `{"UID":"000000000000000000000000000001","Slots":[{"Key":"00"}]}`} {
+		if _, err := Load(bytes.NewReader([]byte(data))); err == nil {
+			t.Fatalf("%q: expected error", data)
+		}
+	}
+}
+
+func TestDebug(t *testing.T) {
+	masterKey := testutil.BytesFromHex(t, testMasterKey)
+	uid := testutil.BytesFromHex(t, testUID)
+
+	t.Run("Ok", func(t *testing.T) {
+		s := newTestState(t)
+		if _, err := loadKey(t, s, key1Input()); err != nil {
+			t.Fatal(err)
+		}
+		expectErrorCode(t, s.DebugAuthorize(make([]byte, 16)), ERC_SEQUENCE_ERROR)
+
+		_, err := s.Debug()
+		expectErrorCode(t, err, ERC_RNG_SEED)
+
+		if err := s.InitRNG(); err != nil {
+			t.Fatal(err)
+		}
+
+		// wrong response, the challenge cannot be reused
+		challenge, err := s.Debug()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectErrorCode(t, s.DebugAuthorize(make([]byte, 16)), ERC_NO_DEBUGGING)
+		auth, err := she.DebugAuthorization(masterKey, challenge, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectErrorCode(t, s.DebugAuthorize(auth), ERC_SEQUENCE_ERROR)
+
+		challenge, err = s.Debug()
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err = she.DebugAuthorization(masterKey, challenge, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.DebugAuthorize(auth); err != nil {
+			t.Fatal(err)
+		}
+		for i, slot := range s.Slots {
+			if she.KeyID(i) == she.SECRET_KEY {
+				if slot.IsEmpty() {
+					t.Fatal("SECRET_KEY erased")
+				}
+				continue
+			}
+			if !slot.IsEmpty() {
+				t.Fatalf("%s not erased", she.KeyID(i))
+			}
+		}
+	})
+
+	t.Run("WriteProtected", func(t *testing.T) {
+		s := newTestState(t)
+		in := key1Input()
+		in.Flags.Write = true
+		if _, err := loadKey(t, s, in); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.InitRNG(); err != nil {
+			t.Fatal(err)
+		}
+		challenge, err := s.Debug()
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth, err := she.DebugAuthorization(masterKey, challenge, uid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectErrorCode(t, s.DebugAuthorize(auth), ERC_KEY_WRITE_PROTECTED)
+	})
+}
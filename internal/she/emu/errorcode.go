@@ -0,0 +1,26 @@
+package emu
+
+//go:generate stringer -type=ErrorCode
+
+// ErrorCode is the result of a SHE command, as defined by the specification.
+type ErrorCode uint8
+
+const (
+	ERC_NO_ERROR ErrorCode = iota
+	ERC_SEQUENCE_ERROR
+	ERC_KEY_NOT_AVAILABLE
+	ERC_KEY_INVALID
+	ERC_KEY_EMPTY
+	ERC_NO_SECURE_BOOT
+	ERC_KEY_WRITE_PROTECTED
+	ERC_KEY_UPDATE_ERROR
+	ERC_RNG_SEED
+	ERC_NO_DEBUGGING
+	ERC_BUSY
+	ERC_MEMORY_FAILURE
+	ERC_GENERAL_ERROR
+)
+
+func (e ErrorCode) Error() string {
+	return e.String()
+}
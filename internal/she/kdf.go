@@ -0,0 +1,85 @@
+package she
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+	"bandr.me/p/pocryp/internal/aes/mp"
+	"bandr.me/p/pocryp/internal/secret"
+)
+
+// Key derivation constants of the SHE specification, arrays so that they
+// are copied and cannot be modified through a slice given to a caller.
+var (
+	KEY_UPDATE_ENC_C = kdfConstant(0x01)
+	KEY_UPDATE_MAC_C = kdfConstant(0x02)
+	DEBUG_KEY_C      = kdfConstant(0x03)
+	PRNG_KEY_C       = kdfConstant(0x04)
+	PRNG_SEED_KEY_C  = kdfConstant(0x05)
+	PRNG_EXTENSION_C = kdfConstant(0x06)
+)
+
+// KDFConstants contains the key derivation constants by name.
+var KDFConstants = map[string][16]byte{
+	"KEY_UPDATE_ENC_C": KEY_UPDATE_ENC_C,
+	"KEY_UPDATE_MAC_C": KEY_UPDATE_MAC_C,
+	"DEBUG_KEY_C":      DEBUG_KEY_C,
+	"PRNG_KEY_C":       PRNG_KEY_C,
+	"PRNG_SEED_KEY_C":  PRNG_SEED_KEY_C,
+	"PRNG_EXTENSION_C": PRNG_EXTENSION_C,
+}
+
+// 0x01 || n || "SHE" || 0x00 || 0x80 || 0...0 || 0xb0
+func kdfConstant(n byte) [16]byte {
+	return [16]byte{0x01, n, 'S', 'H', 'E', 0x00, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0xb0}
+}
+
+// KDF derives a key from key and constant, using the Miyaguchi-Preneel
+// compression function: KDF(K, C) = AES-MP(K || C).
+// The key and the constant are 16 bytes, like the keys of a SHE module.
+func KDF(key, constant []byte) ([]byte, error) {
+	if len(key) != 16 {
+		return nil, fmt.Errorf("key expected length is 16 bytes, have %d bytes", len(key))
+	}
+	if len(constant) != 16 {
+		return nil, fmt.Errorf("constant expected length is 16 bytes, have %d bytes", len(constant))
+	}
+	return mp.Compress(key, constant)
+}
+
+// ParseKDFConstant returns the constant with the given name(e.g. DEBUG_KEY_C)
+// or the constant given as hex(16 bytes).
+func ParseKDFConstant(s string) ([]byte, error) {
+	if c, ok := KDFConstants[s]; ok {
+		return c[:], nil
+	}
+	c, err := hex.DecodeString(s)
+	if err != nil || len(c) != 16 {
+		return nil, fmt.Errorf("invalid constant %q, expected a name or 16 bytes as hex", s)
+	}
+	return c, nil
+}
+
+// DebugAuthorization computes the response to the challenge of CMD_DEBUG:
+// CMAC(KDF(MASTER_ECU_KEY, DEBUG_KEY_C), CHALLENGE || UID).
+func DebugAuthorization(masterKey, challenge, uid []byte) ([]byte, error) {
+	if len(challenge) != 16 {
+		return nil, fmt.Errorf("challenge expected length is 16 bytes, have %d bytes", len(challenge))
+	}
+	if len(uid) != 15 {
+		return nil, fmt.Errorf("UID expected length is 15 bytes, have %d bytes", len(uid))
+	}
+	if len(masterKey) != 16 {
+		return nil, fmt.Errorf("MASTER_ECU_KEY expected length is 16 bytes, have %d bytes", len(masterKey))
+	}
+	key, err := KDF(masterKey, DEBUG_KEY_C[:])
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(key)
+	msg := make([]byte, 0, len(challenge)+len(uid))
+	msg = append(msg, challenge...)
+	msg = append(msg, uid...)
+	return cmac.Generate(key, msg)
+}
@@ -0,0 +1,113 @@
+package she
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/aes/cmac"
+	"bandr.me/p/pocryp/internal/testutil"
+)
+
+func TestKDF(t *testing.T) {
+	key := testutil.BytesFromHex(t, "000102030405060708090a0b0c0d0e0f")
+
+	tests := []struct {
+		name     string
+		constant [16]byte
+		expected string
+	}{
+		{"KEY_UPDATE_ENC_C", KEY_UPDATE_ENC_C, "118a46447a770d87828a69c222e2d17e"},
+		{"KEY_UPDATE_MAC_C", KEY_UPDATE_MAC_C, "2ebb2a3da62dbd64b18ba6493e9fbe22"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := KDF(key, tt.constant[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hex.EncodeToString(k) != tt.expected {
+				t.Fatal("have", hex.EncodeToString(k))
+			}
+		})
+	}
+}
+
+func TestKDFLength(t *testing.T) {
+	key := make([]byte, 16)
+	for _, tt := range []struct {
+		key, constant []byte
+	}{
+		{make([]byte, 48), DEBUG_KEY_C[:]},
+		{make([]byte, 15), DEBUG_KEY_C[:]},
+		{key, make([]byte, 32)},
+		{key, nil},
+	} {
+		if _, err := KDF(tt.key, tt.constant); err == nil {
+			t.Fatalf("key %d bytes, constant %d bytes: expected error", len(tt.key), len(tt.constant))
+		}
+	}
+}
+
+func TestParseKDFConstant(t *testing.T) {
+	for name, c := range KDFConstants {
+		have, err := ParseKDFConstant(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, c[:]) {
+			t.Fatal(name)
+		}
+		// the result is a copy
+		have[0] ^= 0xff
+		if KDFConstants[name][0] != c[0] {
+			t.Fatal(name, "modified")
+		}
+	}
+
+	have, err := ParseKDFConstant("010353484500800000000000000000b0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, DEBUG_KEY_C[:]) {
+		t.Fatal("have", hex.EncodeToString(have))
+	}
+
+	for _, s := range []string{"", "FOO_C", "0103", "zz", "010353484500800000000000000000b0010353484500800000000000000000b0"} {
+		if _, err := ParseKDFConstant(s); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+}
+
+func TestDebugAuthorization(t *testing.T) {
+	masterKey := testutil.BytesFromHex(t, "000102030405060708090a0b0c0d0e0f")
+	challenge := testutil.BytesFromHex(t, "00112233445566778899aabbccddeeff")
+	uid := testutil.BytesFromHex(t, "000000000000000000000000000001")
+
+	auth, err := DebugAuthorization(masterKey, challenge, uid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	debugKey, err := KDF(masterKey, DEBUG_KEY_C[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cmac.Verify(debugKey, append(append([]byte{}, challenge...), uid...), auth) {
+		t.Fatal("unexpected authorization", hex.EncodeToString(auth))
+	}
+
+	if _, err := DebugAuthorization(masterKey, challenge[:15], uid); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := DebugAuthorization(masterKey, challenge, uid[:14]); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := DebugAuthorization(masterKey[:15], challenge, uid); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := DebugAuthorization(append(masterKey, masterKey...), challenge, uid); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -2,6 +2,7 @@ package she
 
 import (
 	"fmt"
+	"strconv"
 )
 
 //go:generate stringer -type=KeyID
@@ -25,8 +26,46 @@ const (
 	RAM_KEY
 )
 
+// Extended key slots of the key bank 1, available only with some device
+// profiles, see Profile.
+const (
+	KEY_11 KeyID = KeyBank1 | (iota + 4)
+	KEY_12
+	KEY_13
+	KEY_14
+	KEY_15
+	KEY_16
+	KEY_17
+	KEY_18
+	KEY_19
+	KEY_20
+)
+
+// KeyBank1 is the key bank bit of the extended key IDs.
+const KeyBank1 KeyID = 0x10
+
+// IsValid returns true for the key IDs defined by the SHE specification.
 func (id KeyID) IsValid() bool {
-	return id < KeyID(len(_KeyID_index)-1)
+	return id <= RAM_KEY
+}
+
+// ParseKeyID returns the KeyID with the given name(e.g. KEY_1) or number,
+// the extended key IDs are accepted too.
+func ParseKeyID(s string) (KeyID, error) {
+	for i := KeyID(0); i <= KEY_20; i++ {
+		if i.isKnown() && i.String() == s {
+			return i, nil
+		}
+	}
+	v, err := strconv.ParseUint(s, 0, 8)
+	if err != nil || !KeyID(v).isKnown() {
+		return 0, fmt.Errorf("invalid key ID %q", s)
+	}
+	return KeyID(v), nil
+}
+
+func (id KeyID) isKnown() bool {
+	return id.IsValid() || (id >= KEY_11 && id <= KEY_20)
 }
 
 func (id KeyID) IsCompatible(other KeyID) error {
@@ -23,15 +23,36 @@ func _() {
 	_ = x[KEY_9-12]
 	_ = x[KEY_10-13]
 	_ = x[RAM_KEY-14]
+	_ = x[KEY_11-20]
+	_ = x[KEY_12-21]
+	_ = x[KEY_13-22]
+	_ = x[KEY_14-23]
+	_ = x[KEY_15-24]
+	_ = x[KEY_16-25]
+	_ = x[KEY_17-26]
+	_ = x[KEY_18-27]
+	_ = x[KEY_19-28]
+	_ = x[KEY_20-29]
 }
 
-const _KeyID_name = "SECRET_KEYMASTER_ECU_KEYBOOT_MAC_KEYBOOT_MACKEY_1KEY_2KEY_3KEY_4KEY_5KEY_6KEY_7KEY_8KEY_9KEY_10RAM_KEY"
+const (
+	_KeyID_name_0 = "SECRET_KEYMASTER_ECU_KEYBOOT_MAC_KEYBOOT_MACKEY_1KEY_2KEY_3KEY_4KEY_5KEY_6KEY_7KEY_8KEY_9KEY_10RAM_KEY"
+	_KeyID_name_1 = "KEY_11KEY_12KEY_13KEY_14KEY_15KEY_16KEY_17KEY_18KEY_19KEY_20"
+)
 
-var _KeyID_index = [...]uint8{0, 10, 24, 36, 44, 49, 54, 59, 64, 69, 74, 79, 84, 89, 95, 102}
+var (
+	_KeyID_index_0 = [...]uint8{0, 10, 24, 36, 44, 49, 54, 59, 64, 69, 74, 79, 84, 89, 95, 102}
+	_KeyID_index_1 = [...]uint8{0, 6, 12, 18, 24, 30, 36, 42, 48, 54, 60}
+)
 
 func (i KeyID) String() string {
-	if i >= KeyID(len(_KeyID_index)-1) {
+	switch {
+	case i <= 14:
+		return _KeyID_name_0[_KeyID_index_0[i]:_KeyID_index_0[i+1]]
+	case 20 <= i && i <= 29:
+		i -= 20
+		return _KeyID_name_1[_KeyID_index_1[i]:_KeyID_index_1[i+1]]
+	default:
 		return "KeyID(" + strconv.FormatInt(int64(i), 10) + ")"
 	}
-	return _KeyID_name[_KeyID_index[i]:_KeyID_index[i+1]]
 }
@@ -146,3 +146,38 @@ func TestIsCompatible(t *testing.T) {
 	})
 
 }
+
+func TestParseKeyID(t *testing.T) {
+	tests := []struct {
+		s  string
+		id KeyID
+	}{
+		{"SECRET_KEY", SECRET_KEY},
+		{"KEY_1", KEY_1},
+		{"KEY_10", KEY_10},
+		{"RAM_KEY", RAM_KEY},
+		{"4", KEY_1},
+		{"0xe", RAM_KEY},
+		{"KEY_11", KEY_11},
+		{"0x1d", KEY_20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			id, err := ParseKeyID(tt.s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id {
+				t.Fatalf("want %s, have %s", tt.id, id)
+			}
+		})
+	}
+
+	for _, s := range []string{"", "KEY_21", "15", "0x13", "0x1e", "key_1", "-1", "KeyID(15)"} {
+		t.Run("Invalid"+s, func(t *testing.T) {
+			if _, err := ParseKeyID(s); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+// Package ledger keeps track of the memory updates issued for SHE modules.
+//
+// A SHE module rejects an update with a counter that is not greater than
+// the counter of its key slot, and an update with the wildcard UID is applied
+// to every module whose key slot is not wildcard protected. The ledger records
+// the updates that were issued, so they can be checked before a new one is
+// issued.
+package ledger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+)
+
+// ErrWildcard is returned by Check for the wildcard UID, if not allowed.
+var ErrWildcard = errors.New("wildcard UID is not allowed")
+
+// Entry is an issued memory update.
+type Entry struct {
+	Time time.Time
+
+	mup.Record
+
+	// protection flags of the key slot after the update
+	Flags mup.ProtectionFlags
+}
+
+// Ledger contains the issued memory updates, in the order they were issued.
+type Ledger struct {
+	Entries []Entry
+}
+
+// Load reads a ledger saved with Save.
+func Load(r io.Reader) (*Ledger, error) {
+	var l Ledger
+	if err := json.NewDecoder(r).Decode(&l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// Save writes the ledger as JSON.
+func (l *Ledger) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
+
+// wildcardKey is the key of the wildcard UID in the map returned by slots.
+const wildcardKey = "*"
+
+// slot is the known state of a key slot of one module.
+type slot struct {
+	uid     string
+	counter uint32
+	flags   mup.ProtectionFlags
+}
+
+// slots returns the known state of the key slot id of every module,
+// the wildcard updates are applied to the modules seen before them which
+// accept them and are kept with the wildcard UID for the modules seen after
+// them.
+func (l *Ledger) slots(id she.KeyID) map[string]*slot {
+	slots := make(map[string]*slot)
+	for _, e := range l.Entries {
+		if e.ID != id {
+			continue
+		}
+		uid := strings.ToLower(e.UID)
+		if (mup.Input{UID: uid}).IsWildcard() {
+			uid = wildcardKey
+			for _, s := range slots {
+				// the module rejects the update
+				if s.flags.Write || s.flags.Wildcard || (id != she.RAM_KEY && e.Counter <= s.counter) {
+					continue
+				}
+				s.counter = e.Counter
+				s.flags = e.Flags
+			}
+		}
+		slots[uid] = &slot{uid: e.UID, counter: e.Counter, flags: e.Flags}
+	}
+	return slots
+}
+
+// Check returns an error if the module would reject the update in,
+// or if in uses the wildcard UID and allowWildcard is false.
+//
+// For the wildcard UID, the update is checked against the key slot of every
+// module in the ledger.
+func (l *Ledger) Check(in mup.Input, allowWildcard bool) error {
+	wildcard := in.IsWildcard()
+	if wildcard && !allowWildcard {
+		return ErrWildcard
+	}
+
+	slots := l.slots(in.ID)
+
+	var targets []*slot
+	if wildcard {
+		for _, s := range slots {
+			targets = append(targets, s)
+		}
+		sort.Slice(targets, func(i, j int) bool {
+			return targets[i].uid < targets[j].uid
+		})
+	} else {
+		s, ok := slots[strings.ToLower(in.UID)]
+		if !ok {
+			// a module not seen before, updated only with the wildcard UID
+			s, ok = slots[wildcardKey]
+		}
+		if ok {
+			targets = append(targets, s)
+		}
+	}
+
+	var errs []error
+	for _, s := range targets {
+		if s.flags.Write {
+			errs = append(errs, fmt.Errorf("%s of UID %s is write protected", in.ID, s.uid))
+		}
+		if wildcard && s.flags.Wildcard {
+			errs = append(errs, fmt.Errorf("%s of UID %s is wildcard protected", in.ID, s.uid))
+		}
+		// the counter of RAM_KEY is not checked by the module
+		if in.ID != she.RAM_KEY && in.Counter <= s.counter {
+			errs = append(errs, fmt.Errorf(
+				"counter %d of %s for UID %s is not greater than the issued one(%d)",
+				in.Counter, in.ID, s.uid, s.counter,
+			))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Add records the issued update in, r is its encoded form.
+func (l *Ledger) Add(in mup.Input, r mup.Record) {
+	l.Entries = append(l.Entries, Entry{
+		Time:   time.Now().UTC(),
+		Record: r,
+		Flags:  in.Flags,
+	})
+}
@@ -0,0 +1,142 @@
+package ledger
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/she"
+	"bandr.me/p/pocryp/internal/she/mup"
+)
+
+const (
+	uid1     = "000000000000000000000000000001"
+	uid2     = "000000000000000000000000000002"
+	wildcard = "000000000000000000000000000000"
+)
+
+func input(uid string, id she.KeyID, counter uint32, flags mup.ProtectionFlags) mup.Input {
+	return mup.Input{
+		UID:     uid,
+		AuthID:  she.MASTER_ECU_KEY,
+		AuthKey: "000102030405060708090a0b0c0d0e0f",
+		ID:      id,
+		NewKey:  "0f0e0d0c0b0a09080706050403020100",
+		Counter: counter,
+		Flags:   flags,
+	}
+}
+
+func issue(t *testing.T, l *Ledger, in mup.Input) {
+	t.Helper()
+	if err := l.Check(in, true); err != nil {
+		t.Fatal(err)
+	}
+	result, err := in.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(in, in.Record(result))
+}
+
+func TestCheck(t *testing.T) {
+	var l Ledger
+	issue(t, &l, input(uid1, she.KEY_1, 1, mup.ProtectionFlags{}))
+	issue(t, &l, input(uid2, she.KEY_1, 5, mup.ProtectionFlags{Wildcard: true}))
+	issue(t, &l, input(uid1, she.KEY_2, 1, mup.ProtectionFlags{Write: true}))
+
+	tests := []struct {
+		name  string
+		in    mup.Input
+		valid bool
+	}{
+		{"Increasing", input(uid1, she.KEY_1, 2, mup.ProtectionFlags{}), true},
+		{"SameCounter", input(uid1, she.KEY_1, 1, mup.ProtectionFlags{}), false},
+		{"UIDCase", input("00000000000000000000000000000A", she.KEY_1, 1, mup.ProtectionFlags{}), true},
+		{"OtherSlot", input(uid1, she.KEY_3, 1, mup.ProtectionFlags{}), true},
+		{"WriteProtected", input(uid1, she.KEY_2, 2, mup.ProtectionFlags{}), false},
+		{"WildcardProtected", input(wildcard, she.KEY_1, 10, mup.ProtectionFlags{}), false},
+		{"Wildcard", input(wildcard, she.KEY_3, 1, mup.ProtectionFlags{}), true},
+		{"RAM_KEY", mup.Input{UID: uid1, ID: she.RAM_KEY}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := l.Check(tt.in, true)
+			if tt.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	t.Run("WildcardNotAllowed", func(t *testing.T) {
+		err := l.Check(input(wildcard, she.KEY_3, 1, mup.ProtectionFlags{}), false)
+		if !errors.Is(err, ErrWildcard) {
+			t.Fatal("expected ErrWildcard, have", err)
+		}
+	})
+
+	t.Run("AfterWildcard", func(t *testing.T) {
+		l := Ledger{Entries: append([]Entry(nil), l.Entries...)}
+		issue(t, &l, input(wildcard, she.KEY_3, 7, mup.ProtectionFlags{}))
+		// the wildcard update applies also to modules not seen before
+		for _, uid := range []string{uid1, "000000000000000000000000000003"} {
+			if err := l.Check(input(uid, she.KEY_3, 7, mup.ProtectionFlags{}), true); err == nil {
+				t.Fatal("expected error")
+			}
+			if err := l.Check(input(uid, she.KEY_3, 8, mup.ProtectionFlags{}), true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestWildcardEntry(t *testing.T) {
+	var l Ledger
+	issue(t, &l, input(uid1, she.KEY_2, 1, mup.ProtectionFlags{Write: true}))
+	issue(t, &l, input(uid2, she.KEY_2, 1, mup.ProtectionFlags{}))
+	// recorded without Check, e.g. by an older version
+	in := input(wildcard, she.KEY_2, 5, mup.ProtectionFlags{})
+	result, err := in.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Add(in, in.Record(result))
+
+	// the write protected module rejected the wildcard update
+	if err := l.Check(input(uid1, she.KEY_2, 6, mup.ProtectionFlags{}), true); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := l.Check(input(uid2, she.KEY_2, 5, mup.ProtectionFlags{}), true); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := l.Check(input(uid2, she.KEY_2, 6, mup.ProtectionFlags{}), true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	var l Ledger
+	issue(t, &l, input(uid1, she.KEY_1, 1, mup.ProtectionFlags{KeyUsage: true}))
+
+	var buf bytes.Buffer
+	if err := l.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Entries) != 1 {
+		t.Fatal("expected 1 entry, have", len(loaded.Entries))
+	}
+	e := loaded.Entries[0]
+	if e.UID != uid1 || e.ID != she.KEY_1 || e.Counter != 1 || !e.Flags.KeyUsage || e.M4 != l.Entries[0].M4 {
+		t.Fatal("unexpected entry", e)
+	}
+	if err := loaded.Check(input(uid1, she.KEY_1, 1, mup.ProtectionFlags{}), false); err == nil {
+		t.Fatal("expected error")
+	}
+}
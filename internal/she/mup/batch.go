@@ -0,0 +1,263 @@
+package mup
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/she"
+)
+
+// RowError is returned for an invalid input of a batch,
+// Row is the CSV line or the 1-based index of the JSON array element.
+type RowError struct {
+	Row int
+	Err error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.Row, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// BatchInput is one Input of a batch, with its position in the source.
+type BatchInput struct {
+	Row int
+	Input
+}
+
+// Record contains the M1, M2, M3, M4, M5 of one Input as hex strings.
+type Record struct {
+	UID     string
+	ID      she.KeyID
+	AuthID  she.KeyID
+	Counter uint32
+	M1      string
+	M2      string
+	M3      string
+	M4      string
+	M5      string
+}
+
+// CSVHeader contains the columns of the CSV read by ReadCSV, the flag
+// and profile columns are optional.
+var CSVHeader = []string{
+	"UID", "AuthID", "AuthKey", "ID", "NewKey", "Counter",
+	"Write", "Boot", "Debugger", "KeyUsage", "Wildcard", "Profile",
+}
+
+// RecordCSVHeader contains the columns written by Record.CSV.
+var RecordCSVHeader = []string{"UID", "ID", "AuthID", "Counter", "M1", "M2", "M3", "M4", "M5"}
+
+// ReadJSON reads a JSON array of Input.
+func ReadJSON(r io.Reader) ([]BatchInput, error) {
+	var elements []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&elements); err != nil {
+		return nil, err
+	}
+	var errs []error
+	result := make([]BatchInput, len(elements))
+	for i, e := range elements {
+		result[i].Row = i + 1
+		if err := json.Unmarshal(e, &result[i].Input); err != nil {
+			errs = append(errs, &RowError{Row: i + 1, Err: err})
+		}
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+	return result, nil
+}
+
+// ReadCSV reads Input values from CSV with a header line, see CSVHeader.
+// IDs can be given as names(e.g. KEY_1) or numbers, an empty flag is false.
+func ReadCSV(r io.Reader) ([]BatchInput, error) {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		found := false
+		for _, v := range CSVHeader {
+			if strings.EqualFold(strings.TrimSpace(name), v) {
+				columns[v] = i
+				found = true
+			}
+		}
+		if !found {
+			return nil, &RowError{Row: 1, Err: fmt.Errorf("unknown column %q", name)}
+		}
+	}
+	for _, v := range CSVHeader[:6] {
+		if _, ok := columns[v]; !ok {
+			return nil, &RowError{Row: 1, Err: fmt.Errorf("missing column %q", v)}
+		}
+	}
+
+	var result []BatchInput
+	var errs []error
+	for {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var perr *csv.ParseError
+			if errors.As(err, &perr) {
+				return nil, &RowError{Row: perr.Line, Err: perr.Err}
+			}
+			return nil, err
+		}
+		row, _ := cr.FieldPos(0)
+		if len(fields) != len(header) {
+			errs = append(errs, &RowError{Row: row, Err: fmt.Errorf("expected %d fields, have %d", len(header), len(fields))})
+			continue
+		}
+		in, err := parseCSVRecord(fields, columns)
+		if err != nil {
+			errs = append(errs, &RowError{Row: row, Err: err})
+			continue
+		}
+		result = append(result, BatchInput{Row: row, Input: in})
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return result, nil
+}
+
+func parseCSVRecord(fields []string, columns map[string]int) (Input, error) {
+	var in Input
+	var err error
+
+	field := func(name string) string {
+		i, ok := columns[name]
+		if !ok {
+			return ""
+		}
+		return strings.TrimSpace(fields[i])
+	}
+
+	in.UID = field("UID")
+	in.AuthKey = field("AuthKey")
+	in.NewKey = field("NewKey")
+	in.Profile = field("Profile")
+
+	if in.AuthID, err = she.ParseKeyID(field("AuthID")); err != nil {
+		return in, fmt.Errorf("AuthID: %w", err)
+	}
+	if in.ID, err = she.ParseKeyID(field("ID")); err != nil {
+		return in, fmt.Errorf("ID: %w", err)
+	}
+
+	counter, err := strconv.ParseUint(field("Counter"), 0, 32)
+	if err != nil {
+		return in, fmt.Errorf("Counter: %w", err)
+	}
+	in.Counter = uint32(counter)
+
+	flags := []struct {
+		name string
+		dst  *bool
+	}{
+		{"Write", &in.Flags.Write},
+		{"Boot", &in.Flags.Boot},
+		{"Debugger", &in.Flags.Debugger},
+		{"KeyUsage", &in.Flags.KeyUsage},
+		{"Wildcard", &in.Flags.Wildcard},
+	}
+	for _, f := range flags {
+		v := field(f.name)
+		if v == "" {
+			continue
+		}
+		if *f.dst, err = strconv.ParseBool(v); err != nil {
+			return in, fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+
+	return in, nil
+}
+
+// EncodeBatch encodes all the inputs, in the same way as Input.Encode.
+// If the same UID and ID appear multiple times, the counter must increase.
+// All the invalid inputs are reported, each error is a *RowError.
+func EncodeBatch(inputs []BatchInput) ([]Record, error) {
+	type slot struct {
+		uid string
+		id  she.KeyID
+	}
+	counters := make(map[slot]uint32)
+
+	var errs []error
+	records := make([]Record, 0, len(inputs))
+	for _, in := range inputs {
+		result, err := in.Encode()
+		if err != nil {
+			errs = append(errs, &RowError{Row: in.Row, Err: err})
+			continue
+		}
+
+		s := slot{uid: strings.ToLower(in.UID), id: in.ID}
+		if last, ok := counters[s]; ok && in.Counter <= last {
+			errs = append(errs, &RowError{
+				Row: in.Row,
+				Err: fmt.Errorf("counter %d of %s for UID %s is not greater than the previous one(%d)", in.Counter, in.ID, in.UID, last),
+			})
+			continue
+		}
+		counters[s] = in.Counter
+
+		records = append(records, in.Record(result))
+	}
+	if len(errs) != 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return records, nil
+}
+
+// Record returns the record of the result of in.Encode.
+func (in Input) Record(result [112]byte) Record {
+	m1, m2, m3, m4, m5 := SliceMs(result)
+	return Record{
+		UID:     in.UID,
+		ID:      in.ID,
+		AuthID:  in.AuthID,
+		Counter: in.Counter,
+		M1:      hex.EncodeToString(m1),
+		M2:      hex.EncodeToString(m2),
+		M3:      hex.EncodeToString(m3),
+		M4:      hex.EncodeToString(m4),
+		M5:      hex.EncodeToString(m5),
+	}
+}
+
+// CSV returns the fields of the record, in the order of RecordCSVHeader.
+func (r Record) CSV() []string {
+	return []string{
+		r.UID,
+		r.ID.String(),
+		r.AuthID.String(),
+		strconv.FormatUint(uint64(r.Counter), 10),
+		r.M1,
+		r.M2,
+		r.M3,
+		r.M4,
+		r.M5,
+	}
+}
@@ -0,0 +1,177 @@
+package mup
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/she"
+)
+
+const batchCSV = `UID,AuthID,AuthKey,ID,NewKey,Counter,KeyUsage
+000000000000000000000000000001,MASTER_ECU_KEY,000102030405060708090a0b0c0d0e0f,KEY_1,0f0e0d0c0b0a09080706050403020100,1,false
+000000000000000000000000000002,1,000102030405060708090a0b0c0d0e0f,5,0f0e0d0c0b0a09080706050403020100,0x10,true
+`
+
+const batchJSON = `[
+  {
+    "UID": "000000000000000000000000000001",
+    "AuthID": 1,
+    "AuthKey": "000102030405060708090a0b0c0d0e0f",
+    "ID": 4,
+    "NewKey": "0f0e0d0c0b0a09080706050403020100",
+    "Counter": 1
+  },
+  {
+    "UID": "000000000000000000000000000002",
+    "AuthID": 1,
+    "AuthKey": "000102030405060708090a0b0c0d0e0f",
+    "ID": 5,
+    "NewKey": "0f0e0d0c0b0a09080706050403020100",
+    "Counter": 16,
+    "Flags": {"KeyUsage": true}
+  }
+]`
+
+func expectRows(t *testing.T, err error, rows ...int) {
+	t.Helper()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, row := range rows {
+		found := false
+		for _, e := range flattenErrors(err) {
+			var rerr *RowError
+			if errors.As(e, &rerr) && rerr.Row == row {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("expected error for row %d, have: %v", row, err)
+		}
+	}
+}
+
+func flattenErrors(err error) []error {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+func TestReadCSV(t *testing.T) {
+	t.Run("Ok", func(t *testing.T) {
+		inputs, err := ReadCSV(strings.NewReader(batchCSV))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(inputs) != 2 {
+			t.Fatal("expected 2 inputs, have", len(inputs))
+		}
+		in := inputs[1]
+		if in.Row != 3 || in.AuthID != she.MASTER_ECU_KEY || in.ID != she.KEY_2 || in.Counter != 16 || !in.Flags.KeyUsage {
+			t.Fatal("unexpected input", in)
+		}
+	})
+
+	t.Run("InvalidRows", func(t *testing.T) {
+		data := batchCSV +
+			"000000000000000000000000000003,KEY_21,00,KEY_1,00,1,false\n" +
+			"000000000000000000000000000003,1,00,KEY_1,00,-1,false\n" +
+			"000000000000000000000000000003,1,00,KEY_1,00,1,maybe\n" +
+			"000000000000000000000000000003,1,00\n"
+		_, err := ReadCSV(strings.NewReader(data))
+		expectRows(t, err, 4, 5, 6, 7)
+	})
+
+	t.Run("Header", func(t *testing.T) {
+		for _, data := range []string{
+			"",
+			"UID,AuthID,AuthKey,ID,NewKey\n",
+			"UID,AuthID,AuthKey,ID,NewKey,Counter,Foo\n",
+		} {
+			if _, err := ReadCSV(strings.NewReader(data)); err == nil {
+				t.Fatalf("%q: expected error", data)
+			}
+		}
+	})
+
+	t.Run("Quotes", func(t *testing.T) {
+		_, err := ReadCSV(strings.NewReader(batchCSV + "\"000\"000,1,00,1,00,1\n"))
+		expectRows(t, err, 4)
+	})
+}
+
+func TestReadJSON(t *testing.T) {
+	inputs, err := ReadJSON(strings.NewReader(batchJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 2 || inputs[1].Row != 2 || !inputs[1].Flags.KeyUsage {
+		t.Fatal("unexpected inputs", inputs)
+	}
+
+	_, err = ReadJSON(strings.NewReader(`[{"UID": "00"}, {"Counter": "1"}, {"ID": 300}]`))
+	expectRows(t, err, 2, 3)
+
+	if _, err := ReadJSON(strings.NewReader(`{}`)); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestEncodeBatch(t *testing.T) {
+	fromCSV, err := ReadCSV(strings.NewReader(batchCSV))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ReadJSON(strings.NewReader(batchJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := EncodeBatch(fromCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recordsJSON, err := EncodeBatch(fromJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range records {
+		if records[i] != recordsJSON[i] {
+			t.Fatalf("record %d differs between CSV and JSON", i)
+		}
+	}
+
+	r := records[0]
+	if r.M1 != "00000000000000000000000000000141" ||
+		r.M2 != "2b111e2d93f486566bcbba1d7f7a9797c94643b050fc5d4d7de14cff682203c3" ||
+		r.M3 != "b9d745e5ace7d41860bc63c2b9f5bb46" ||
+		r.M4 != "00000000000000000000000000000141b472e8d8727d70d57295e74849a27917" ||
+		r.M5 != "820d8d95dc11b4668878160cb2a4e23e" {
+		t.Fatal("unexpected record", r)
+	}
+
+	fields := r.CSV()
+	if len(fields) != len(RecordCSVHeader) || fields[1] != "KEY_1" || fields[3] != "1" {
+		t.Fatal("unexpected CSV", fields)
+	}
+
+	t.Run("Errors", func(t *testing.T) {
+		inputs := append([]BatchInput{}, fromJSON...)
+		// same slot, same counter
+		inputs = append(inputs, BatchInput{Row: 3, Input: fromJSON[0].Input})
+		// invalid key
+		bad := fromJSON[1]
+		bad.Row = 4
+		bad.NewKey = "00"
+		inputs = append(inputs, bad)
+		// not compatible
+		bad = fromJSON[1]
+		bad.Row = 5
+		bad.ID = she.BOOT_MAC
+		inputs = append(inputs, bad)
+		_, err := EncodeBatch(inputs)
+		expectRows(t, err, 3, 4, 5)
+	})
+}
@@ -3,13 +3,13 @@ package mup
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 
 	"bandr.me/p/pocryp/internal/aes/cmac"
-	"bandr.me/p/pocryp/internal/aes/mp"
+	"bandr.me/p/pocryp/internal/secret"
 	"bandr.me/p/pocryp/internal/she"
 )
 
@@ -34,8 +34,14 @@ type Input struct {
 
 	// key flags
 	Flags ProtectionFlags
+
+	// device profile(see she.LookupProfile), empty for standard SHE
+	Profile string `json:",omitempty"`
 }
 
+// ErrM5 is returned by VerifyResponse when M5 is not the MAC of M4.
+var ErrM5 = errors.New("verification of M5 failed")
+
 var withLogs = false
 
 // WithLogs will enable verbose logs for this package(useful for debugging)
@@ -44,6 +50,12 @@ func WithLogs() {
 }
 
 func Decode(m1m2m3, authKey []byte) (*Input, error) {
+	return DecodeProfile(m1m2m3, authKey, she.ProfileSHE, false)
+}
+
+// DecodeProfile is like Decode, for a device with the profile p.
+// bank1 is true if the update was sent for the key bank 1(extended keys).
+func DecodeProfile(m1m2m3, authKey []byte, p she.Profile, bank1 bool) (*Input, error) {
 	if len(m1m2m3) < 64 {
 		return nil, fmt.Errorf("invalid input length: %d", len(m1m2m3))
 	}
@@ -56,6 +68,7 @@ func Decode(m1m2m3, authKey []byte) (*Input, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer secret.Wipe(k1, k2)
 
 	if err := in.decodeM3(m1m2m3[:48], m1m2m3[48:64], k2); err != nil {
 		return nil, err
@@ -65,10 +78,14 @@ func Decode(m1m2m3, authKey []byte) (*Input, error) {
 		return nil, err
 	}
 
-	if err := in.decodeM1(m1m2m3[:16]); err != nil {
+	if err := in.decodeM1(m1m2m3[:16], p, bank1); err != nil {
 		return nil, err
 	}
 
+	if p.Name != she.ProfileSHE.Name {
+		in.Profile = p.Name
+	}
+
 	return &in, nil
 }
 
@@ -81,9 +98,98 @@ func SliceMs(m1m2m3m4m5 [112]byte) (m1 []byte, m2 []byte, m3 []byte, m4 []byte,
 	return
 }
 
+// Response contains the values confirmed by the SHE module in M4 and M5,
+// after a successful CMD_LOAD_KEY.
+type Response struct {
+	// SHE module Unique ID as hex string
+	UID string
+
+	// ID of the secret key
+	AuthID she.KeyID
+
+	// ID of the updated slot
+	ID she.KeyID
+
+	// new value of the counter
+	Counter uint32
+}
+
+// VerifyResponse checks M4 and M5 using the new key and returns the values
+// confirmed by the SHE module.
+func VerifyResponse(m4m5, newKey []byte) (*Response, error) {
+	return VerifyResponseProfile(m4m5, newKey, she.ProfileSHE, false)
+}
+
+// VerifyResponseProfile is like VerifyResponse, for a device with the
+// profile p. bank1 is true if the update was sent for the key bank 1.
+func VerifyResponseProfile(m4m5, newKey []byte, p she.Profile, bank1 bool) (*Response, error) {
+	if len(m4m5) != 48 {
+		return nil, fmt.Errorf("invalid input length: %d", len(m4m5))
+	}
+	if len(newKey) != 16 {
+		return nil, fmt.Errorf("invalid key size: %d", len(newKey))
+	}
+
+	k3, k4, err := deriveKeys(newKey)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(k3, k4)
+
+	if withLogs {
+		log.Println("K3:", hex.EncodeToString(k3))
+		log.Println("K4:", hex.EncodeToString(k4))
+	}
+
+	m4 := m4m5[:32]
+	m5 := m4m5[32:]
+
+	if !cmac.Verify(k4, m4, m5) {
+		return nil, ErrM5
+	}
+
+	var r Response
+
+	counter, err := decodeM4Counter(k3, m4[16:])
+	if err != nil {
+		return nil, err
+	}
+	r.Counter = counter
+
+	var in Input
+	if err := in.decodeM1(m4[:16], p, bank1); err != nil {
+		return nil, err
+	}
+	r.UID = in.UID
+	r.ID = in.ID
+	r.AuthID = in.AuthID
+
+	return &r, nil
+}
+
+// IsWildcard returns true if the UID is the wildcard UID(all zeros),
+// accepted by every SHE module whose key slot is not wildcard protected.
+func (in Input) IsWildcard() bool {
+	uid, err := hex.DecodeString(in.UID)
+	if err != nil || len(uid) == 0 {
+		return false
+	}
+	for _, v := range uid {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
 // Encode the memory update protocol data(M1, M2, M3, M4, M5).
 func (in Input) Encode() (result [112]byte, err error) {
-	if err := in.ID.IsCompatible(in.AuthID); err != nil {
+	profile, err := she.LookupProfile(in.Profile)
+	if err != nil {
+		return result, err
+	}
+
+	if err := profile.IsCompatible(in.ID, in.AuthID); err != nil {
 		return result, err
 	}
 
@@ -91,21 +197,25 @@ func (in Input) Encode() (result [112]byte, err error) {
 	if err != nil {
 		return result, fmt.Errorf("AuthKey: %w", err)
 	}
+	defer secret.Wipe(authKey)
 
 	newKey, err := decodeAesKey(in.NewKey)
 	if err != nil {
 		return result, fmt.Errorf("NewKey: %w", err)
 	}
+	defer secret.Wipe(newKey)
 
 	k1, k2, err := deriveKeys(authKey)
 	if err != nil {
 		return result, err
 	}
+	defer secret.Wipe(k1, k2)
 
 	k3, k4, err := deriveKeys(newKey)
 	if err != nil {
 		return result, err
 	}
+	defer secret.Wipe(k3, k4)
 
 	if withLogs {
 		log.Println("K1:", hex.EncodeToString(k1))
@@ -114,7 +224,7 @@ func (in Input) Encode() (result [112]byte, err error) {
 		log.Println("K4:", hex.EncodeToString(k4))
 	}
 
-	m1, err := in.encodeM1()
+	m1, err := in.encodeM1(profile)
 	if err != nil {
 		return result, err
 	}
@@ -154,34 +264,36 @@ func decodeAesKey(hexKey string) ([]byte, error) {
 		return nil, err
 	}
 	if len(key) != 16 {
+		secret.Wipe(key)
 		return nil, fmt.Errorf("expected length is 16 bytes, have %d bytes", len(key))
 	}
 	return key, nil
 }
 
 func deriveKeys(key []byte) ([]byte, []byte, error) {
-	encConst := sheKeyUpdateEncConstBase.encode()
-	macConst := sheKeyUpdateMacConstBase.encode()
+	encConst := she.KEY_UPDATE_ENC_C
+	macConst := she.KEY_UPDATE_MAC_C
 
 	if withLogs {
-		log.Println("ENC_C:", hex.EncodeToString(encConst))
-		log.Println("MAC_C:", hex.EncodeToString(macConst))
+		log.Println("ENC_C:", hex.EncodeToString(encConst[:]))
+		log.Println("MAC_C:", hex.EncodeToString(macConst[:]))
 	}
 
-	k1, err := mp.Compress(key, encConst)
+	k1, err := she.KDF(key, encConst[:])
 	if err != nil {
 		return nil, nil, err
 	}
 
-	k2, err := mp.Compress(key, macConst)
+	k2, err := she.KDF(key, macConst[:])
 	if err != nil {
+		secret.Wipe(k1)
 		return nil, nil, err
 	}
 
 	return k1, k2, nil
 }
 
-func (in Input) encodeM1() ([]byte, error) {
+func (in Input) encodeM1(p she.Profile) ([]byte, error) {
 	uid, err := hex.DecodeString(in.UID)
 	if err != nil {
 		return nil, err
@@ -197,26 +309,26 @@ func (in Input) encodeM1() ([]byte, error) {
 		log.Println("AuthID:", in.AuthID)
 	}
 
+	ids, err := p.EncodeIDs(in.ID, in.AuthID)
+	if err != nil {
+		return nil, err
+	}
+
 	var r []byte
 	r = append(r, uid...)
-	r = append(r, uint8(in.ID)<<4|uint8(in.AuthID))
+	r = append(r, ids)
 
 	return r, nil
 }
 
-func (in *Input) decodeM1(m1 []byte) error {
+func (in *Input) decodeM1(m1 []byte, p she.Profile, bank1 bool) error {
 	if len(m1) != 16 {
 		return fmt.Errorf("invalid input length: %d", len(m1))
 	}
 
-	id := she.KeyID((m1[15] >> 4) & 0x0f)
-	authId := she.KeyID(m1[15] & 0x0f)
-
-	if !id.IsValid() {
-		return fmt.Errorf("ID %s is not valid", id)
-	}
-	if !authId.IsValid() {
-		return fmt.Errorf("ID %s is not valid", authId)
+	id, authId, err := p.DecodeIDs(m1[15], bank1)
+	if err != nil {
+		return err
 	}
 
 	in.UID = hex.EncodeToString(m1[:15])
@@ -246,6 +358,7 @@ func (in Input) encodeM2(newKey, k1 []byte) ([]byte, error) {
 	}
 
 	data := make([]byte, 32)
+	defer secret.Wipe(data)
 
 	copy(data[0:8], counterAndFlags[:])
 	copy(data[16:], newKey)
@@ -264,6 +377,7 @@ func (in *Input) decodeM2(m2, k1 []byte) error {
 	if err != nil {
 		return err
 	}
+	defer secret.Wipe(data)
 
 	counter, flags := decodeCounterAndFlags(data[0:5])
 
@@ -314,6 +428,30 @@ func (in Input) encodeM4(k3, m1 []byte) ([]byte, error) {
 	return data, nil
 }
 
+func decodeM4Counter(k3, encCounter []byte) (uint32, error) {
+	block, err := aes.NewCipher(k3)
+	if err != nil {
+		return 0, err
+	}
+
+	data := make([]byte, 16)
+	block.Decrypt(data, encCounter)
+
+	// counter(28 bits) || 1 || 0...0
+	if data[3]&0x0f != 0b00001000 {
+		return 0, fmt.Errorf("invalid padding of the counter in M4")
+	}
+	for _, v := range data[4:] {
+		if v != 0 {
+			return 0, fmt.Errorf("invalid padding of the counter in M4")
+		}
+	}
+
+	counter, _ := decodeCounterAndFlags(data[0:5])
+
+	return counter, nil
+}
+
 func ecb(key, in []byte) {
 	block, _ := aes.NewCipher(key)
 	for len(in) > 0 {
@@ -326,22 +464,6 @@ func (in Input) encodeM5(k4, m4 []byte) ([]byte, error) {
 	return cmac.Generate(k4, m4)
 }
 
-type keyUpdateConst [4]uint32
-
-func (c keyUpdateConst) encode() []byte {
-	r := make([]byte, 16)
-	binary.BigEndian.PutUint32(r[0:4], c[0])
-	binary.BigEndian.PutUint32(r[4:8], c[1])
-	binary.BigEndian.PutUint32(r[8:12], c[2])
-	binary.BigEndian.PutUint32(r[12:16], c[3])
-	return r
-}
-
-var (
-	sheKeyUpdateEncConstBase = keyUpdateConst{0x01015348, 0x45008000, 0x00000000, 0x000000b0}
-	sheKeyUpdateMacConstBase = keyUpdateConst{0x01025348, 0x45008000, 0x00000000, 0x000000b0}
-)
-
 func cbcEncrypt(key, iv, plaintext []byte) ([]byte, error) {
 	return cbc(key, iv, plaintext, true)
 }
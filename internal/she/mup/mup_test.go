@@ -100,6 +100,69 @@ func TestDecode(t *testing.T) {
 	}
 }
 
+func TestEncodeDecodeProfile(t *testing.T) {
+	in := Input{
+		UID:     "000000000000000000000000000001",
+		AuthID:  she.MASTER_ECU_KEY,
+		ID:      she.KEY_11,
+		AuthKey: "000102030405060708090a0b0c0d0e0f",
+		NewKey:  "0f0e0d0c0b0a09080706050403020100",
+		Counter: 1,
+		Profile: "csec",
+	}
+
+	result, err := in.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// KEY_11 is the slot 4 of the key bank 1
+	if result[15] != 0x41 {
+		t.Fatalf("ID byte of M1: %02x", result[15])
+	}
+
+	authKey, _ := hex.DecodeString(in.AuthKey)
+
+	out, err := DecodeProfile(result[:64], authKey, she.ProfileCSEc, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := out.equals(in); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Bank0", func(t *testing.T) {
+		out, err := Decode(result[:64], authKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.ID != she.KEY_1 {
+			t.Fatal(out.ID)
+		}
+	})
+
+	t.Run("NotInProfile", func(t *testing.T) {
+		in := in
+		in.ID = she.KEY_20
+		if _, err := in.Encode(); err == nil {
+			t.Fatal("expected error")
+		}
+		in.Profile = ""
+		in.ID = she.KEY_11
+		if _, err := in.Encode(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("UnknownProfile", func(t *testing.T) {
+		in := in
+		in.Profile = "foo"
+		if _, err := in.Encode(); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
+
 func TestCounterAndFlags(t *testing.T) {
 	t.Run("CounterOverMax", func(t *testing.T) {
 		_, err := encodeCounterAndFlags(counterMax+1, 0)
@@ -179,6 +242,9 @@ func (in Input) equals(other Input) error {
 	if err := in.Flags.equals(other.Flags); err != nil {
 		return fmt.Errorf("Flags: %w", err)
 	}
+	if in.Profile != other.Profile {
+		return fmt.Errorf("Profile: %q != %q", in.Profile, other.Profile)
+	}
 	return nil
 }
 
@@ -200,3 +266,76 @@ func (f ProtectionFlags) equals(other ProtectionFlags) error {
 	}
 	return nil
 }
+
+func TestVerifyResponse(t *testing.T) {
+	newKey, _ := hex.DecodeString("0f0e0d0c0b0a09080706050403020100")
+	m4m5, _ := hex.DecodeString(
+		"00000000000000000000000000000141b472e8d8727d70d57295e74849a27917" +
+			"820d8d95dc11b4668878160cb2a4e23e",
+	)
+
+	t.Run("Ok", func(t *testing.T) {
+		r, err := VerifyResponse(m4m5, newKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := Response{
+			UID:     "000000000000000000000000000001",
+			AuthID:  she.MASTER_ECU_KEY,
+			ID:      she.KEY_1,
+			Counter: 1,
+		}
+		if *r != expected {
+			t.Log("want", expected)
+			t.Log("have", *r)
+			t.Fatal("response")
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		key := bytes.Clone(newKey)
+		key[0] ^= 1
+		if _, err := VerifyResponse(m4m5, key); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("TamperedM4", func(t *testing.T) {
+		for _, i := range []int{0, 15, 16, 31} {
+			data := bytes.Clone(m4m5)
+			data[i] ^= 1
+			if _, err := VerifyResponse(data, newKey); err == nil {
+				t.Fatalf("byte %d: expected error", i)
+			}
+		}
+	})
+
+	t.Run("InvalidLength", func(t *testing.T) {
+		if _, err := VerifyResponse(m4m5[:47], newKey); err == nil {
+			t.Fatal("expected error")
+		}
+		if _, err := VerifyResponse(m4m5, newKey[:15]); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("InvalidPadding", func(t *testing.T) {
+		// M5 is valid but the counter block is not padded with 1 || 0...0
+		k3, k4, err := deriveKeys(newKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := make([]byte, 48)
+		copy(data, m4m5[:16])
+		data[16+3] = 0x10
+		ecb(k3, data[16:32])
+		m5, err := Input{}.encodeM5(k4, data[:32])
+		if err != nil {
+			t.Fatal(err)
+		}
+		copy(data[32:], m5)
+		if _, err := VerifyResponse(data, newKey); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
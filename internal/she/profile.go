@@ -0,0 +1,116 @@
+package she
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Profile describes the key slots of a device.
+//
+// Some devices(e.g. NXP CSEc, SHE+) have a second key bank with the extended
+// keys KEY_11... The key bank is selected by the command, M1 contains only the
+// lower 4 bits of the IDs: an extended key can be updated only with itself or
+// with MASTER_ECU_KEY and cannot be used to update the RAM_KEY.
+type Profile struct {
+	Name string
+
+	// extended keys supported by the device
+	Extended []KeyID
+}
+
+var (
+	ProfileSHE     = Profile{Name: "she"}
+	ProfileCSEc    = Profile{Name: "csec", Extended: []KeyID{KEY_11, KEY_12, KEY_13, KEY_14, KEY_15, KEY_16, KEY_17}}
+	ProfileSHEPlus = Profile{
+		Name:     "she+",
+		Extended: []KeyID{KEY_11, KEY_12, KEY_13, KEY_14, KEY_15, KEY_16, KEY_17, KEY_18, KEY_19, KEY_20},
+	}
+)
+
+// Profiles contains all the known profiles.
+var Profiles = []Profile{ProfileSHE, ProfileCSEc, ProfileSHEPlus}
+
+// LookupProfile returns the profile with the given name,
+// the empty name is the standard SHE profile.
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		return ProfileSHE, nil
+	}
+	for _, p := range Profiles {
+		if p.Name == strings.ToLower(name) {
+			return p, nil
+		}
+	}
+	return Profile{}, fmt.Errorf("unknown profile %q", name)
+}
+
+// IsValid returns true if the device has the key slot id.
+func (p Profile) IsValid(id KeyID) bool {
+	return id.IsValid() || p.isExtended(id)
+}
+
+func (p Profile) isExtended(id KeyID) bool {
+	for _, v := range p.Extended {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// IsCompatible checks that the key id can be updated with the key other.
+func (p Profile) IsCompatible(id, other KeyID) error {
+	if !p.IsValid(id) {
+		return fmt.Errorf("%s is not valid for profile %s", id, p.Name)
+	}
+	if !p.IsValid(other) {
+		return fmt.Errorf("%s is not valid for profile %s", other, p.Name)
+	}
+
+	if p.isExtended(id) {
+		if other != id && other != MASTER_ECU_KEY {
+			return fmt.Errorf("%s can be updated only with itself or %s", id, MASTER_ECU_KEY)
+		}
+		return nil
+	}
+
+	if p.isExtended(other) {
+		return fmt.Errorf("%s cannot be updated with %s", id, other)
+	}
+
+	return id.IsCompatible(other)
+}
+
+// EncodeIDs returns the last byte of M1: ID(4 bits) || AuthID(4 bits).
+func (p Profile) EncodeIDs(id, authID KeyID) (uint8, error) {
+	if err := p.IsCompatible(id, authID); err != nil {
+		return 0, err
+	}
+	return uint8(id&0x0f)<<4 | uint8(authID&0x0f), nil
+}
+
+// DecodeIDs returns the IDs from the last byte of M1,
+// bank1 is true if the command selected the key bank 1.
+func (p Profile) DecodeIDs(v uint8, bank1 bool) (id, authID KeyID, err error) {
+	id = KeyID(v >> 4)
+	authID = KeyID(v & 0x0f)
+
+	if bank1 {
+		id |= KeyBank1
+		if !p.isExtended(id) {
+			return 0, 0, fmt.Errorf("%s is not valid for profile %s", id, p.Name)
+		}
+		if authID == id&0x0f {
+			authID = id
+		}
+	}
+
+	if !p.IsValid(id) {
+		return 0, 0, fmt.Errorf("ID %s is not valid", id)
+	}
+	if !p.IsValid(authID) {
+		return 0, 0, fmt.Errorf("ID %s is not valid", authID)
+	}
+
+	return id, authID, nil
+}
@@ -0,0 +1,97 @@
+package she
+
+import (
+	"testing"
+)
+
+func TestLookupProfile(t *testing.T) {
+	for _, name := range []string{"", "she", "csec", "she+", "CSEc"} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := LookupProfile(name); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	if _, err := LookupProfile("foo"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestProfileIsCompatible(t *testing.T) {
+	tests := []struct {
+		p     Profile
+		id    KeyID
+		other KeyID
+		ok    bool
+	}{
+		{ProfileSHE, KEY_1, MASTER_ECU_KEY, true},
+		{ProfileSHE, KEY_11, MASTER_ECU_KEY, false},
+		{ProfileSHE, RAM_KEY, KEY_11, false},
+		{ProfileCSEc, KEY_11, MASTER_ECU_KEY, true},
+		{ProfileCSEc, KEY_17, KEY_17, true},
+		{ProfileCSEc, KEY_18, KEY_18, false},
+		{ProfileCSEc, KEY_11, KEY_1, false},
+		{ProfileCSEc, KEY_11, KEY_12, false},
+		{ProfileCSEc, RAM_KEY, KEY_11, false},
+		{ProfileCSEc, KEY_1, KEY_11, false},
+		{ProfileCSEc, RAM_KEY, KEY_1, true},
+		{ProfileSHEPlus, KEY_20, MASTER_ECU_KEY, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.p.Name+"/"+tt.id.String()+"/"+tt.other.String(), func(t *testing.T) {
+			err := tt.p.IsCompatible(tt.id, tt.other)
+			if tt.ok && err != nil {
+				t.Fatal(err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestProfileIDs(t *testing.T) {
+	tests := []struct {
+		id     KeyID
+		authID KeyID
+		v      uint8
+		bank1  bool
+	}{
+		{KEY_1, MASTER_ECU_KEY, 0x41, false},
+		{RAM_KEY, SECRET_KEY, 0xe0, false},
+		{KEY_11, MASTER_ECU_KEY, 0x41, true},
+		{KEY_11, KEY_11, 0x44, true},
+		{KEY_20, KEY_20, 0xdd, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id.String()+"/"+tt.authID.String(), func(t *testing.T) {
+			v, err := ProfileSHEPlus.EncodeIDs(tt.id, tt.authID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v != tt.v {
+				t.Fatalf("want %02x, have %02x", tt.v, v)
+			}
+			id, authID, err := ProfileSHEPlus.DecodeIDs(v, tt.bank1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != tt.id || authID != tt.authID {
+				t.Fatalf("have %s %s", id, authID)
+			}
+		})
+	}
+
+	t.Run("Bank1NotSupported", func(t *testing.T) {
+		if _, _, err := ProfileSHE.DecodeIDs(0x41, true); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("NotInProfile", func(t *testing.T) {
+		// KEY_18 is the slot 0xb of the key bank 1
+		if _, _, err := ProfileCSEc.DecodeIDs(0xb1, true); err == nil {
+			t.Fatal("expected error")
+		}
+	})
+}
@@ -3,6 +3,9 @@ package testutil
 import (
 	"bytes"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
 	"os"
 	"testing"
 
@@ -11,8 +14,26 @@ import (
 
 func RunCmd(cmd *cmd.Command, args ...string) error {
 	cmd.Init()
-	cmd.Args = args
-	return cmd.Run(cmd)
+	return cmd.Execute(args)
+}
+
+// RunCmdJSON runs cmd as if the global -json flag was given.
+func RunCmdJSON(cmd *cmd.Command, args ...string) error {
+	cmd.JSON = true
+	defer func() { cmd.JSON = false }()
+	return RunCmd(cmd, args...)
+}
+
+// ReadJSON decodes the JSON in file into v.
+func ReadJSON(t *testing.T, file string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func SetupIn(t *testing.T, in string, input []byte) {
@@ -22,13 +43,12 @@ func SetupIn(t *testing.T, in string, input []byte) {
 	}
 }
 
+// SetupOut removes out, so a command can create it without -force.
 func SetupOut(t *testing.T, out string) {
 	t.Helper()
-	f, err := os.Create(out)
-	if err != nil {
+	if err := os.Remove(out); err != nil && !errors.Is(err, fs.ErrNotExist) {
 		t.Fatal(err)
 	}
-	defer f.Close()
 }
 
 func SetupInOut(t *testing.T, in, out string, input []byte) {
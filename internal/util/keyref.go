@@ -0,0 +1,88 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/keystore"
+	"bandr.me/p/pocryp/internal/secret"
+)
+
+// KeyRefHelp describes the key references, for usages.
+const KeyRefHelp = `  A key of the keystore can be used in place of a key value or key file as
+  @NAME, e.g. -key @fw-signing. The keystore is read from $` + keystore.PathEnv + `
+  or pocryp/keystore.json in the user config directory, the passphrase is read
+  from $` + keystore.PassEnv + ` or from a prompt.
+`
+
+// IsKeyRef returns true if s references a key of the keystore, as @NAME.
+func IsKeyRef(s string) bool {
+	return strings.HasPrefix(s, "@")
+}
+
+// openedKeystore is the keystore opened by ReadKeyRef, so the passphrase
+// is asked only once if a command uses multiple keys.
+var openedKeystore *keystore.Store
+
+// ReadKeyRef returns the value of the key referenced by s, see KeyRefHelp.
+func ReadKeyRef(s string) ([]byte, error) {
+	if !IsKeyRef(s) {
+		return nil, InvalidInput(fmt.Errorf("invalid key reference %q, expected @NAME", s))
+	}
+	if openedKeystore == nil {
+		path, err := keystore.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		passphrase, err := ReadPassphrase("")
+		if err != nil {
+			return nil, err
+		}
+		openedKeystore, err = keystore.Open(path, passphrase)
+		secret.Wipe(passphrase)
+		if err != nil {
+			return nil, KeystoreError(err)
+		}
+	}
+	k, err := openedKeystore.Get(strings.TrimPrefix(s, "@"))
+	if err != nil {
+		return nil, KeystoreError(err)
+	}
+	// a copy, so the caller can wipe it
+	return bytes.Clone(k.Value), nil
+}
+
+// KeystoreError returns err with the category of the keystore errors:
+// a wrong passphrase, a missing or duplicated key is an invalid input.
+func KeystoreError(err error) error {
+	switch {
+	case errors.Is(err, keystore.ErrPassphrase), errors.Is(err, keystore.ErrNotFound), errors.Is(err, keystore.ErrExists):
+		return InvalidInput(err)
+	default:
+		return err
+	}
+}
+
+// ReadPassphrase returns the keystore passphrase read from source(see ReadSource)
+// or, if source is empty, from $POCRYP_KEYSTORE_PASS or a prompt.
+// A trailing newline is removed.
+func ReadPassphrase(source string) ([]byte, error) {
+	if source == "" {
+		if v, ok := os.LookupEnv(keystore.PassEnv); ok {
+			return []byte(v), nil
+		}
+		source = "prompt"
+	}
+	data, err := ReadSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("passphrase: %w", err)
+	}
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil, errors.New("passphrase: empty")
+	}
+	return data, nil
+}
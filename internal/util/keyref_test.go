@@ -0,0 +1,70 @@
+package util
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/keystore"
+)
+
+func TestReadKeyRef(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keystore.json")
+	want := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	s := keystore.New(keystore.KDF{Name: "pbkdf2", Iter: 1000})
+	if err := s.Add(keystore.Key{Name: "k", Algorithm: keystore.AlgAES, Value: want}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveFile(path, []byte("secret")); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(keystore.PathEnv, path)
+	t.Setenv(keystore.PassEnv, "secret")
+	openedKeystore = nil
+	t.Cleanup(func() { openedKeystore = nil })
+
+	read := map[string]func() ([]byte, error){
+		"HexOrSource": func() ([]byte, error) { return HexOrSource("@k") },
+		"ReadKeyHex": func() ([]byte, error) {
+			k, err := ReadKey("", "@k", "hex")
+			return k.Bytes(), err
+		},
+		"ReadKeyFile": func() ([]byte, error) {
+			k, err := ReadKey("@k", "", "hex")
+			return k.Bytes(), err
+		},
+	}
+	for name, f := range read {
+		t.Run(name, func(t *testing.T) {
+			have, err := f()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Fatalf("want %x, have %x", want, have)
+			}
+		})
+	}
+
+	if _, err := ReadKeyRef("@missing"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ReadKeyRef("k"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	t.Run("WrongPassphrase", func(t *testing.T) {
+		openedKeystore = nil
+		t.Setenv(keystore.PassEnv, "wrong")
+		_, err := ReadKeyRef("@k")
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if c := cmd.CategoryOf(err); c != cmd.CategoryInvalidInput {
+			t.Fatalf("expected an invalid-input error, have %s", c)
+		}
+	})
+}
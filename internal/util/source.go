@@ -0,0 +1,113 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util/stdfile"
+)
+
+// SourceHelp describes the sources accepted by ReadSource, for usages.
+const SourceHelp = `  Keys, salts and IVs don't need to be on the command line, instead of a hex
+  value(e.g. -key env:KEY) or a file path(e.g. -key-file fd:3) use:
+    env:NAME  the environment variable NAME
+    fd:N      the file descriptor N, e.g. fd:3 with 3<key.txt
+    prompt    a prompt on the terminal, the input is not echoed
+    -         stdin, the input of the command must then be given with -in
+  Instead of a hex value, the source must contain hex.
+`
+
+// IsSource returns true if s is a source of ReadSource other than a file path.
+func IsSource(s string) bool {
+	return s == "-" || s == "prompt" || strings.HasPrefix(s, "env:") || strings.HasPrefix(s, "fd:")
+}
+
+// ReadSource returns the data read from source, see SourceHelp.
+// Any other source is the path of a file.
+func ReadSource(source string) ([]byte, error) {
+	switch {
+	case source == "-":
+		// the input of the command must then be given with -in
+		return stdfile.ReadStdin("a secret given as -")
+
+	case source == "prompt":
+		return prompt("Enter secret: ")
+
+	case strings.HasPrefix(source, "env:"):
+		name := strings.TrimPrefix(source, "env:")
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", name)
+		}
+		return []byte(v), nil
+
+	case strings.HasPrefix(source, "fd:"):
+		fd, err := strconv.ParseUint(strings.TrimPrefix(source, "fd:"), 10, 31)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor %q", source)
+		}
+		f := os.NewFile(uintptr(fd), source)
+		if f == nil {
+			return nil, fmt.Errorf("invalid file descriptor %q", source)
+		}
+		defer f.Close()
+		return io.ReadAll(f)
+
+	default:
+		return os.ReadFile(source)
+	}
+}
+
+// prompt reads a line from the terminal without echo,
+// the terminal is used even if stdin is redirected.
+func prompt(msg string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, errors.New("prompt: no terminal available")
+		}
+		fmt.Fprint(os.Stderr, msg)
+		defer fmt.Fprintln(os.Stderr)
+		return term.ReadPassword(int(os.Stdin.Fd()))
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, msg)
+	defer fmt.Fprintln(tty)
+	return term.ReadPassword(int(tty.Fd()))
+}
+
+// HexOrSource decodes s as hex or, if s is a source(see IsSource),
+// decodes the hex read from it. Whitespace is ignored.
+// If s is a key reference(see IsKeyRef), the key is returned as is.
+func HexOrSource(s string) ([]byte, error) {
+	if IsKeyRef(s) {
+		return ReadKeyRef(s)
+	}
+	if !IsSource(s) {
+		return stdfile.Decode([]byte(s), "hex")
+	}
+	data, err := ReadSource(s)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(data)
+	return stdfile.Decode(data, "hex")
+}
+
+// ReadSecret is like HexOrSource, for keys: the result is returned
+// in a secret buffer.
+func ReadSecret(s string) (*secret.Buffer, error) {
+	b, err := HexOrSource(s)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Protect(b)
+}
@@ -0,0 +1,68 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadSource(t *testing.T) {
+	want := []byte("000102030405060708090a0b0c0d0e0f")
+
+	t.Setenv("POCRYP_TEST_KEY", string(want))
+
+	file := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(file, want, 0600); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, source := range []string{
+		"env:POCRYP_TEST_KEY",
+		fmt.Sprintf("fd:%d", f.Fd()),
+		file,
+	} {
+		t.Run(source, func(t *testing.T) {
+			have, err := ReadSource(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(have, want) {
+				t.Fatalf("want %q, have %q", want, have)
+			}
+		})
+	}
+
+	for _, source := range []string{"env:POCRYP_TEST_NOT_SET", "fd:foo", "fd:-1"} {
+		t.Run(source, func(t *testing.T) {
+			if _, err := ReadSource(source); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
+
+func TestHexOrSource(t *testing.T) {
+	want := []byte{0x00, 0x01, 0x02, 0x03}
+	t.Setenv("POCRYP_TEST_KEY", "00010203\n")
+
+	for _, s := range []string{"00010203", "env:POCRYP_TEST_KEY"} {
+		have, err := HexOrSource(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Fatalf("want %x, have %x", want, have)
+		}
+	}
+
+	if _, err := HexOrSource("foo"); err == nil {
+		t.Fatal("expected error")
+	}
+}
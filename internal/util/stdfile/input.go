@@ -0,0 +1,101 @@
+package stdfile
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+// InputFormats contains the formats supported by Decode.
+var InputFormats = []string{"bin", "hex", "base64", "pem", "auto"}
+
+// Input is the format of the data read with StdFile.ReadAs.
+type Input struct {
+	// one of InputFormats
+	Format string
+}
+
+// InputFlags defines the flag -in-format in fs, with format as default,
+// and returns the Input set by it.
+func InputFlags(fs *flag.FlagSet, format string) *Input {
+	var in Input
+	fs.StringVar(&in.Format, "in-format", format, "Format of the input: "+strings.Join(InputFormats, ", ")+".")
+	return &in
+}
+
+// ReadAs reads all the input and decodes it in the format in.
+func (f *StdFile) ReadAs(in *Input) ([]byte, error) {
+	data, err := f.Read()
+	if err != nil {
+		return nil, err
+	}
+	return Decode(data, in.Format)
+}
+
+// Decode returns data decoded from the given format, one of InputFormats.
+// Whitespace is ignored in hex and base64, hex bytes can be separated by ':'.
+// For pem, the first PEM block is decoded.
+func Decode(data []byte, format string) ([]byte, error) {
+	if format == "auto" {
+		format = Detect(data)
+	}
+	switch format {
+	case "bin":
+		return data, nil
+	case "hex":
+		return hex.DecodeString(stripHex(data))
+	case "base64":
+		return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(data)), ""))
+	case "pem":
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, cmd.WithCategory(cmd.CategoryInvalidInput, errors.New("failed to parse PEM block"))
+		}
+		return block.Bytes, nil
+	default:
+		return nil, cmd.WithCategory(cmd.CategoryUsage, fmt.Errorf("unknown input format %q", format))
+	}
+}
+
+// Detect returns the format of data: pem, hex, base64 or bin if data is
+// not valid in any of the other formats.
+//
+// Data made only of hex digits can also be valid base64, e.g. AAAA. It is
+// detected as hex, the more specific format, unless it mixes lower and
+// upper case letters, which hex encoders don't. Give the format explicitly
+// for base64 data like AAAA.
+func Detect(data []byte) string {
+	s := bytes.TrimSpace(data)
+	if len(s) == 0 {
+		return "bin"
+	}
+	if bytes.HasPrefix(s, []byte("-----BEGIN")) {
+		if block, _ := pem.Decode(s); block != nil {
+			return "pem"
+		}
+	}
+	_, err := hex.DecodeString(stripHex(s))
+	isHex := err == nil
+	_, err = base64.StdEncoding.DecodeString(strings.Join(strings.Fields(string(s)), ""))
+	isBase64 := err == nil
+	switch {
+	case isHex && isBase64 && bytes.ContainsAny(s, "abcdef") && bytes.ContainsAny(s, "ABCDEF"):
+		return "base64"
+	case isHex:
+		return "hex"
+	case isBase64:
+		return "base64"
+	}
+	return "bin"
+}
+
+func stripHex(data []byte) string {
+	return strings.NewReplacer(" ", "", "\t", "", "\r", "", "\n", "", ":", "").Replace(string(data))
+}
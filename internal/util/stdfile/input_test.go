@@ -0,0 +1,64 @@
+package stdfile
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDetectAmbiguous(t *testing.T) {
+	for _, tt := range []struct{ input, detect string }{
+		{"AAAA", "hex"},
+		{"00112233445566778899aabbccddeeff", "hex"},
+		{"00112233445566778899AABBCCDDEEFF", "hex"},
+		{"AbCd", "base64"},
+		{"aB", "hex"},
+	} {
+		if v := Detect([]byte(tt.input)); v != tt.detect {
+			t.Fatalf("%s: want %s, have %s", tt.input, tt.detect, v)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	want := []byte{0x30, 0x03, 0x02, 0x01, 0x05}
+	pemData := "-----BEGIN TEST-----\nMAMCAQU=\n-----END TEST-----\n"
+
+	tests := []struct {
+		format string
+		input  string
+		detect string
+	}{
+		{"bin", "\x30\x03\x02\x01\x05", "bin"},
+		{"hex", "3003020105", "hex"},
+		{"hex", " 30 03\n02:01:05\r\n", "hex"},
+		{"base64", "MAMCAQU=\n", "base64"},
+		{"pem", pemData, "pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+"/"+tt.input, func(t *testing.T) {
+			for _, format := range []string{tt.format, "auto"} {
+				have, err := Decode([]byte(tt.input), format)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(have, want) {
+					t.Fatalf("%s: want %x, have %x", format, want, have)
+				}
+			}
+			if v := Detect([]byte(tt.input)); v != tt.detect {
+				t.Fatalf("want %s, have %s", tt.detect, v)
+			}
+		})
+	}
+
+	for _, tt := range []struct{ format, input string }{
+		{"hex", "300"},
+		{"base64", "MAMCAQU"},
+		{"pem", "MAMCAQU="},
+		{"xml", ""},
+	} {
+		if _, err := Decode([]byte(tt.input), tt.format); err == nil {
+			t.Fatalf("%s %q: expected error", tt.format, tt.input)
+		}
+	}
+}
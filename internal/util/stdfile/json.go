@@ -0,0 +1,42 @@
+package stdfile
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+)
+
+// Result is the JSON object written by a command in JSON mode.
+type Result map[string]any
+
+// Hex is a byte slice encoded as a hex string in JSON.
+type Hex []byte
+
+func (h Hex) MarshalText() ([]byte, error) {
+	return hex.AppendEncode(nil, h), nil
+}
+
+func (h *Hex) UnmarshalText(b []byte) error {
+	v, err := hex.AppendDecode(nil, b)
+	if err != nil {
+		return err
+	}
+	*h = v
+	return nil
+}
+
+// WriteJSON writes v to w as indented JSON.
+func WriteJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// WriteJSON writes v to Out as indented JSON and commits the output,
+// so it must be the last write.
+func (f *StdFile) WriteJSON(v any) error {
+	if err := WriteJSON(f.Out, v); err != nil {
+		return err
+	}
+	return f.Commit()
+}
@@ -0,0 +1,30 @@
+package stdfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteJSON(&b, Result{"data": Hex{0x00, 0xab}}); err != nil {
+		t.Fatal(err)
+	}
+	want := "{\n  \"data\": \"00ab\"\n}\n"
+	if b.String() != want {
+		t.Fatalf("want %q, have %q", want, b.String())
+	}
+
+	var v struct{ Data Hex }
+	if err := json.Unmarshal(b.Bytes(), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v.Data, []byte{0x00, 0xab}) {
+		t.Fatalf("want 00ab, have %x", v.Data)
+	}
+
+	if err := json.Unmarshal([]byte(`{"Data":"0g"}`), &v); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,29 @@
+package stdfile
+
+import (
+	"fmt"
+	"os"
+)
+
+// Lock takes an exclusive lock on the file at path, created if it doesn't
+// exist, and waits until the lock is available. The lock is released by
+// unlock or when the process exits, the file is left in place.
+//
+// The lock is advisory, it excludes only the other callers of Lock.
+func Lock(path string) (unlock func() error, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	return func() error {
+		if err := unlockFile(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
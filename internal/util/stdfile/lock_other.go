@@ -0,0 +1,16 @@
+//go:build !unix && !windows
+
+package stdfile
+
+import (
+	"errors"
+	"os"
+)
+
+func lockFile(f *os.File) error {
+	return errors.New("not supported on this platform")
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
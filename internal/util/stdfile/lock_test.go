@@ -0,0 +1,43 @@
+package stdfile
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locked := make(chan error)
+	go func() {
+		unlock, err := Lock(path)
+		if err == nil {
+			err = unlock()
+		}
+		locked <- err
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("locked twice")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := unlock(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("not locked after unlock")
+	}
+}
@@ -0,0 +1,119 @@
+package stdfile
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/encoding/hexfile"
+)
+
+// OutputFormats contains the formats supported by Output.
+var OutputFormats = []string{"hex", "bin", "base64", "c", "go", "rust", "ihex", "srec"}
+
+// Output is the format of the data written with StdFile.Write.
+type Output struct {
+	// one of OutputFormats, empty for hex
+	Format string
+
+	// load address, for ihex and srec
+	Address uint64
+
+	// variable name, for c, go and rust
+	Name string
+
+	// options of the output file, for New
+	Options
+
+	bin bool
+}
+
+// OutputFlags defines the flags -bin, -out-format, -load-address, -var-name
+// and -force in fs and returns the Output set by them.
+func OutputFlags(fs *flag.FlagSet) *Output {
+	var o Output
+	o.Options.flags(fs)
+	fs.BoolVar(&o.bin, "bin", false, "Print output in binary form not hex, same as -out-format bin.")
+	fs.StringVar(&o.Format, "out-format", "", "Format of the output: "+strings.Join(OutputFormats, ", ")+".")
+	fs.Uint64Var(&o.Address, "load-address", 0, "Load address of the output, for ihex and srec.")
+	fs.StringVar(&o.Name, "var-name", "data", "Name of the variable, for c, go and rust.")
+	return &o
+}
+
+// IsSet returns true if the format was given with -bin or -out-format, for
+// commands which write another format by default, e.g. PEM.
+func (o *Output) IsSet() bool {
+	return o.bin || o.Format != ""
+}
+
+// IsText returns true if the encodings of several values can be written one
+// after the other, e.g. hex lines or C arrays, false for bin, ihex and srec.
+func (o *Output) IsText() bool {
+	if o.bin {
+		return false
+	}
+	switch o.Format {
+	case "bin", "ihex", "srec":
+		return false
+	}
+	return true
+}
+
+// Encode returns b encoded in the format o.
+func (o *Output) Encode(b []byte) ([]byte, error) {
+	format := o.Format
+	if o.bin {
+		if format != "" && format != "bin" {
+			return nil, fmt.Errorf("-bin conflicts with output format %q", format)
+		}
+		format = "bin"
+	}
+
+	name := o.Name
+	if name == "" {
+		name = "data"
+	}
+
+	switch format {
+	case "", "hex":
+		return []byte(hex.EncodeToString(b) + "\n"), nil
+	case "bin":
+		return b, nil
+	case "base64":
+		return []byte(base64.StdEncoding.EncodeToString(b) + "\n"), nil
+	case "c":
+		return []byte(fmt.Sprintf("const unsigned char %s[%d] = {\n%s};\n", name, len(b), byteList(b, "    "))), nil
+	case "go":
+		return []byte(fmt.Sprintf("var %s = []byte{\n%s}\n", name, byteList(b, "\t"))), nil
+	case "rust":
+		return []byte(fmt.Sprintf("pub const %s: &[u8] = &[\n%s];\n", strings.ToUpper(name), byteList(b, "    "))), nil
+	case "ihex", "srec":
+		if o.Address > 0xffffffff {
+			return nil, fmt.Errorf("load address 0x%x is too big", o.Address)
+		}
+		if format == "ihex" {
+			return hexfile.EncodeIntelHex(uint32(o.Address), b)
+		}
+		return hexfile.EncodeSRecord(uint32(o.Address), b)
+	default:
+		return nil, fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+// byteList returns b as lines of 12 comma separated 0x.. values.
+func byteList(b []byte, indent string) string {
+	var sb strings.Builder
+	for i := 0; i < len(b); i += 12 {
+		sb.WriteString(indent)
+		for j, v := range b[i:min(i+12, len(b))] {
+			if j != 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "0x%02x,", v)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
@@ -0,0 +1,51 @@
+package stdfile
+
+import (
+	"flag"
+	"testing"
+)
+
+func TestOutput(t *testing.T) {
+	data := []byte{0x00, 0x01, 0xfe, 0xff}
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "0001feff\n"},
+		{[]string{"-out-format", "hex"}, "0001feff\n"},
+		{[]string{"-bin"}, "\x00\x01\xfe\xff"},
+		{[]string{"-out-format", "base64"}, "AAH+/w==\n"},
+		{[]string{"-out-format", "c", "-var-name", "key"}, "const unsigned char key[4] = {\n    0x00, 0x01, 0xfe, 0xff,\n};\n"},
+		{[]string{"-out-format", "go"}, "var data = []byte{\n\t0x00, 0x01, 0xfe, 0xff,\n}\n"},
+		{[]string{"-out-format", "rust", "-var-name", "key"}, "pub const KEY: &[u8] = &[\n    0x00, 0x01, 0xfe, 0xff,\n];\n"},
+		{[]string{"-out-format", "ihex", "-load-address", "0x100"}, ":040100000001FEFFFD\n:00000001FF\n"},
+		{[]string{"-out-format", "srec", "-load-address", "0x100"}, "S0030000FC\nS10701000001FEFFF9\nS9030100FB\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			fs := flag.NewFlagSet("test", flag.ContinueOnError)
+			o := OutputFlags(fs)
+			if err := fs.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			have, err := o.Encode(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have) != tt.want {
+				t.Fatalf("want %q, have %q", tt.want, have)
+			}
+		})
+	}
+
+	for _, o := range []Output{
+		{Format: "xml"},
+		{Format: "c", bin: true},
+		{Format: "ihex", Address: 1 << 32},
+	} {
+		if _, err := o.Encode(data); err == nil {
+			t.Fatalf("%+v: expected error", o)
+		}
+	}
+}
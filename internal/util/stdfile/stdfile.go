@@ -2,21 +2,65 @@ package stdfile
 
 import (
 	"bytes"
+	"crypto/rand"
 	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
 )
 
+// Options of the output file of a StdFile.
+type Options struct {
+	// overwrite an existing file
+	Force bool
+
+	// create the file readable and writable only by its owner(0600)
+	Secret bool
+}
+
+// OptionsFlags defines the flag -force in fs and returns the Options set by it.
+func OptionsFlags(fs *flag.FlagSet) *Options {
+	var o Options
+	o.flags(fs)
+	return &o
+}
+
+func (o *Options) flags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.Force, "force", false, "Overwrite OUTPUT if it exists.")
+}
+
+// StdFile reads from a file or stdin and writes to a file or stdout.
+//
+// The output file is written to a temporary file in the same directory,
+// which replaces the output file when Commit is called. If Close is called
+// before Commit, e.g. the operation failed, the output file is not touched.
 type StdFile struct {
 	In    *os.File
 	stdin bool
 
 	Out    *os.File
 	stdout bool
+
+	// path of the output file, empty if Out is written directly
+	outPath   string
+	committed bool
+
+	secret bool
 }
 
-func New(infile, outfile string) (*StdFile, error) {
+// New opens infile and creates a temporary file for outfile,
+// an empty path means stdin and stdout.
+//
+// An existing regular outfile is refused, unless o.Force is set, then it
+// keeps its mode(without the group and other bits if o.Secret is set).
+// Other existing files(e.g. /dev/null, a FIFO) are written directly.
+func New(infile, outfile string, o Options) (*StdFile, error) {
 	var r StdFile
 
 	if infile == "" {
@@ -31,36 +75,123 @@ func New(infile, outfile string) (*StdFile, error) {
 		r.stdin = false
 	}
 
+	r.secret = o.Secret
+
 	if outfile == "" {
 		r.Out = os.Stdout
 		r.stdout = true
 	} else {
-		f, err := os.Create(outfile)
-		if err != nil {
+		if err := r.createOut(outfile, o); err != nil {
+			if !r.stdin {
+				r.In.Close()
+			}
 			return nil, err
 		}
-		r.Out = f
 		r.stdout = false
 	}
 
 	return &r, nil
 }
 
-func (f *StdFile) Close() error {
-	if !f.stdin {
-		if err := f.In.Close(); err != nil {
+func (f *StdFile) createOut(path string, o Options) error {
+	perm := os.FileMode(0666)
+	if o.Secret {
+		perm = 0600
+	}
+
+	// an existing file keeps its mode, without the group and other bits
+	// for a secret output
+	var keep bool
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	case !info.Mode().IsRegular():
+		f.Out, err = os.OpenFile(path, os.O_WRONLY, 0)
+		return err
+	case !o.Force:
+		return cmd.WithCategory(cmd.CategoryUsage, fmt.Errorf("%s already exists, use -force to overwrite it", path))
+	default:
+		// replace the target of a symlink, not the symlink
+		if path, err = filepath.EvalSymlinks(path); err != nil {
 			return err
 		}
+		keep = true
+		perm &= info.Mode().Perm()
 	}
-	if !f.stdout {
-		if err := f.Out.Close(); err != nil {
+
+	suffix := make([]byte, 6)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	tmp := path + ".tmp-" + hex.EncodeToString(suffix)
+
+	f.Out, err = os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	f.outPath = path
+
+	// the mode given to OpenFile is masked by the umask
+	if keep {
+		if err := f.Out.Chmod(perm); err != nil {
+			f.Out.Close()
+			os.Remove(tmp)
 			return err
 		}
 	}
+
+	return nil
+}
+
+// Commit replaces the output file with the data written to Out,
+// nothing is done for stdout or an output file written directly.
+// Out must not be used after Commit.
+func (f *StdFile) Commit() error {
+	if f.outPath == "" || f.committed {
+		return nil
+	}
+	tmp := f.Out.Name()
+	if err := f.Out.Sync(); err != nil {
+		return err
+	}
+	f.committed = true
+	if err := f.Out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, f.outPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
 	return nil
 }
 
+// Close closes the files, the output is discarded if not committed.
+func (f *StdFile) Close() error {
+	if !f.stdin {
+		if err := f.In.Close(); err != nil {
+			return err
+		}
+	}
+	if f.stdout || f.committed {
+		return nil
+	}
+	if f.outPath != "" {
+		f.committed = true
+		f.Out.Close()
+		return os.Remove(f.Out.Name())
+	}
+	return f.Out.Close()
+}
+
 func (f *StdFile) Read() ([]byte, error) {
+	if f.stdin {
+		if err := ClaimStdin("the input"); err != nil {
+			return nil, err
+		}
+	}
 	var input bytes.Buffer
 	if _, err := io.Copy(&input, f.In); err != nil {
 		return nil, err
@@ -68,12 +199,19 @@ func (f *StdFile) Read() ([]byte, error) {
 	return input.Bytes(), nil
 }
 
-func (f *StdFile) WriteHexOrBin(b []byte, bin bool) error {
-	var err error
-	if bin {
-		_, err = f.Out.Write(b)
-	} else {
-		_, err = fmt.Fprintln(f.Out, hex.EncodeToString(b))
+// Write writes b to Out in the format o and commits the output,
+// so it must be the last write. For a secret output, the encoded copy of b
+// is wiped, b is left to the caller.
+func (f *StdFile) Write(b []byte, o *Output) error {
+	data, err := o.Encode(b)
+	if err != nil {
+		return err
+	}
+	if f.secret && (len(data) == 0 || len(b) == 0 || &data[0] != &b[0]) {
+		defer clear(data)
+	}
+	if _, err := f.Out.Write(data); err != nil {
+		return err
 	}
-	return err
+	return f.Commit()
 }
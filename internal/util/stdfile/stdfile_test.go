@@ -0,0 +1,156 @@
+package stdfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+func TestOutputFile(t *testing.T) {
+	tmp := t.TempDir()
+	out := filepath.Join(tmp, "out")
+	bin := &Output{Format: "bin"}
+
+	write := func(data string, o Options) error {
+		sf, err := New("", out, o)
+		if err != nil {
+			return err
+		}
+		defer sf.Close()
+		return sf.Write([]byte(data), bin)
+	}
+	expect := func(t *testing.T, want string) {
+		t.Helper()
+		have, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(have) != want {
+			t.Fatalf("want %q, have %q", want, have)
+		}
+	}
+	expectNoTemp := func(t *testing.T) {
+		t.Helper()
+		matches, err := filepath.Glob(out + ".tmp-*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 0 {
+			t.Fatal("temporary files not removed:", matches)
+		}
+	}
+
+	if err := write("first", Options{Secret: true}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, "first")
+	info, err := os.Stat(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Fatalf("secret output permissions: %o", perm)
+	}
+
+	t.Run("Exists", func(t *testing.T) {
+		err := write("second", Options{})
+		if err == nil {
+			t.Fatal("expected error")
+		}
+		if c := cmd.CategoryOf(err); c != cmd.CategoryUsage {
+			t.Fatalf("expected a usage error, have %s", c)
+		}
+		expect(t, "first")
+	})
+
+	t.Run("NotCommitted", func(t *testing.T) {
+		sf, err := New("", out, Options{Force: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := sf.Out.Write([]byte("partial")); err != nil {
+			t.Fatal(err)
+		}
+		if err := sf.Close(); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "first")
+		expectNoTemp(t)
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		if err := write("second", Options{Force: true}); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, "second")
+		expectNoTemp(t)
+	})
+
+	t.Run("KeepMode", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("no permissions on windows")
+		}
+		for _, tt := range []struct {
+			mode, want os.FileMode
+			secret     bool
+		}{
+			{0664, 0664, false},
+			{0640, 0640, false},
+			{0644, 0600, true},
+			{0400, 0400, true},
+		} {
+			if err := os.Chmod(out, tt.mode); err != nil {
+				t.Fatal(err)
+			}
+			if err := write("mode", Options{Force: true, Secret: tt.secret}); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if perm := info.Mode().Perm(); perm != tt.want {
+				t.Fatalf("mode %o, secret %v: want %o, have %o", tt.mode, tt.secret, tt.want, perm)
+			}
+		}
+		if err := os.Chmod(out, 0644); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Symlink", func(t *testing.T) {
+		link := filepath.Join(tmp, "link")
+		if err := os.Symlink(out, link); err != nil {
+			t.Skip(err)
+		}
+		sf, err := New("", link, Options{Force: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sf.Close()
+		if err := sf.Write([]byte("third"), bin); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+			t.Fatal("symlink replaced", err)
+		}
+		expect(t, "third")
+	})
+
+	t.Run("NotRegular", func(t *testing.T) {
+		if _, err := os.Stat(os.DevNull); err != nil {
+			t.Skip(err)
+		}
+		sf, err := New("", os.DevNull, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer sf.Close()
+		if err := sf.Write([]byte("data"), bin); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package stdfile
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+// stdinReader is what read stdin, e.g. "the input", and the stdin it was.
+var stdinReader struct {
+	file *os.File
+	name string
+}
+
+// ClaimStdin records that stdin is read for name, e.g. "-key -". Stdin can
+// be read only once, so it is a usage error if it was read for something
+// else, e.g. a key given as - and the input of the command.
+func ClaimStdin(name string) error {
+	if stdinReader.file == os.Stdin && stdinReader.name != name {
+		return cmd.WithCategory(cmd.CategoryUsage,
+			fmt.Errorf("stdin cannot be read for %s, it is read for %s", name, stdinReader.name))
+	}
+	stdinReader.file = os.Stdin
+	stdinReader.name = name
+	return nil
+}
+
+// ReadStdin claims stdin for name(see ClaimStdin) and reads all of it.
+func ReadStdin(name string) ([]byte, error) {
+	if err := ClaimStdin(name); err != nil {
+		return nil, err
+	}
+	return io.ReadAll(os.Stdin)
+}
@@ -0,0 +1,48 @@
+package stdfile
+
+import (
+	"os"
+	"testing"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+)
+
+func TestClaimStdin(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prev := os.Stdin
+	os.Stdin = f
+	defer func() { os.Stdin = prev }()
+
+	if _, err := ReadStdin("the key"); err != nil {
+		t.Fatal(err)
+	}
+	sf, err := New("", "", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sf.Read()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if cmd.CategoryOf(err) != cmd.CategoryUsage {
+		t.Fatalf("expected a usage error, have %v", err)
+	}
+	if err := ClaimStdin("the key"); err != nil {
+		t.Fatal(err)
+	}
+
+	// another stdin can be read again, e.g. by the next command
+	g, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	os.Stdin = g
+	if _, err := sf.Read(); err != nil {
+		t.Fatal(err)
+	}
+}
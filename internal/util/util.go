@@ -1,11 +1,34 @@
 package util
 
 import (
-	"encoding/hex"
+	"bytes"
 	"errors"
-	"os"
+	"flag"
+	"strings"
+
+	"bandr.me/p/pocryp/internal/cli/cmd"
+	"bandr.me/p/pocryp/internal/secret"
+	"bandr.me/p/pocryp/internal/util/stdfile"
 )
 
+// ErrNotValid is returned when a MAC, signature or key is not valid.
+var ErrNotValid = cmd.WithCategory(cmd.CategoryVerificationFailed, errors.New("not valid"))
+
+// InvalidInput returns err as an error of category invalid-input.
+func InvalidInput(err error) error {
+	return cmd.WithCategory(cmd.CategoryInvalidInput, err)
+}
+
+// VerificationFailed returns err as an error of category verification-failed.
+func VerificationFailed(err error) error {
+	return cmd.WithCategory(cmd.CategoryVerificationFailed, err)
+}
+
+// CryptoFailure returns err as an error of category crypto-failure.
+func CryptoFailure(err error) error {
+	return cmd.WithCategory(cmd.CategoryCryptoFailure, err)
+}
+
 func BitLenToByteLen(n int) int {
 	return (n + 7) / 8
 }
@@ -33,15 +56,63 @@ func Xor(dst, l, r []byte) error {
 }
 
 func FileOrHex(filePath, hexStr string) ([]byte, error) {
+	return FileOrHexAs(filePath, hexStr, "bin")
+}
+
+// FormatFlag defines the flag -NAME-format in fs, with format as default,
+// for the format of the file given with -NAME-file(see stdfile.InputFormats).
+func FormatFlag(fs *flag.FlagSet, name, format string) *string {
+	return fs.String(name+"-format", format,
+		"Format of the file of -"+name+"-file: "+strings.Join(stdfile.InputFormats, ", ")+".")
+}
+
+// KeyFormatFlag defines the flag -key-format in fs, auto by default, for
+// the format of the key file given to ReadKey.
+func KeyFormatFlag(fs *flag.FlagSet) *string {
+	return FormatFlag(fs, "key", "auto")
+}
+
+// FileOrHexAs is like FileOrHex, the content of the file is decoded from
+// format(see stdfile.InputFormats).
+func FileOrHexAs(filePath, hexStr, format string) ([]byte, error) {
+	return readKey(filePath, hexStr, format)
+}
+
+// ReadKey is like FileOrHex, the content of the file is decoded from
+// format(see stdfile.InputFormats), whitespace is ignored in hexStr.
+// Both filePath and hexStr can be a source of ReadSource or a key reference
+// of ReadKeyRef. The key is returned in a secret buffer, the intermediate
+// copies are wiped.
+func ReadKey(filePath, hexStr, format string) (*secret.Buffer, error) {
+	key, err := readKey(filePath, hexStr, format)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Protect(key)
+}
+
+func readKey(filePath, hexStr, format string) ([]byte, error) {
 	if filePath == "" && hexStr == "" {
-		return nil, errors.New("neither file path nor hex string specified")
+		return nil, cmd.WithCategory(cmd.CategoryUsage, errors.New("neither file path nor hex string specified"))
 	}
 	if filePath != "" && hexStr != "" {
-		return nil, errors.New("cannot specify file path and hex string at the same time")
+		return nil, cmd.WithCategory(cmd.CategoryUsage, errors.New("cannot specify file path and hex string at the same time"))
 	}
 	if hexStr != "" {
-		return hex.DecodeString(hexStr)
-	} else {
-		return os.ReadFile(filePath)
+		return HexOrSource(hexStr)
+	}
+	if IsKeyRef(filePath) {
+		return ReadKeyRef(filePath)
+	}
+	data, err := ReadSource(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer secret.Wipe(data)
+	key, err := stdfile.Decode(data, format)
+	if err != nil {
+		return nil, err
 	}
+	// key may be data
+	return bytes.Clone(key), nil
 }
@@ -3,6 +3,8 @@ package util
 import (
 	"bytes"
 	"encoding/hex"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -81,3 +83,48 @@ func TestXor(t *testing.T) {
 		}
 	}
 }
+
+func TestReadKey(t *testing.T) {
+	want, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+
+	file := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(file, []byte("00010203 04050607\n08090a0b 0c0d0e0f\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		file, hex, format string
+	}{
+		{"", "00010203 04050607 08090a0b 0c0d0e0f", "auto"},
+		{file, "", "auto"},
+		{file, "", "hex"},
+	} {
+		key, err := ReadKey(tt.file, tt.hex, tt.format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(key.Bytes(), want) {
+			t.Fatalf("want %x, have %x", want, key.Bytes())
+		}
+		b := key.Bytes()
+		key.Destroy()
+		if !bytes.Equal(b, make([]byte, len(want))) {
+			t.Fatalf("key not cleared by Destroy: %x", b)
+		}
+	}
+
+	key, err := ReadKey(file, "", "bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Len() != 36 {
+		t.Fatal("expected the file as is, have", key.Bytes())
+	}
+
+	if _, err := ReadKey(file, "00", "auto"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ReadKey("", "", "auto"); err == nil {
+		t.Fatal("expected error")
+	}
+}
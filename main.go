@@ -1,18 +1,21 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
 	"bandr.me/p/pocryp/internal/aes"
 	"bandr.me/p/pocryp/internal/cli"
+	"bandr.me/p/pocryp/internal/cli/cmd"
 	"bandr.me/p/pocryp/internal/hash"
 	"bandr.me/p/pocryp/internal/kdf"
 	"bandr.me/p/pocryp/internal/keygen"
 
+	audit_rsa "bandr.me/p/pocryp/internal/audit/rsa/cmd"
 	"bandr.me/p/pocryp/internal/dsa"
+	encoding_asn1 "bandr.me/p/pocryp/internal/encoding/asn1"
 	encoding_rsa "bandr.me/p/pocryp/internal/encoding/rsa"
 	kem_rsa "bandr.me/p/pocryp/internal/kem/rsa/cmd"
+	keystore "bandr.me/p/pocryp/internal/keystore/cmd"
 	keywrap_aes "bandr.me/p/pocryp/internal/keywrap/aes/cmd"
 	"bandr.me/p/pocryp/internal/misc"
 	padding_pkcs7 "bandr.me/p/pocryp/internal/padding/pkcs7/cmd"
@@ -31,12 +34,28 @@ func main() {
 		keygen.Ed25519GetPubCmd,
 	)
 
+	a.Add(
+		"Keystore",
+		keystore.AddCmd,
+		keystore.GenerateCmd,
+		keystore.ListCmd,
+		keystore.ExportCmd,
+		keystore.DeleteCmd,
+	)
+
 	a.Add(
 		"Key Encoding",
 		encoding_rsa.Raw2DerCmd,
 		encoding_rsa.Der2RawCmd,
 		encoding_rsa.Pem2DerCmd,
 		encoding_rsa.Der2PemCmd,
+		encoding_rsa.ValidateCmd,
+		encoding_asn1.DumpCmd,
+	)
+
+	a.Add(
+		"Key Audit",
+		audit_rsa.Cmd,
 	)
 
 	a.Add(
@@ -91,6 +110,11 @@ func main() {
 		she.ExampleCmd,
 		she.EncodeCmd,
 		she.DecodeCmd,
+		she.VerifyCmd,
+		she.EmuCmd,
+		she.BootMACCmd,
+		she.KDFCmd,
+		she.DebugAuthCmd,
 	)
 
 	a.Add(
@@ -102,10 +126,112 @@ func main() {
 		"Miscellaneous",
 		misc.Base64Cmd,
 		misc.HexCmd,
+		a.CompletionCmd(),
+		a.PipelineCmd(),
 	)
 
+	addGroups(&a)
+
 	if err := a.Run(os.Args[1:]...); err != nil {
-		fmt.Fprintln(os.Stderr, "error:", err)
-		os.Exit(1)
+		a.PrintError(os.Stderr, err)
+		os.Exit(cli.ExitCode(err))
 	}
 }
+
+// addGroups adds the command tree, its commands are aliases of the ones
+// added by category, whose names stay valid.
+func addGroups(a *cli.App) {
+	aesGroup := a.Group("aes", "AES keys, ciphers, MACs and key wrap")
+	aesGroup.Add(cmd.Alias("keygen", "Generate AES key", keygen.AesCmd))
+	aesGroup.Group("ecb", "Encrypt/Decrypt using AES-ECB").Add(
+		cmd.Alias("encrypt", "Encrypt using AES-ECB", aes.EcbCmd, "-e"),
+		cmd.Alias("decrypt", "Decrypt using AES-ECB", aes.EcbCmd, "-d"),
+	)
+	aesGroup.Group("cbc", "Encrypt/Decrypt using AES-CBC").Add(
+		cmd.Alias("encrypt", "Encrypt using AES-CBC", aes.CbcCmd, "-e"),
+		cmd.Alias("decrypt", "Decrypt using AES-CBC", aes.CbcCmd, "-d"),
+	)
+	aesGroup.Group("gcm", "Encrypt/Decrypt using AES-GCM").Add(
+		cmd.Alias("encrypt", "Encrypt using AES-GCM", aes.GcmCmd, "-e"),
+		cmd.Alias("decrypt", "Decrypt using AES-GCM", aes.GcmCmd, "-d"),
+	)
+	aesGroup.Group("cmac", "Generate/Verify MAC using AES-CMAC").Add(
+		cmd.Alias("generate", aes.CmacGenerateCmd.Brief, aes.CmacGenerateCmd),
+		cmd.Alias("verify", aes.CmacVerifyCmd.Brief, aes.CmacVerifyCmd),
+	)
+	aesGroup.Group("keywrap", "Wrap/Unwrap using AES-KEYWRAP").Add(
+		cmd.Alias("wrap", "Wrap using AES-KEYWRAP", keywrap_aes.Cmd, "-w"),
+		cmd.Alias("unwrap", "Unwrap using AES-KEYWRAP", keywrap_aes.Cmd, "-u"),
+	)
+
+	rsaGroup := a.Group("rsa", "RSA keys, encodings, audit and KEM")
+	rsaGroup.Add(
+		cmd.Alias("keygen", keygen.RsaCmd.Brief, keygen.RsaCmd),
+		cmd.Alias("getpub", keygen.RsaGetPubCmd.Brief, keygen.RsaGetPubCmd),
+		cmd.Alias("validate", encoding_rsa.ValidateCmd.Brief, encoding_rsa.ValidateCmd),
+		cmd.Alias("audit", audit_rsa.Cmd.Brief, audit_rsa.Cmd),
+	)
+	rsaGroup.Group("convert", "Convert RSA keys between encodings").Add(
+		cmd.Alias("raw2der", encoding_rsa.Raw2DerCmd.Brief, encoding_rsa.Raw2DerCmd),
+		cmd.Alias("der2raw", encoding_rsa.Der2RawCmd.Brief, encoding_rsa.Der2RawCmd),
+		cmd.Alias("pem2der", encoding_rsa.Pem2DerCmd.Brief, encoding_rsa.Pem2DerCmd),
+		cmd.Alias("der2pem", encoding_rsa.Der2PemCmd.Brief, encoding_rsa.Der2PemCmd),
+	)
+	rsaGroup.Group("kem", "Encapsulate/Decapsulate using RSA-KEM").Add(
+		cmd.Alias("encapsulate", "Encapsulate using RSA-KEM", kem_rsa.Cmd, "-e"),
+		cmd.Alias("decapsulate", "Decapsulate using RSA-KEM", kem_rsa.Cmd, "-d"),
+	)
+
+	a.Group("ed25519", "ED25519 keys and signatures").Add(
+		cmd.Alias("keygen", keygen.Ed25519Cmd.Brief, keygen.Ed25519Cmd),
+		cmd.Alias("getpub", keygen.Ed25519GetPubCmd.Brief, keygen.Ed25519GetPubCmd),
+		cmd.Alias("sign", dsa.Ed25519SignCmd.Brief, dsa.Ed25519SignCmd),
+		cmd.Alias("verify", dsa.Ed25519VerifyCmd.Brief, dsa.Ed25519VerifyCmd),
+	)
+
+	a.Group("keystore", "Manage the keys of the keystore").Add(
+		cmd.Alias("add", keystore.AddCmd.Brief, keystore.AddCmd),
+		cmd.Alias("generate", keystore.GenerateCmd.Brief, keystore.GenerateCmd),
+		cmd.Alias("list", keystore.ListCmd.Brief, keystore.ListCmd),
+		cmd.Alias("export", keystore.ExportCmd.Brief, keystore.ExportCmd),
+		cmd.Alias("delete", keystore.DeleteCmd.Brief, keystore.DeleteCmd),
+	)
+
+	a.Group("asn1", "Inspect BER/DER encoded data").Add(
+		cmd.Alias("dump", encoding_asn1.DumpCmd.Brief, encoding_asn1.DumpCmd),
+	)
+
+	a.Group("kdf", "Key derivation functions").Add(
+		cmd.Alias("pbkdf2", kdf.Pbkdf2Cmd.Brief, kdf.Pbkdf2Cmd),
+	)
+
+	a.Group("hash", "Hash functions").Add(
+		cmd.Alias("sha", hash.ShaCmd.Brief, hash.ShaCmd),
+	)
+
+	a.Group("padding", "Padding schemes").Group("pkcs7", "Pad/Unpad input using PKCS7").Add(
+		cmd.Alias("pad", "Pad input using PKCS7", padding_pkcs7.Cmd, "-p"),
+		cmd.Alias("unpad", "Unpad input using PKCS7", padding_pkcs7.Cmd, "-u"),
+	)
+
+	a.Group("she", "Secured Hardware Extensions(AUTOSAR)").Add(
+		cmd.Alias("example", she.ExampleCmd.Brief, she.ExampleCmd),
+		cmd.Alias("encode", she.EncodeCmd.Brief, she.EncodeCmd),
+		cmd.Alias("decode", she.DecodeCmd.Brief, she.DecodeCmd),
+		cmd.Alias("verify", she.VerifyCmd.Brief, she.VerifyCmd),
+		cmd.Alias("emu", she.EmuCmd.Brief, she.EmuCmd),
+		cmd.Alias("boot-mac", she.BootMACCmd.Brief, she.BootMACCmd),
+		cmd.Alias("kdf", she.KDFCmd.Brief, she.KDFCmd),
+		cmd.Alias("debug-auth", she.DebugAuthCmd.Brief, she.DebugAuthCmd),
+	)
+
+	encodingGroup := a.Group("encoding", "Encode or decode data")
+	encodingGroup.Group("hex", misc.HexCmd.Brief).Add(
+		cmd.Alias("encode", "Hex encode", misc.HexCmd),
+		cmd.Alias("decode", "Hex decode", misc.HexCmd, "-d"),
+	)
+	encodingGroup.Group("base64", misc.Base64Cmd.Brief).Add(
+		cmd.Alias("encode", "Base64 encode", misc.Base64Cmd),
+		cmd.Alias("decode", "Base64 decode", misc.Base64Cmd, "-d"),
+	)
+}